@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// apkArchs maps GOARCH values to Alpine architectures
+var apkArchs = map[string]string{
+	"386":     "x86",
+	"amd64":   "x86_64",
+	"arm":     "armv7",
+	"arm64":   "aarch64",
+	"loong64": "loongarch64",
+	"ppc64le": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// apkPreRelease splits a pre-release such as rc.1 into its label and number
+var apkPreRelease = regexp.MustCompile(`^([a-zA-Z]+)\D*(\d*)`)
+
+// apkVersion returns the Alpine version of a release version, whose
+// pre-releases are suffixes such as _rc1. Labels Alpine doesn't know
+// become _pre.
+func apkVersion(version string) string {
+	release, pre, ok := strings.Cut(version, "-")
+	release, _, _ = strings.Cut(release, "+")
+	if !ok {
+		return release + "-r0"
+	}
+	label, number := "pre", ""
+	if m := apkPreRelease.FindStringSubmatch(pre); m != nil {
+		number = m[2]
+		switch strings.ToLower(m[1]) {
+		case "alpha", "beta", "pre", "rc":
+			label = strings.ToLower(m[1])
+		}
+	}
+	return fmt.Sprintf("%s_%s%s-r0", release, label, number)
+}
+
+// writeAPK builds an .apk package in dir: the gzipped control tarball,
+// without its end-of-archive blocks, followed by the gzipped data tarball,
+// which the control files record the checksum of
+func writeAPK(dir string, p linuxPackage) (string, error) {
+	arch, ok := apkArchs[p.Arch]
+	if !ok {
+		return "", fmt.Errorf("no Alpine architecture for %s", p.Arch)
+	}
+
+	data, size, err := apkData(p)
+	if err != nil {
+		return "", err
+	}
+	datahash := sha256.Sum256(data)
+	control, err := apkControl(p, arch, size, hex.EncodeToString(datahash[:]))
+	if err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, fmt.Sprintf("%s-%s.%s.apk", p.Name, apkVersion(p.Version), arch))
+	if err := os.WriteFile(out, append(control, data...), 0644); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// apkData returns the data tarball of the installed files, with the SHA-1
+// checksum apk verifies on every file, and their size
+func apkData(p linuxPackage) ([]byte, int64, error) {
+	var size int64
+	tarball, err := gzipTar(func(tw *tar.Writer) error {
+		for _, dir := range p.dirs() {
+			header := &tar.Header{Typeflag: tar.TypeDir, Name: strings.TrimPrefix(dir, "/") + "/", Mode: 0755, ModTime: p.Date, Format: tar.FormatPAX}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+		}
+		for _, f := range p.Files {
+			content, err := os.ReadFile(f.Src)
+			if err != nil {
+				return err
+			}
+			sum := sha1.Sum(content)
+			header := &tar.Header{
+				Typeflag:   tar.TypeReg,
+				Name:       strings.TrimPrefix(f.Dst, "/"),
+				Mode:       f.Mode,
+				Size:       int64(len(content)),
+				ModTime:    p.Date,
+				Format:     tar.FormatPAX,
+				PAXRecords: map[string]string{"APK-TOOLS.checksum.SHA1": hex.EncodeToString(sum[:])},
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(content); err != nil {
+				return err
+			}
+			size += int64(len(content))
+		}
+		return nil
+	})
+	return tarball, size, err
+}
+
+// apkControl returns the gzipped control tarball of a package: its
+// .PKGINFO and scripts. apk reads the package's tarballs as one, so this
+// one has no end-of-archive blocks.
+func apkControl(p linuxPackage, arch string, size int64, datahash string) ([]byte, error) {
+	var info strings.Builder
+	info.WriteString("# Generated by GReleaser\n")
+	fmt.Fprintf(&info, "pkgname = %s\n", p.Name)
+	fmt.Fprintf(&info, "pkgver = %s\n", apkVersion(p.Version))
+	fmt.Fprintf(&info, "pkgdesc = %s\n", p.Description)
+	if p.Homepage != "" {
+		fmt.Fprintf(&info, "url = %s\n", p.Homepage)
+	}
+	fmt.Fprintf(&info, "builddate = %d\n", p.Date.Unix())
+	fmt.Fprintf(&info, "packager = %s\n", p.Maintainer)
+	fmt.Fprintf(&info, "size = %d\n", size)
+	fmt.Fprintf(&info, "arch = %s\n", arch)
+	fmt.Fprintf(&info, "origin = %s\n", p.Name)
+	fmt.Fprintf(&info, "maintainer = %s\n", p.Maintainer)
+	if p.License != "" {
+		fmt.Fprintf(&info, "license = %s\n", p.License)
+	}
+	for _, dep := range p.Depends {
+		fmt.Fprintf(&info, "depend = %s\n", dep)
+	}
+	fmt.Fprintf(&info, "datahash = %s\n", datahash)
+
+	// pre-deinstall only runs on removal
+	postinst, prerm, postrm := p.systemdScripts("true")
+	files := []struct {
+		name, content string
+		mode          int64
+	}{
+		{".PKGINFO", info.String(), 0644},
+		{".post-install", postinst, 0755},
+		{".pre-deinstall", prerm, 0755},
+		{".post-deinstall", postrm, 0755},
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		if f.content == "" {
+			continue
+		}
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: f.name, Mode: f.mode, Size: int64(len(f.content)), ModTime: p.Date}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(tw, f.content); err != nil {
+			return nil, err
+		}
+	}
+	// Flush pads the last file without closing the archive
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestAPKVersion(t *testing.T) {
+	tests := []struct {
+		version, want string
+	}{
+		{"1.2.3", "1.2.3-r0"},
+		{"1.2.3+build.1", "1.2.3-r0"},
+		{"1.2.3-rc.1", "1.2.3_rc1-r0"},
+		{"1.2.3-RC2", "1.2.3_rc2-r0"},
+		{"1.2.3-alpha", "1.2.3_alpha-r0"},
+		{"1.2.3-beta.10+build.1", "1.2.3_beta10-r0"},
+		{"1.2.3-pre.3", "1.2.3_pre3-r0"},
+		{"1.2.3-nightly.20240102", "1.2.3_pre20240102-r0"},
+		{"1.2.3-0.20240102", "1.2.3_pre-r0"},
+	}
+	for _, tt := range tests {
+		if got := apkVersion(tt.version); got != tt.want {
+			t.Errorf("apkVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
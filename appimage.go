@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// appImageArchs maps GOARCH values to the architectures of appimagetool
+var appImageArchs = map[string]string{
+	"386":   "i686",
+	"amd64": "x86_64",
+	"arm":   "armhf",
+	"arm64": "aarch64",
+}
+
+// validateAppImage checks the APPIMAGE_* keys of a build
+func (b Build) validateAppImage() error {
+	i := b.Installer
+	if i.AppImageIcon != "" {
+		switch strings.ToLower(filepath.Ext(i.AppImageIcon)) {
+		case ".png", ".svg":
+		default:
+			return fmt.Errorf("%s must be a PNG or SVG image", b.Key("APPIMAGE_ICON"))
+		}
+		if _, err := os.Stat(i.AppImageIcon); err != nil {
+			return fmt.Errorf("%s: %w", b.Key("APPIMAGE_ICON"), err)
+		}
+	}
+	if i.AppImageDesktopFile != "" {
+		if _, err := os.Stat(i.AppImageDesktopFile); err != nil {
+			return fmt.Errorf("%s: %w", b.Key("APPIMAGE_DESKTOP_FILE"), err)
+		}
+	}
+	if i.AppImageExec != "" && !validInstallerPath(i.AppImageExec) {
+		return fmt.Errorf("invalid %s %q (expected a file relative to the archive's root)", b.Key("APPIMAGE_EXEC"), i.AppImageExec)
+	}
+	return nil
+}
+
+// appImageExec returns the installed file an AppImage runs
+func (a desktopApp) appImageExec() string {
+	if a.AppImageExec == "" {
+		return a.Binary
+	}
+	return path.Clean(strings.TrimSpace(a.AppImageExec))
+}
+
+// writeAppImage builds an AppImage of a Linux app in dir with appimagetool.
+// Its AppDir holds the app's files, the icon and desktop entry, and an
+// AppRun script running APPIMAGE_EXEC.
+func writeAppImage(dir string, app desktopApp) (string, error) {
+	arch, ok := appImageArchs[app.Arch]
+	if !ok {
+		return "", fmt.Errorf("no AppImage architecture for %s", app.Arch)
+	}
+	appimagetool, err := exec.LookPath("appimagetool")
+	if err != nil {
+		return "", fmt.Errorf("appimages need appimagetool: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp("", "greleaser-appimage-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	appDir := filepath.Join(tmp, app.AppName+".AppDir")
+	if err := os.Mkdir(appDir, 0755); err != nil {
+		return "", err
+	}
+	if err := app.stage(appDir); err != nil {
+		return "", err
+	}
+
+	entry, err := app.desktopEntry()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(appDir, app.Name+".desktop"), entry, 0644); err != nil {
+		return "", err
+	}
+	// appimagetool looks for the icon the desktop entry names, without its
+	// extension, at the top of the AppDir
+	icon := desktopIcon(entry, app.Name) + strings.ToLower(filepath.Ext(app.AppImageIcon))
+	if err := copyInstalled(app.AppImageIcon, filepath.Join(appDir, icon), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Symlink(icon, filepath.Join(appDir, ".DirIcon")); err != nil {
+		return "", err
+	}
+	appRun := fmt.Sprintf("#!/bin/sh\nHERE=\"$(dirname \"$(readlink -f \"$0\")\")\"\nexec \"$HERE/%s\" \"$@\"\n", app.appImageExec())
+	if err := os.WriteFile(filepath.Join(appDir, "AppRun"), []byte(appRun), 0755); err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, app.installerName("linux", ".AppImage"))
+	cmd := exec.Command(appimagetool, "--no-appstream", appDir, out)
+	cmd.Env = append(os.Environ(), "ARCH="+arch)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("appimagetool failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return out, nil
+}
+
+// desktopEntry returns the APPIMAGE_DESKTOP_FILE, or one generated from the
+// app's description
+func (a desktopApp) desktopEntry() ([]byte, error) {
+	if a.AppImageDesktopFile != "" {
+		return os.ReadFile(a.AppImageDesktopFile)
+	}
+	categories := a.AppImageCategories
+	if len(categories) == 0 {
+		categories = []string{"Utility"}
+	}
+	var s strings.Builder
+	s.WriteString("[Desktop Entry]\nType=Application\n")
+	fmt.Fprintf(&s, "Name=%s\n", a.AppName)
+	fmt.Fprintf(&s, "Exec=%s\n", path.Base(a.appImageExec()))
+	fmt.Fprintf(&s, "Icon=%s\n", a.Name)
+	if a.Description != a.AppName {
+		fmt.Fprintf(&s, "Comment=%s\n", a.Description)
+	}
+	fmt.Fprintf(&s, "Categories=%s;\n", strings.Join(categories, ";"))
+	fmt.Fprintf(&s, "Terminal=%t\n", a.AppImageTerminal)
+	return []byte(s.String()), nil
+}
+
+// desktopIcon returns the Icon of a desktop entry, or name if it has none
+func desktopIcon(entry []byte, name string) string {
+	for _, line := range strings.Split(string(entry), "\n") {
+		if icon, ok := strings.CutPrefix(strings.TrimSpace(line), "Icon="); ok && strings.TrimSpace(icon) != "" {
+			return strings.TrimSpace(icon)
+		}
+	}
+	return name
+}
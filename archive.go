@@ -0,0 +1,528 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Archive formats, which are also the archives' extensions
+const (
+	FormatZip    = "zip"
+	FormatTarGz  = "tar.gz"
+	FormatTarZst = "tar.zst"
+	FormatTarXz  = "tar.xz"
+	// FormatBinary and FormatGz release a Go target's binary as it is, or
+	// gzipped, rather than archived
+	FormatBinary = "binary"
+	FormatGz     = "gz"
+)
+
+// archiveFormats lists the supported FORMAT values
+var archiveFormats = []string{FormatZip, FormatTarGz, FormatTarZst, FormatTarXz, FormatBinary, FormatGz}
+
+// rawFormat reports whether a format releases a Go target's binary rather
+// than an archive
+func rawFormat(format string) bool {
+	return format == FormatBinary || format == FormatGz
+}
+
+// compressionLevels holds the lowest and highest compression level of each
+// format
+var compressionLevels = map[string][2]int{
+	FormatZip:    {1, 9},
+	FormatTarGz:  {1, 9},
+	FormatTarZst: {1, 19},
+	FormatTarXz:  {1, 9},
+	FormatGz:     {1, 9},
+}
+
+// LevelStore is the Level of archives that aren't compressed
+const LevelStore = -1
+
+// storeFormats are the formats that can be stored without compression
+var storeFormats = map[string]bool{FormatZip: true, FormatTarGz: true, FormatGz: true}
+
+// ArchiveOptions control how a build directory is archived
+type ArchiveOptions struct {
+	Format string
+	// Level is the compression level, 0 for the format's default and
+	// LevelStore for none
+	Level int
+	// Keep picks what of the build directory is archived, nil for all of it
+	Keep func(rel string, info os.FileInfo) bool
+	// Files holds globs of extra files, such as the LICENSE, archived under
+	// their path in the repository
+	Files []string
+	// Exclude holds globs of what isn't archived, see matchExclude
+	Exclude []string
+	// Wrap is a directory everything is archived in, empty for none
+	Wrap string
+}
+
+// ParseCompression parses a COMPRESSION level for an archive format: a
+// number, or store, fast, default or best. Uncompressed formats ignore it.
+func ParseCompression(key, format, value string) (int, error) {
+	levels, ok := compressionLevels[format]
+	if !ok {
+		return 0, nil
+	}
+	switch value {
+	case "", "default":
+		return 0, nil
+	case "fast":
+		return levels[0], nil
+	case "best":
+		return levels[1], nil
+	case "store":
+		if storeFormats[format] {
+			return LevelStore, nil
+		}
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil || level < levels[0] || level > levels[1] {
+		names := "fast, default, best"
+		if storeFormats[format] {
+			names = "store, " + names
+		}
+		return 0, fmt.Errorf("invalid %s %q (expected %s or %d to %d for %s)", key, value, names, levels[0], levels[1], format)
+	}
+	return level, nil
+}
+
+// gzipLevel returns the gzip compression level of a Level
+func gzipLevel(level int) int {
+	switch level {
+	case 0:
+		return gzip.DefaultCompression
+	case LevelStore:
+		return gzip.NoCompression
+	}
+	return level
+}
+
+// validFormat reports whether format is a supported archive format
+func validFormat(format string) bool {
+	for _, f := range archiveFormats {
+		if format == f {
+			return true
+		}
+	}
+	return false
+}
+
+// formatName returns how an archive format is called in progress messages
+func formatName(format string) string {
+	if format == FormatZip {
+		return "ZIP"
+	}
+	return format
+}
+
+// archiveEntry is a file or directory of a build directory to archive
+type archiveEntry struct {
+	// Path is where it is, Name its slash-separated path in the archive
+	Path string
+	Name string
+	Info os.FileInfo
+	// Link is the target of a symlink archived as a link, empty otherwise
+	Link string
+}
+
+// file returns the info of what an entry is archived as: its own, or that
+// of the file a symlink points to unless it's archived as a link
+func (e archiveEntry) file() (os.FileInfo, error) {
+	if e.Info.Mode()&os.ModeSymlink == 0 || e.Link != "" {
+		return e.Info, nil
+	}
+	return os.Stat(e.Path)
+}
+
+// mode returns the permissions of an archived file. WebAssembly modules
+// aren't executables, whatever the compiler made of them.
+func (e archiveEntry) mode(info os.FileInfo) os.FileMode {
+	mode := info.Mode().Perm()
+	if strings.HasSuffix(e.Name, ".wasm") {
+		mode &^= 0111
+	}
+	return mode
+}
+
+// archiveEntries walks a build directory for what opts.Keep picks of it, or
+// all of it if Keep is nil, and the extra files, sorted by name so that
+// archives don't depend on the order files are found in. Directories Keep
+// doesn't pick or Exclude matches are skipped, and so are .git and the
+// files GReleaser writes itself.
+func (g *GitHubReleaser) archiveEntries(buildPath string, opts ArchiveOptions) ([]archiveEntry, error) {
+	if _, err := os.Stat(buildPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("build directory %s not found", buildPath)
+	}
+
+	var entries []archiveEntry
+	err := filepath.Walk(buildPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Submodules have a .git file or directory that doesn't belong
+		// in artifacts
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(buildPath, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if (opts.Keep != nil && !opts.Keep(relPath, info)) || excluded(opts.Exclude, filepath.ToSlash(relPath)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if g.generated(path) {
+			return nil
+		}
+		entries = append(entries, archiveEntry{Path: path, Name: filepath.ToSlash(relPath), Info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := extraEntries(opts.Files, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	// What the build made wins over extra files of the same name
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name] = true
+	}
+	for _, e := range extra {
+		if !names[e.Name] {
+			entries = append(entries, e)
+			names[e.Name] = true
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	entries = linkEntries(entries, names)
+	if opts.Wrap == "" {
+		return entries, nil
+	}
+
+	// Links are relative, so they still point to the same entries
+	root, err := os.Stat(buildPath)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := []archiveEntry{{Path: buildPath, Name: opts.Wrap, Info: root}}
+	for _, e := range entries {
+		e.Name = opts.Wrap + "/" + e.Name
+		wrapped = append(wrapped, e)
+	}
+	return wrapped, nil
+}
+
+// linkEntries sets the Link of symlinks to other entries, which stay links
+// rather than copies of their target. Links out of the archive, or to what
+// isn't archived, are archived as the files they point to.
+func linkEntries(entries []archiveEntry, names map[string]bool) []archiveEntry {
+	for i, e := range entries {
+		if e.Info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := os.Readlink(e.Path)
+		if err != nil || filepath.IsAbs(target) {
+			continue
+		}
+		target = filepath.ToSlash(target)
+		if resolved := path.Join(path.Dir(e.Name), target); names[resolved] {
+			entries[i].Link = target
+		}
+	}
+	return entries
+}
+
+// extraEntries walks the extra files matching globs, archived under their
+// path in the repository, without what the exclude globs match. Every glob
+// must match something.
+func extraEntries(patterns, exclude []string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive file pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("archive file pattern %q matched no files", pattern)
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.Name() == ".git" {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				name := filepath.ToSlash(filepath.Clean(path))
+				if excluded(exclude, name) {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !seen[name] {
+					seen[name] = true
+					entries = append(entries, archiveEntry{Path: path, Name: name, Info: info})
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// excluded reports whether an exclude glob matches an archive entry's name
+func excluded(exclude []string, name string) bool {
+	for _, pattern := range exclude {
+		if matchExclude(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExclude reports whether an exclude glob matches a slash-separated
+// name. Globs without a slash, such as .DS_Store or *.map, match names at
+// any depth, and ** matches any number of directories, as in **/*.map or
+// node_modules/**.
+func matchExclude(pattern, name string) bool {
+	pattern = strings.TrimPrefix(path.Clean(pattern), "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches the segments of a name against those of a glob
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// CreateArchive creates an archive of a build directory
+func (g *GitHubReleaser) CreateArchive(buildPath, outputFile string, opts ArchiveOptions) error {
+	if opts.Format == FormatZip || opts.Format == "" {
+		return g.createZip(buildPath, outputFile, opts)
+	}
+	return g.createTar(buildPath, outputFile, opts)
+}
+
+// createTar creates a compressed tarball, which keeps the files' permissions
+func (g *GitHubReleaser) createTar(buildPath, outputFile string, opts ArchiveOptions) error {
+	entries, err := g.archiveEntries(buildPath, opts)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	compressed, err := g.compressor(out, opts)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(compressed)
+
+	for _, e := range entries {
+		if err := g.writeTarEntry(tw, e); err != nil {
+			compressed.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		compressed.Close()
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// compressor returns a writer compressing a tarball into out. gzip is
+// built in, zstd and xz are run as commands.
+func (g *GitHubReleaser) compressor(out io.Writer, opts ArchiveOptions) (io.WriteCloser, error) {
+	var args []string
+	switch opts.Format {
+	case FormatTarGz:
+		return gzip.NewWriterLevel(out, gzipLevel(opts.Level))
+	case FormatTarZst:
+		// zstd's output doesn't depend on the number of threads
+		args = []string{"zstd", "-q", "-c", "-T0"}
+	case FormatTarXz:
+		// xz's does, so reproducible archives use a single one
+		threads := "-T0"
+		if g.config.Reproducible {
+			threads = "-T1"
+		}
+		args = []string{"xz", "-q", "-c", threads}
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", opts.Format)
+	}
+	if opts.Level != 0 {
+		args = append(args, fmt.Sprintf("-%d", opts.Level))
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s archives need %s: %w", opts.Format, args[0], err)
+	}
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Stdout = out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandWriter{WriteCloser: stdin, cmd: cmd, stderr: &stderr}, nil
+}
+
+// WriteRawBinary copies a binary to dst as it is, or gzipped in the gz
+// format
+func WriteRawBinary(src, dst string, opts ArchiveOptions) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if opts.Format != FormatGz {
+		if _, err := io.Copy(out, in); err != nil {
+			return err
+		}
+		return out.Close()
+	}
+	gz, err := gzip.NewWriterLevel(out, gzipLevel(opts.Level))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// commandWriter writes to a command's stdin, and waits for it on Close
+type commandWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (w *commandWriter) Close() error {
+	w.WriteCloser.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", filepath.Base(w.cmd.Path), err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// writeTarEntry adds a file or directory to a tarball. The owner of the
+// build machine's files doesn't carry over to the users extracting them.
+func (g *GitHubReleaser) writeTarEntry(tw *tar.Writer, e archiveEntry) error {
+	info, err := e.file()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    e.Name,
+		Mode:    int64(e.mode(info)),
+		ModTime: info.ModTime(),
+		Format:  tar.FormatPAX,
+	}
+	switch {
+	case e.Link != "":
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = e.Link
+	case info.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+	default:
+		header.Typeflag = tar.TypeReg
+		header.Size = info.Size()
+	}
+	// Entries carry the source date rather than the time of the build
+	if !g.sourceDate.IsZero() {
+		header.ModTime = g.sourceDate
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	src, err := os.Open(e.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(tw, src)
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestMatchExclude(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		// Globs without a slash match at any depth
+		{".DS_Store", ".DS_Store", true},
+		{".DS_Store", "assets/img/.DS_Store", true},
+		{"*.map", "app.js.map", true},
+		{"*.map", "static/js/app.js.map", true},
+		{"*.map", "static/js/app.js", false},
+		// Globs with a slash match from the root
+		{"docs/*.md", "docs/README.md", true},
+		{"docs/*.md", "docs/api/README.md", false},
+		{"docs/*.md", "src/docs/README.md", false},
+		{"/docs/*.md", "docs/README.md", true},
+		// ** matches any number of directories
+		{"**", "a/b/c.txt", true},
+		{"**/*.map", "app.js.map", true},
+		{"**/*.map", "static/js/app.js.map", true},
+		{"**/*.map", "static/js/app.js", false},
+		{"node_modules/**", "node_modules/left-pad/index.js", true},
+		{"node_modules/**", "node_modules", true},
+		{"node_modules/**", "src/node_modules/x.js", false},
+		{"**/node_modules/**", "src/node_modules/x.js", true},
+		{"src/**/test/*.go", "src/test/a.go", true},
+		{"src/**/test/*.go", "src/a/b/test/a.go", true},
+		{"src/**/test/*.go", "src/a/b/test/c/a.go", false},
+		{"src/**/test/*.go", "lib/a/test/a.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchExclude(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchExclude(%q, %q) = %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
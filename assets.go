@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ValidateAssets checks the syntax of the ASSETS patterns
+func ValidateAssets(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ASSETS pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// CollectAssets returns the files matching the ASSETS patterns, in the
+// order of the patterns. Every pattern must match a file, and directories
+// can't be released.
+func CollectAssets(patterns []string) ([]string, error) {
+	var assets []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ASSETS pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("ASSETS pattern %q matched no files", pattern)
+		}
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				return nil, fmt.Errorf("ASSETS pattern %q matched the directory %s", pattern, path)
+			}
+			assets = append(assets, path)
+		}
+	}
+	return assets, nil
+}
+
+// CheckAssetNames fails if two artifacts would be uploaded under the same
+// name, which GitHub rejects halfway through the upload
+func CheckAssetNames(artifacts []Artifact) error {
+	paths := map[string]string{}
+	for _, a := range artifacts {
+		if other, ok := paths[a.Name]; ok && other != a.Path {
+			return fmt.Errorf("%s and %s would both be uploaded as %s", other, a.Path, a.Name)
+		}
+		paths[a.Name] = a.Path
+	}
+	return nil
+}
+
+// maxAssetSize is the size GitHub's release assets must stay under
+const maxAssetSize = 2 << 30
+
+// CheckAssetSizes fails if artifacts are too large for GitHub, which only
+// rejects them once they're uploaded
+func CheckAssetSizes(artifacts []Artifact) error {
+	var problems []string
+	for _, a := range artifacts {
+		info, err := os.Stat(filepath.FromSlash(a.Path))
+		if err != nil {
+			return err
+		}
+		if info.Size() >= maxAssetSize {
+			problems = append(problems, fmt.Sprintf("%s is %s", a.Path, formatBytes(info.Size())))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("GitHub release assets must be under 2 GiB, but %s\nUse a format that compresses better, such as tar.xz, or set SPLIT_SIZE to split the assets into parts",
+			strings.Join(problems, " and "))
+	}
+	return nil
+}
+
+// assetLabel is an ASSET_LABELS entry: a glob pattern of asset names and
+// the template of their label
+type assetLabel struct {
+	Pattern string
+	Label   *template.Template
+}
+
+// parseAssetLabels parses the pattern=label entries of ASSET_LABELS
+func parseAssetLabels(entries []string) ([]assetLabel, error) {
+	var labels []assetLabel
+	for _, entry := range entries {
+		pattern, text, ok := strings.Cut(entry, "=")
+		pattern, text = strings.TrimSpace(pattern), strings.TrimSpace(text)
+		if !ok || pattern == "" || text == "" {
+			return nil, fmt.Errorf("invalid ASSET_LABELS entry %q (expected pattern=label)", entry)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ASSET_LABELS pattern %q: %w", pattern, err)
+		}
+		tmpl, err := template.New("ASSET_LABELS").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ASSET_LABELS label %q: %w", text, err)
+		}
+		labels = append(labels, assetLabel{Pattern: pattern, Label: tmpl})
+	}
+	return labels, nil
+}
+
+// ValidateAssetLabels checks the ASSET_LABELS entries
+func ValidateAssetLabels(entries []string) error {
+	_, err := parseAssetLabels(entries)
+	return err
+}
+
+// LabelArtifacts sets the label of each artifact whose name matches an
+// ASSET_LABELS pattern, rendered with the artifact. The first matching
+// pattern wins.
+func LabelArtifacts(entries []string, artifacts []Artifact) error {
+	labels, err := parseAssetLabels(entries)
+	if err != nil {
+		return err
+	}
+	for i := range artifacts {
+		a := &artifacts[i]
+		for _, l := range labels {
+			if ok, _ := filepath.Match(l.Pattern, a.Name); !ok {
+				continue
+			}
+			var out bytes.Buffer
+			if err := l.Label.Execute(&out, a); err != nil {
+				return fmt.Errorf("invalid ASSET_LABELS label for %s: %w", a.Name, err)
+			}
+			a.Label = strings.TrimSpace(out.String())
+			break
+		}
+	}
+	return nil
+}
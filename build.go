@@ -0,0 +1,1162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Build is one build of a release: a command whose output directory is
+// archived, or a Go build matrix
+type Build struct {
+	// Name is empty for the default build
+	Name    string
+	Command string
+	// Script is a script file run instead of a command
+	Script string
+	// Tool builds with a toolchain's conventional command, see buildTools
+	Tool     string
+	ToolArgs []string
+	// Path is the output directory
+	Path      string
+	Targets   []string
+	Main      string
+	Binary    string
+	StampVars []string
+	// Goos and Goarch add every combination of them to the targets
+	Goos   []string
+	Goarch []string
+	// Ignore holds GOOS/GOARCH patterns of targets not to build
+	Ignore []string
+	// TargetEnv holds GOOS/GOARCH=KEY=VALUE variables for matching targets
+	TargetEnv []string
+	// Dir is the working directory of the build, the repository root by
+	// default
+	Dir string
+	// Env holds KEY=VALUE variables added to the build's environment
+	Env []string
+	// Image is a container image to build in instead of on the host
+	Image string
+	// Artifacts are glob patterns of prebuilt artifacts to release instead
+	// of building
+	Artifacts []string
+	// Cache gives the build a persistent cache directory
+	Cache bool
+	// Cgo enables cgo for Go builds, which CC, CXX and Zig imply
+	Cgo bool
+	// CC and CXX hold GOOS/GOARCH=compiler entries for cgo
+	CC  []string
+	CXX []string
+	// Zig cross-compiles cgo with zig cc
+	Zig bool
+	// Universal releases the darwin/amd64 and darwin/arm64 targets as one
+	// universal binary
+	Universal bool
+	// Go holds the go build flags of Go builds
+	Go GoFlags
+	// Timeout limits each attempt at a build job, 0 for no limit
+	Timeout time.Duration
+	// Retries is how many times a failed build job is retried
+	Retries int
+	// Secrets are the names of secrets passed to the build's commands
+	Secrets []string
+	// Format is the archive format, zip by default
+	Format string
+	// TargetFormat holds GOOS/GOARCH=format overrides of Format for
+	// matching targets
+	TargetFormat []string
+	// Compression holds the compression level of the archives, and
+	// format=level overrides for some formats. Empty is the format's
+	// default.
+	Compression []string
+	// Files holds globs of extra files added to the archives
+	Files []string
+	// Exclude holds globs of what is left out of the archives
+	Exclude []string
+	// Packages are the Linux package formats the linux targets of a Go
+	// build are released in as well
+	Packages []string
+	Package  PackageInfo
+	// Installers are the installer formats the desktop targets of a Go
+	// build are released in as well
+	Installers []string
+	Installer  InstallerInfo
+	// Wrap wraps the archive contents in a directory named by WrapTemplate,
+	// by default <project>-<version>
+	Wrap         bool
+	WrapTemplate string
+	// NameTemplate is a text/template of the assets' names, empty for the
+	// default names
+	NameTemplate string
+}
+
+// Key returns the config key of one of the build's fields
+func (b Build) Key(suffix string) string {
+	if b.Name == "" {
+		return "BUILD_" + suffix
+	}
+	return buildKey(b.Name) + suffix
+}
+
+// Validate checks that the build has something to build
+func (b Build) Validate() error {
+	targets, err := b.GoTargets()
+	if err != nil {
+		return err
+	}
+	if len(b.Goos) > 0 != (len(b.Goarch) > 0) {
+		return fmt.Errorf("%s and %s must be set together", b.Key("GOOS"), b.Key("GOARCH"))
+	}
+	if b.goMatrix() && len(targets) == 0 {
+		return fmt.Errorf("%s ignores every target of the build", b.Key("IGNORE"))
+	}
+	if err := b.validateTargetEnv(); err != nil {
+		return err
+	}
+	if _, err := ParseTargetCompilers(b.Key("CC"), b.CC); err != nil {
+		return err
+	}
+	if _, err := ParseTargetCompilers(b.Key("CXX"), b.CXX); err != nil {
+		return err
+	}
+	// Only one way to build can be chosen
+	var ways []string
+	for _, way := range []struct {
+		suffix string
+		set    bool
+	}{
+		{"COMMAND", b.Command != ""},
+		{"SCRIPT", b.Script != ""},
+		{"TOOL", b.Tool != ""},
+		{"TARGETS", b.goMatrix()},
+		{"ARTIFACTS", len(b.Artifacts) > 0},
+	} {
+		if way.set {
+			ways = append(ways, b.Key(way.suffix))
+		}
+	}
+	if len(ways) > 1 {
+		return fmt.Errorf("%s can't be combined", strings.Join(ways, ", "))
+	}
+	if _, ok := buildTools[b.Tool]; b.Tool != "" && !ok {
+		return fmt.Errorf("unknown %s %q (expected make, cargo, gradle or dotnet)", b.Key("TOOL"), b.Tool)
+	}
+	if b.Universal {
+		if !containsTarget(targets, darwinAMD64) || !containsTarget(targets, darwinARM64) {
+			return fmt.Errorf("%s needs %s and %s in %s", b.Key("UNIVERSAL"), darwinAMD64, darwinARM64, b.Key("TARGETS"))
+		}
+	}
+	for _, name := range b.Secrets {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("invalid %s name %q", b.Key("SECRETS"), name)
+		}
+	}
+	if b.Format != "" && !validFormat(b.Format) {
+		return fmt.Errorf("unknown %s %q (expected %s)", b.Key("FORMAT"), b.Format, strings.Join(archiveFormats, ", "))
+	}
+	if err := b.validateTargetFormat(); err != nil {
+		return err
+	}
+	if rawFormat(b.ArchiveFormat()) && !b.goMatrix() {
+		return fmt.Errorf("%s %s only applies to Go builds", b.Key("FORMAT"), b.Format)
+	}
+	if err := b.validateCompression(); err != nil {
+		return err
+	}
+	for _, pattern := range b.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", b.Key("FILES"), pattern, err)
+		}
+		if clean := filepath.ToSlash(filepath.Clean(pattern)); filepath.IsAbs(pattern) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("%s pattern %q must be inside the repository", b.Key("FILES"), pattern)
+		}
+	}
+	for _, pattern := range b.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", b.Key("EXCLUDE"), pattern, err)
+		}
+	}
+	if err := b.validatePackages(); err != nil {
+		return err
+	}
+	if err := b.validateInstallers(); err != nil {
+		return err
+	}
+	if err := b.validateNameTemplates(); err != nil {
+		return err
+	}
+	if b.Timeout < 0 {
+		return fmt.Errorf("%s can't be negative", b.Key("TIMEOUT"))
+	}
+	if b.Retries < 0 {
+		return fmt.Errorf("%s can't be negative", b.Key("RETRIES"))
+	}
+	if len(b.Artifacts) > 0 {
+		for _, pattern := range b.Artifacts {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid %s pattern %q: %w", b.Key("ARTIFACTS"), pattern, err)
+			}
+		}
+		return nil
+	}
+	if b.Script != "" {
+		if info, err := os.Stat(b.Script); err != nil || info.IsDir() {
+			return fmt.Errorf("%s %s is not a file", b.Key("SCRIPT"), b.Script)
+		}
+	}
+	if len(ways) == 0 {
+		if _, ok := DetectNodePackageManager(b.Dir); !ok {
+			return fmt.Errorf("%s, %s, %s, %s or %s is required (or a Node.js project with a lockfile)",
+				b.Key("COMMAND"), b.Key("SCRIPT"), b.Key("TOOL"), b.Key("TARGETS"), b.Key("ARTIFACTS"))
+		}
+	}
+	for _, entry := range b.Env {
+		if key, _, ok := strings.Cut(entry, "="); !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid %s entry %q (expected KEY=VALUE)", b.Key("ENV"), entry)
+		}
+	}
+	if b.Dir != "" {
+		if info, err := os.Stat(b.Dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s %s is not a directory", b.Key("DIR"), b.Dir)
+		}
+	}
+	return nil
+}
+
+// CgoToolchain returns the cgo toolchain of a Go build, or nil if cgo is disabled
+func (b Build) CgoToolchain() (*CgoToolchain, error) {
+	if !b.Cgo && !b.Zig && len(b.CC) == 0 && len(b.CXX) == 0 {
+		return nil, nil
+	}
+	cc, err := ParseTargetCompilers(b.Key("CC"), b.CC)
+	if err != nil {
+		return nil, err
+	}
+	cxx, err := ParseTargetCompilers(b.Key("CXX"), b.CXX)
+	if err != nil {
+		return nil, err
+	}
+	return &CgoToolchain{CC: cc, CXX: cxx, Zig: b.Zig, Prefix: b.Key("")}, nil
+}
+
+// Configured reports whether the build has anything to build or release
+func (b Build) Configured() bool {
+	return b.Command != "" || b.Script != "" || b.Tool != "" || b.goMatrix() || len(b.Artifacts) > 0
+}
+
+// ArchiveFormat returns the format of the build's archives
+func (b Build) ArchiveFormat() string {
+	if b.Format == "" {
+		return FormatZip
+	}
+	return b.Format
+}
+
+// ArchiveOptions returns how the build's output is archived, which
+// Validate has checked
+func (b Build) ArchiveOptions() ArchiveOptions {
+	level, _ := b.CompressionLevel(b.ArchiveFormat())
+	return ArchiveOptions{Format: b.ArchiveFormat(), Level: level, Keep: buildTools[b.Tool].Keep, Files: b.Files, Exclude: b.Exclude}
+}
+
+// CompressionLevel returns the compression level of the build's archives
+// in a format: that of the last COMPRESSION entry for it, whether a plain
+// level or format=level
+func (b Build) CompressionLevel(format string) (int, error) {
+	value := ""
+	for _, entry := range b.Compression {
+		f, level, ok := strings.Cut(entry, "=")
+		if !ok {
+			value = strings.TrimSpace(entry)
+		} else if strings.TrimSpace(f) == format {
+			value = strings.TrimSpace(level)
+		}
+	}
+	return ParseCompression(b.Key("COMPRESSION"), format, value)
+}
+
+// validateCompression checks the COMPRESSION entries of a build. The level
+// must suit every format the build's archives come in.
+func (b Build) validateCompression() error {
+	for _, entry := range b.Compression {
+		f, level, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if f = strings.TrimSpace(f); !validFormat(f) {
+			return fmt.Errorf("unknown format %q in %s (expected %s)", f, b.Key("COMPRESSION"), strings.Join(archiveFormats, ", "))
+		}
+		if _, err := ParseCompression(b.Key("COMPRESSION"), f, strings.TrimSpace(level)); err != nil {
+			return err
+		}
+	}
+	for _, format := range append(b.targetFormats(), b.ArchiveFormat()) {
+		if _, err := b.CompressionLevel(format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goMatrix reports whether the build is a Go build matrix
+func (b Build) goMatrix() bool {
+	return len(b.Targets) > 0 || len(b.Goos) > 0 || len(b.Goarch) > 0
+}
+
+// AllBuilds returns the default build, if configured, and the named builds
+func (c Config) AllBuilds() []Build {
+	var builds []Build
+	if c.Build.Configured() || len(c.Builds) == 0 {
+		builds = append(builds, c.Build)
+	}
+	return append(builds, c.Builds...)
+}
+
+// defaultStampVars is used when BUILD_STAMP_VARS isn't set
+var defaultStampVars = []string{
+	"version=main.version",
+	"commit=main.commit",
+	"date=main.date",
+}
+
+// BuildInfo describes the release being built
+type BuildInfo struct {
+	// Version is the version without tag prefix or "v"
+	Version string
+	Tag     string
+	Commit  string
+	// Date is the build time in RFC 3339 format
+	Date string
+	// SourceDateEpoch is set for reproducible builds, see
+	// https://reproducible-builds.org/docs/source-date-epoch/
+	SourceDateEpoch int64
+}
+
+// Env returns the build info as RELEASE_* environment variables, and
+// SOURCE_DATE_EPOCH for reproducible builds
+func (i BuildInfo) Env() []string {
+	env := []string{
+		"RELEASE_VERSION=" + i.Version,
+		"RELEASE_TAG=" + i.Tag,
+		"RELEASE_COMMIT=" + i.Commit,
+		"RELEASE_DATE=" + i.Date,
+	}
+	if i.SourceDateEpoch != 0 {
+		env = append(env, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", i.SourceDateEpoch))
+	}
+	return env
+}
+
+// SourceDateEpoch returns the SOURCE_DATE_EPOCH of a release: the variable
+// if it's set, or else the commit's timestamp
+func SourceDateEpoch(commit string) (int64, error) {
+	if value := os.Getenv("SOURCE_DATE_EPOCH"); value != "" {
+		epoch, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", value)
+		}
+		return epoch, nil
+	}
+	out, err := gitOutput("log", "-1", "--format=%ct", commit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the commit date: %w", err)
+	}
+	return strconv.ParseInt(out, 10, 64)
+}
+
+// Ldflags returns -X flags setting Go variables to the build info, per
+// BUILD_STAMP_VARS entries of the form field=importpath.name, where the
+// field is version, tag, commit or date
+func (i BuildInfo) Ldflags(vars []string) (string, error) {
+	if len(vars) == 0 {
+		vars = defaultStampVars
+	}
+
+	var flags []string
+	for _, entry := range vars {
+		field, name, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return "", fmt.Errorf("invalid BUILD_STAMP_VARS entry %q (expected field=importpath.name)", entry)
+		}
+		var value string
+		switch strings.TrimSpace(field) {
+		case "version":
+			value = i.Version
+		case "tag":
+			value = i.Tag
+		case "commit":
+			value = i.Commit
+		case "date":
+			value = i.Date
+		default:
+			return "", fmt.Errorf("invalid BUILD_STAMP_VARS entry %q (expected version, tag, commit or date)", entry)
+		}
+		flags = append(flags, fmt.Sprintf("-X %s=%s", name, value))
+	}
+	return strings.Join(flags, " "), nil
+}
+
+// GoTarget is a platform of the Go build matrix
+type GoTarget struct {
+	OS   string
+	Arch string
+}
+
+// String returns the target as GOOS/GOARCH
+func (t GoTarget) String() string {
+	return t.OS + "/" + t.Arch
+}
+
+// ParseGoTargets parses the entries of a BUILD_TARGETS key, of the form
+// GOOS/GOARCH
+func ParseGoTargets(key string, entries []string) ([]GoTarget, error) {
+	var targets []GoTarget
+	for _, entry := range entries {
+		goos, goarch, ok := strings.Cut(strings.TrimSpace(entry), "/")
+		if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+			return nil, fmt.Errorf("invalid %s entry %q (expected GOOS/GOARCH)", key, entry)
+		}
+		targets = append(targets, GoTarget{OS: goos, Arch: goarch})
+	}
+	return targets, nil
+}
+
+// containsTarget reports whether t is one of targets
+func containsTarget(targets []GoTarget, t GoTarget) bool {
+	for _, target := range targets {
+		if target == t {
+			return true
+		}
+	}
+	return false
+}
+
+// GoFlags are options of go build
+type GoFlags struct {
+	// Flags are passed to go build as they are
+	Flags    []string
+	Tags     []string
+	Asmflags string
+	Gcflags  string
+	// Ldflags are added to the flags stamping the build info
+	Ldflags  string
+	Trimpath bool
+}
+
+// Args returns the go build arguments for the flags, with ldflags for the
+// build info
+func (f GoFlags) Args(ldflags string) []string {
+	args := append([]string{}, f.Flags...)
+	if f.Trimpath {
+		args = append(args, "-trimpath")
+	}
+	if len(f.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(f.Tags, ","))
+	}
+	if f.Asmflags != "" {
+		args = append(args, "-asmflags", f.Asmflags)
+	}
+	if f.Gcflags != "" {
+		args = append(args, "-gcflags", f.Gcflags)
+	}
+	if f.Ldflags != "" {
+		ldflags = strings.TrimSpace(ldflags + " " + f.Ldflags)
+	}
+	return append(args, "-ldflags", ldflags)
+}
+
+// GoBuild cross-compiles a Go main package for a matrix of platforms
+type GoBuild struct {
+	// Main is the package to build, "." by default
+	Main string
+	// Binary is the name of the executable, without .exe or .wasm
+	Binary  string
+	Targets []GoTarget
+	// OutDir receives a <binary>_<os>_<arch> directory per target
+	OutDir string
+	Info   BuildInfo
+	// StampVars are the BUILD_STAMP_VARS the build info is written to
+	StampVars []string
+	// Runner runs go build in the build's directory, which Main is
+	// relative to
+	Runner buildRunner
+	// Cgo is the cgo toolchain, nil to build with CGO_ENABLED=0
+	Cgo   *CgoToolchain
+	Flags GoFlags
+	// TargetEnv returns the variables added for a target, which override
+	// the ones set by the build; nil for none
+	TargetEnv func(t GoTarget) []string
+	// Format returns the format of a target's archive
+	Format func(t GoTarget) string
+	// Names holds the asset names rendered from the NAME_TEMPLATE, nil
+	// for the default names
+	Names map[GoTarget]string
+}
+
+// Dir returns the directory a target's binary is built into
+func (b GoBuild) Dir(t GoTarget) string {
+	return filepath.Join(b.OutDir, fmt.Sprintf("%s_%s_%s", b.Binary, t.OS, t.Arch))
+}
+
+// Build compiles the binary for one target, writing the compiler's output
+// to out. The compiler is killed when ctx is done.
+func (b GoBuild) Build(ctx context.Context, t GoTarget, out io.Writer) error {
+	binary := b.BinaryName(t)
+	main := b.Main
+	if main == "" {
+		main = "."
+	}
+
+	ldflags, err := b.Info.Ldflags(b.StampVars)
+	if err != nil {
+		return err
+	}
+
+	// The output directory is relative to the repository root
+	output, err := filepath.Abs(filepath.Join(b.Dir(t), binary))
+	if err != nil {
+		return err
+	}
+
+	// Cross-compiling with cgo needs a C toolchain for the target
+	env := []string{"GOOS=" + t.OS, "GOARCH=" + t.Arch, "CGO_ENABLED=0"}
+	if b.Cgo != nil && !isWasm(t) {
+		cgoEnv, err := b.Cgo.Env(t)
+		if err != nil {
+			return err
+		}
+		env = append(env[:2], cgoEnv...)
+	}
+	if b.TargetEnv != nil {
+		env = append(env, b.TargetEnv(t)...)
+	}
+	args := append([]string{"build"}, b.Flags.Args(ldflags)...)
+	cmd, err := b.Runner.Command(ctx, env, "go", append(args, "-o", output, main)...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build for %s failed: %w", t, err)
+	}
+	// Browsers can't load the module without it, but it isn't worth
+	// failing the release over
+	if t == jsWasm {
+		if err := b.copyWasmExec(ctx); err != nil {
+			fmt.Fprintf(out, "Warning: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// Archive returns the archive a target is packaged into in the output
+// directory, named by the NAME_TEMPLATE or else
+// <binary>_<version>_<os>_<arch>.<format>. In the raw formats it's the
+// binary itself, in the target's directory, by default named
+// <binary>_<os>_<arch> with its extension, and .gz if gzipped.
+func (b GoBuild) Archive(t GoTarget) string {
+	format := b.Format(t)
+	dir, name := b.OutDir, fmt.Sprintf("%s_%s_%s_%s%s", b.Binary, b.Info.Version, t.OS, t.Arch, b.ext(t, format))
+	if rawFormat(format) {
+		dir, name = b.Dir(t), fmt.Sprintf("%s_%s_%s%s", b.Binary, t.OS, t.Arch, b.ext(t, format))
+	}
+	if templated, ok := b.Names[t]; ok {
+		name = templated
+	}
+	return filepath.Join(dir, name)
+}
+
+// artifactType returns the manifest type of a target's artifact
+func (b GoBuild) artifactType(t GoTarget) string {
+	if rawFormat(b.Format(t)) {
+		return ArtifactBinary
+	}
+	return ArtifactArchive
+}
+
+// buildJob is a unit of a release's builds that can run independently of
+// the others: one target of a Go build, or a build command
+type buildJob struct {
+	// Label names the job in prefixed log lines
+	Label string
+	// Title is shown when the job starts
+	Title string
+	// Run builds and archives, returning the artifacts. Its commands are
+	// killed when ctx is done.
+	Run func(ctx context.Context, log buildLog) ([]string, error)
+	// Timeout limits each attempt, 0 for no limit
+	Timeout time.Duration
+	// Retries is how many times the job is run again after failing
+	Retries int
+	// Type, Platform and Build describe the job's artifacts
+	Type     string
+	Platform string
+	Build    string
+}
+
+// artifacts describes the paths a job returned
+func (j buildJob) artifacts(paths []string) []Artifact {
+	var artifacts []Artifact
+	for _, path := range paths {
+		a := newArtifact(path, j.Type)
+		// Go targets are also released as packages and installers
+		if isPackage(path) {
+			a.Type = ArtifactPackage
+		}
+		if isInstaller(path) {
+			a.Type = ArtifactInstaller
+		}
+		if isSBOM(path) {
+			a.Type = ArtifactSBOM
+		}
+		a.Platform, a.Build = j.Platform, j.Build
+		artifacts = append(artifacts, a)
+	}
+	return artifacts
+}
+
+// retryDelay is the wait before the first retry of a failed job, doubled
+// for each further one
+const retryDelay = 2 * time.Second
+
+// run runs the job, giving up on attempts that exceed its timeout and
+// retrying failed ones with exponential backoff
+func (j buildJob) run(log buildLog) ([]string, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if j.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		}
+		artifacts, err := j.Run(ctx, log)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%s timed out after %s", j.Label, j.Timeout)
+		}
+		cancel()
+		if err == nil || attempt >= j.Retries {
+			return artifacts, err
+		}
+		fmt.Fprintf(log.Output(), "Attempt %d of %d failed: %v\n", attempt+1, j.Retries+1, err)
+		log.Step("Retrying in %s", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// buildLog is where a build job reports progress. With a prefix, steps and
+// command output become log lines tagged with it, so jobs running in
+// parallel can be told apart. Everything is also written to the build log
+// file, if there is one.
+type buildLog struct {
+	prefix string
+	out    *prefixWriter
+	file   *logFile
+}
+
+// newBuildLog returns a log for a job, prefixed unless prefix is empty.
+// file may be nil, and so may mask, which replaces secrets in the output.
+func newBuildLog(prefix string, file *logFile, mask *strings.Replacer) buildLog {
+	if prefix == "" && mask == nil {
+		return buildLog{file: file}
+	}
+	return buildLog{prefix: prefix, out: &prefixWriter{prefix: prefix, file: file, mask: mask}, file: file}
+}
+
+// Step starts a step of the job
+func (l buildLog) Step(format string, args ...interface{}) {
+	title := fmt.Sprintf(format, args...)
+	if l.prefix == "" {
+		l.file.Printf("==> %s\n", title)
+		ui.Step("%s", title)
+		return
+	}
+	l.file.Printf("[%s] ==> %s\n", l.prefix, title)
+	ui.Printf("[%s] %s...\n", l.prefix, title)
+}
+
+// Output returns a writer for the job's command output
+func (l buildLog) Output() io.Writer {
+	if l.out != nil {
+		return l.out
+	}
+	if l.file != nil {
+		return io.MultiWriter(ui.Output(), l.file)
+	}
+	return ui.Output()
+}
+
+// Flush prints output left without a trailing newline
+func (l buildLog) Flush() {
+	if l.out != nil && l.out.partial != "" {
+		l.out.Write([]byte("\n"))
+	}
+}
+
+// prefixWriter prints command output line by line, tagged with a prefix
+// unless it's empty, and with secrets masked
+type prefixWriter struct {
+	prefix  string
+	partial string
+	file    *logFile
+	// mask replaces secrets, nil if there are none
+	mask *strings.Replacer
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	lines := strings.Split(w.partial+string(p), "\n")
+	w.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		line = strings.TrimRight(line, "\r")
+		if w.mask != nil {
+			line = w.mask.Replace(line)
+		}
+		if w.prefix == "" {
+			w.file.Printf("%s\n", line)
+			ui.Printf("%s\n", line)
+			continue
+		}
+		w.file.Printf("[%s] %s\n", w.prefix, line)
+		ui.Printf("[%s] %s\n", w.prefix, line)
+	}
+	return len(p), nil
+}
+
+// logFile is a build log file that jobs running in parallel write to. A
+// nil logFile discards what is written.
+type logFile struct {
+	mu   sync.Mutex
+	f    *os.File
+	Path string
+}
+
+// createLogFile creates a timestamped log in dir, such as
+// build-20240501T120000Z.log for the name build
+func createLogFile(dir, name string) (*logFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.log", name, time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{f: f, Path: path}, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	if l == nil {
+		return len(p), nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// Printf writes a line to the log
+func (l *logFile) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(l, format, args...)
+}
+
+// Close closes the log file
+func (l *logFile) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// RunBuilds runs the release's builds and returns the artifacts to upload,
+// in the order of the builds and their targets. With BUILD_LOG, their
+// output is also written to a log file, which is released too with
+// BUILD_LOG_UPLOAD, and reported to CI if the build fails.
+func (g *GitHubReleaser) RunBuilds(builds []Build, info BuildInfo) ([]Artifact, error) {
+	var file *logFile
+	if g.config.BuildLog {
+		dir := g.config.BuildLogDir
+		if dir == "" {
+			dir = "dist"
+		}
+		var err error
+		if file, err = createLogFile(dir, "build"); err != nil {
+			return nil, fmt.Errorf("failed to create build log: %w", err)
+		}
+		g.buildLog = file.Path
+	}
+
+	secrets, err := LoadSecretsFile(g.config.SecretsFile)
+	if err != nil {
+		return nil, err
+	}
+	g.secrets = secrets
+
+	artifacts, err := g.runBuilds(builds, info, file)
+	if err == nil {
+		g.pruneCache(builds)
+	}
+	if file == nil {
+		return artifacts, err
+	}
+	if err != nil {
+		file.Printf("Build failed: %v\n", err)
+	}
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		ui.Printf("Build log written to %s\n", file.Path)
+		// A later workflow step can upload it with if: failure()
+		if err := SetCIOutput("build-log", file.Path); err != nil {
+			ui.Printf("Warning: %v\n", err)
+		}
+		return nil, err
+	}
+	if g.config.BuildLogUpload {
+		artifacts = append(artifacts, newArtifact(file.Path, ArtifactLog))
+	}
+	return artifacts, nil
+}
+
+// runBuilds runs the builds' jobs. Up to BUILD_PARALLELISM jobs run at
+// once; after the first failure no new jobs are started.
+func (g *GitHubReleaser) runBuilds(builds []Build, info BuildInfo, file *logFile) ([]Artifact, error) {
+	mask, err := g.secretMask(builds)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []buildJob
+	for _, b := range builds {
+		bj, err := g.buildJobs(b, info)
+		if err != nil {
+			return nil, err
+		}
+		for i := range bj {
+			bj[i].Timeout, bj[i].Retries = b.Timeout, b.Retries
+			bj[i].Build = b.Name
+		}
+		jobs = append(jobs, bj...)
+	}
+
+	workers := g.config.BuildParallelism
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	if workers <= 1 {
+		var artifacts []Artifact
+		for _, job := range jobs {
+			log := newBuildLog("", file, mask)
+			log.Step("%s", job.Title)
+			built, err := job.run(log)
+			log.Flush()
+			if err != nil {
+				return nil, err
+			}
+			artifacts = append(artifacts, job.artifacts(built)...)
+		}
+		return artifacts, nil
+	}
+
+	ui.Step("Running %d builds with %d workers", len(jobs), workers)
+	results := make([][]string, len(jobs))
+	errs := make([]error, len(jobs))
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if failed.Load() {
+					continue
+				}
+				log := newBuildLog(jobs[i].Label, file, mask)
+				log.Step("%s", jobs[i].Title)
+				results[i], errs[i] = jobs[i].run(log)
+				log.Flush()
+				if errs[i] != nil {
+					failed.Store(true)
+					ui.Printf("[%s] %v\n", jobs[i].Label, errs[i])
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var artifacts []Artifact
+	for i := range jobs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		artifacts = append(artifacts, jobs[i].artifacts(results[i])...)
+	}
+	return artifacts, nil
+}
+
+// buildJobs splits a build into jobs: one per target for Go builds, and a
+// single one for a build command
+func (g *GitHubReleaser) buildJobs(b Build, info BuildInfo) ([]buildJob, error) {
+	// Errors name the build they come from, unless it's the only one
+	wrap := func(err error) error {
+		if err != nil && b.Name != "" {
+			err = fmt.Errorf("build %s: %w", b.Name, err)
+		}
+		return err
+	}
+
+	if len(b.Artifacts) > 0 {
+		label := b.Name
+		if label == "" {
+			label = "build"
+		}
+		return []buildJob{{
+			Label: label,
+			Title: fmt.Sprintf("Collecting %s artifacts", label),
+			Type:  ArtifactPrebuilt,
+			Run: func(ctx context.Context, log buildLog) ([]string, error) {
+				artifacts, err := g.collectArtifacts(b, info, log)
+				if err != nil {
+					return nil, wrap(err)
+				}
+				sboms, err := g.WriteSyftSBOMs("", artifacts, log)
+				if err != nil {
+					return nil, wrap(err)
+				}
+				return append(artifacts, sboms...), nil
+			},
+		}}, nil
+	}
+
+	targets, err := b.GoTargets()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if len(targets) > 0 {
+		binary := b.Binary
+		if binary == "" {
+			binary = filepath.Base(filepath.Clean(b.Main))
+		}
+		if binary == "." || binary == "/" {
+			binary = b.Name
+		}
+		if binary == "" {
+			binary = g.repoName
+		}
+		runner, err := g.runner(b, info)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		cgo, err := b.CgoToolchain()
+		if err != nil {
+			return nil, wrap(err)
+		}
+		// Paths of the build machine would make binaries differ
+		flags := b.Go
+		if g.config.Reproducible {
+			flags.Trimpath = true
+		}
+		gb := GoBuild{
+			Main:      b.Main,
+			Binary:    binary,
+			Targets:   targets,
+			OutDir:    b.Path,
+			Info:      info,
+			StampVars: b.StampVars,
+			Runner:    runner,
+			Cgo:       cgo,
+			Flags:     flags,
+			TargetEnv: b.targetEnv,
+			Format:    b.TargetArchiveFormat,
+		}
+		if gb.Names, err = b.targetNames(gb, g.repoName); err != nil {
+			return nil, wrap(err)
+		}
+
+		var jobs []buildJob
+		for _, t := range targets {
+			t := t
+			// Both halves of the universal binary are built by its job
+			if b.Universal && (t == darwinAMD64 || t == darwinARM64) {
+				continue
+			}
+			jobs = append(jobs, buildJob{
+				Label:    fmt.Sprintf("%s %s", binary, t),
+				Title:    fmt.Sprintf("Building %s %s", binary, t),
+				Type:     gb.artifactType(t),
+				Platform: t.String(),
+				Run: func(ctx context.Context, log buildLog) ([]string, error) {
+					if err := gb.Build(ctx, t, log.Output()); err != nil {
+						return nil, wrap(err)
+					}
+					opts, err := b.wrapOptions(b.TargetArchiveOptions(t), b.targetData(gb, g.repoName, t))
+					if err != nil {
+						return nil, wrap(err)
+					}
+					if err := g.packageTarget(gb, t, opts, log); err != nil {
+						return nil, wrap(err)
+					}
+					packages, err := g.BuildPackages(b, gb, t, log)
+					if err != nil {
+						return nil, wrap(err)
+					}
+					installers, err := g.BuildInstallers(b, gb, t, opts, log)
+					if err != nil {
+						return nil, wrap(err)
+					}
+					paths := append(append([]string{gb.Archive(t)}, packages...), installers...)
+					sboms, err := g.WriteGoSBOMs(filepath.Join(gb.Dir(t), gb.BinaryName(t)), gb.Info.Version, paths, log)
+					if err != nil {
+						return nil, wrap(err)
+					}
+					return append(paths, sboms...), nil
+				},
+			})
+		}
+		if b.Universal {
+			t := darwinUniversal
+			jobs = append(jobs, buildJob{
+				Label:    fmt.Sprintf("%s %s", binary, t),
+				Title:    fmt.Sprintf("Building %s %s", binary, t),
+				Type:     gb.artifactType(t),
+				Platform: t.String(),
+				Run: func(ctx context.Context, log buildLog) ([]string, error) {
+					for _, arch := range []GoTarget{darwinAMD64, darwinARM64} {
+						if err := gb.Build(ctx, arch, log.Output()); err != nil {
+							return nil, wrap(err)
+						}
+					}
+					log.Step("Creating universal binary with lipo")
+					if err := gb.Universal(ctx, log.Output()); err != nil {
+						return nil, wrap(err)
+					}
+					opts, err := b.wrapOptions(b.TargetArchiveOptions(t), b.targetData(gb, g.repoName, t))
+					if err != nil {
+						return nil, wrap(err)
+					}
+					if err := g.packageTarget(gb, t, opts, log); err != nil {
+						return nil, wrap(err)
+					}
+					installers, err := g.BuildInstallers(b, gb, t, opts, log)
+					if err != nil {
+						return nil, wrap(err)
+					}
+					paths := append([]string{gb.Archive(t)}, installers...)
+					// Both halves hold the same modules, and are easier to
+					// read than the universal binary
+					sboms, err := g.WriteGoSBOMs(filepath.Join(gb.Dir(darwinARM64), gb.BinaryName(darwinARM64)), gb.Info.Version, paths, log)
+					if err != nil {
+						return nil, wrap(err)
+					}
+					return append(paths, sboms...), nil
+				},
+			})
+		}
+		return jobs, nil
+	}
+
+	opts, err := b.wrapOptions(b.ArchiveOptions(), b.commandData(g.repoName, info, b.ArchiveFormat()))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	format := opts.Format
+	archive, err := b.commandArchiveName(g.repoName, info, format)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	label, title := "build", "Building project"
+	if b.Name != "" {
+		label, title = b.Name, "Building "+b.Name
+	}
+	cleanups = append(cleanups, func() {
+		os.Remove(archive)
+		for _, format := range g.config.SBOM {
+			os.Remove(archive + sbomSuffixes[format])
+		}
+	})
+	return []buildJob{{
+		Label: label,
+		Title: title,
+		Type:  ArtifactArchive,
+		Run: func(ctx context.Context, log buildLog) ([]string, error) {
+			if err := g.RunBuild(ctx, b, info, log); err != nil {
+				return nil, wrap(err)
+			}
+			log.Step("Creating %s archive from %s", formatName(format), b.OutputPath())
+			if err := g.CreateArchive(b.OutputPath(), archive, opts); err != nil {
+				return nil, wrap(fmt.Errorf("failed to create %s: %w", formatName(format), err))
+			}
+			sboms, err := g.WriteSyftSBOMs(b.OutputPath(), []string{archive}, log)
+			if err != nil {
+				return nil, wrap(err)
+			}
+			return append([]string{archive}, sboms...), nil
+		},
+	}}, nil
+}
+
+// packageTarget archives the directory of a Go target, or in the raw
+// formats writes its binary
+func (g *GitHubReleaser) packageTarget(gb GoBuild, t GoTarget, opts ArchiveOptions, log buildLog) error {
+	if rawFormat(opts.Format) {
+		log.Step("Writing %s", gb.Archive(t))
+		return WriteRawBinary(filepath.Join(gb.Dir(t), gb.BinaryName(t)), gb.Archive(t), opts)
+	}
+	log.Step("Creating %s archive from %s", formatName(opts.Format), gb.Dir(t))
+	return g.CreateArchive(gb.Dir(t), gb.Archive(t), opts)
+}
+
+// collectArtifacts returns the prebuilt artifacts matching a build's
+// ARTIFACTS patterns. Files are released as they are, and directories are
+// archived next to them. Every pattern must match something.
+func (g *GitHubReleaser) collectArtifacts(b Build, info BuildInfo, log buildLog) ([]string, error) {
+	opts, err := b.wrapOptions(b.ArchiveOptions(), b.commandData(g.repoName, info, b.ArchiveFormat()))
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []string
+	seen := map[string]bool{}
+	for _, pattern := range b.Artifacts {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", b.Key("ARTIFACTS"), pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s pattern %q matched no files", b.Key("ARTIFACTS"), pattern)
+		}
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				artifacts = append(artifacts, path)
+				continue
+			}
+			archive := filepath.Clean(path) + "." + opts.Format
+			log.Step("Creating %s archive from %s", formatName(opts.Format), path)
+			if err := g.CreateArchive(path, archive, opts); err != nil {
+				return nil, fmt.Errorf("failed to create %s: %w", formatName(opts.Format), err)
+			}
+			artifacts = append(artifacts, archive)
+		}
+	}
+	return artifacts, nil
+}
@@ -12,7 +12,7 @@ build_platform() {
     fi
 
     echo "Building for ${OS}/${ARCH}..."
-    GOOS=$OS GOARCH=$ARCH go build -ldflags="-s -w" -o $OUTPUT
+    GOOS=$OS GOARCH=$ARCH go build -ldflags="-s -w -X main.appVersion=${VERSION}" -o $OUTPUT
     
     # Print binary size
     if [ -f "$OUTPUT" ]; then
@@ -29,6 +29,9 @@ build_platform() {
     fi
 }
 
+# Version stamped into the binaries, used by self-update
+VERSION=${VERSION:-$(git describe --tags --always 2>/dev/null || echo dev)}
+
 # Create bin directory
 mkdir -p bin
 
@@ -37,3 +40,6 @@ build_platform "linux" "amd64"
 build_platform "darwin" "amd64"
 build_platform "darwin" "arm64"
 build_platform "windows" "amd64"
+
+# Checksums for self-update verification
+(cd bin && sha256sum greleaser-* > SHA256SUMS)
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultVersionCommitMessage is used when VERSION_COMMIT_MESSAGE isn't set
+const defaultVersionCommitMessage = "chore(release): {{ .Version }}"
+
+// VersionFile is a file whose version string is updated on release.
+// Rule is a JSON path like $.version, a regular expression whose first
+// capture group (or whole match) holds the version, or empty to replace
+// the whole file.
+type VersionFile struct {
+	Path string
+	Rule string
+}
+
+// ParseVersionFiles parses VERSION_FILES entries of the form path[:rule].
+// Without a rule, one is chosen from the file name.
+func ParseVersionFiles(entries []string) []VersionFile {
+	var files []VersionFile
+	for _, entry := range entries {
+		path, rule, ok := strings.Cut(entry, ":")
+		if !ok {
+			rule = defaultVersionRule(path)
+		}
+		files = append(files, VersionFile{Path: path, Rule: rule})
+	}
+	return files
+}
+
+// defaultVersionRule picks the rule for well-known version files
+func defaultVersionRule(path string) string {
+	switch name := filepath.Base(path); {
+	case strings.HasSuffix(name, ".json"):
+		return "$.version"
+	case strings.HasSuffix(name, ".go"):
+		return `(?m)^\s*(?:const|var)?\s*[Vv]ersion\s*=\s*"([^"]*)"`
+	case strings.HasSuffix(name, ".toml"):
+		return `(?m)^version\s*=\s*"([^"]*)"`
+	}
+	return ""
+}
+
+// Bump writes version into the file according to its rule
+func (f VersionFile) Bump(version string) error {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+
+	var start, end int
+	replacement := []byte(version)
+	switch {
+	case f.Rule == "":
+		start, end = 0, len(data)
+		replacement = append(replacement, '\n')
+	case strings.HasPrefix(f.Rule, "$."):
+		if start, end, err = jsonValueSpan(data, strings.Split(f.Rule[2:], ".")); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+		replacement, _ = json.Marshal(version)
+	default:
+		re, err := regexp.Compile(f.Rule)
+		if err != nil {
+			return fmt.Errorf("%s: invalid rule: %w", f.Path, err)
+		}
+		loc := re.FindSubmatchIndex(data)
+		if loc == nil {
+			return fmt.Errorf("%s: no match for %s", f.Path, f.Rule)
+		}
+		start, end = loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+	}
+
+	updated := append(append(append([]byte{}, data[:start]...), replacement...), data[end:]...)
+	if bytes.Equal(updated, data) {
+		return nil
+	}
+
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path, updated, info.Mode())
+}
+
+// jsonValueSpan finds the byte range of the string value at a path of
+// object keys, so it can be replaced without reformatting the document
+func jsonValueSpan(data []byte, path []string) (int, int, error) {
+	type frame struct {
+		object  bool
+		key     string
+		wantKey bool
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var stack []frame
+
+	atPath := func() bool {
+		if len(stack) != len(path) {
+			return false
+		}
+		for i, f := range stack {
+			if !f.object || f.key != path[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].wantKey {
+			if key, ok := tok.(string); ok {
+				stack[n-1].key = key
+				stack[n-1].wantKey = false
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, frame{object: true, wantKey: true})
+			continue
+		case json.Delim('['):
+			stack = append(stack, frame{})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		default:
+			if atPath() {
+				if _, ok := tok.(string); !ok {
+					return 0, 0, fmt.Errorf("value at $.%s is not a string", strings.Join(path, "."))
+				}
+				// The raw token includes the separator before the value
+				end := int(dec.InputOffset())
+				start := int(before) + bytes.IndexByte(data[before:end], '"')
+				return start, end, nil
+			}
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].wantKey = true
+		}
+	}
+
+	return 0, 0, fmt.Errorf("no value at $.%s", strings.Join(path, "."))
+}
+
+// BumpVersionFiles updates the version in every file and returns their paths
+func BumpVersionFiles(files []VersionFile, version string) ([]string, error) {
+	var paths []string
+	for _, f := range files {
+		if err := f.Bump(version); err != nil {
+			return nil, err
+		}
+		paths = append(paths, f.Path)
+	}
+	return paths, nil
+}
+
+// CommitRelease commits the files updated for a release with a message
+// rendered from the template (with .Version available)
+func CommitRelease(paths []string, version, messageTemplate string) error {
+	if messageTemplate == "" {
+		messageTemplate = defaultVersionCommitMessage
+	}
+	tmpl, err := template.New("message").Parse(messageTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid VERSION_COMMIT_MESSAGE: %w", err)
+	}
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, struct{ Version string }{version}); err != nil {
+		return fmt.Errorf("invalid VERSION_COMMIT_MESSAGE: %w", err)
+	}
+
+	if err := exec.Command("git", append([]string{"add", "--"}, paths...)...).Run(); err != nil {
+		return fmt.Errorf("failed to stage release files: %w", err)
+	}
+	// Nothing to commit if the files were already up to date
+	if exec.Command("git", "diff", "--cached", "--quiet").Run() == nil {
+		return nil
+	}
+
+	cmd := exec.Command("git", "commit", "--quiet", "--file=-")
+	cmd.Stdin = &message
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	return cmd.Run()
+}
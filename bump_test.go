@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONValueSpan(t *testing.T) {
+	tests := []struct {
+		data string
+		path string
+		want string
+	}{
+		{`{"version": "1.0.0"}`, "version", `"1.0.0"`},
+		{`{"version":"1.0.0","name":"app"}`, "name", `"app"`},
+		{`{"name": "version", "version": "2.0.0"}`, "version", `"2.0.0"`},
+		{`{"a": {"version": "1"}, "version": "2"}`, "version", `"2"`},
+		{`{"a": {"version": "1"}, "version": "2"}`, "a.version", `"1"`},
+		{`{"list": [{"version": "1"}], "version": "2"}`, "version", `"2"`},
+		{`{"list": ["version", {"x": 1}], "b": {"c": {"version": "3"}}}`, "b.c.version", `"3"`},
+		{"{\n  \"version\" :\t\"1.0.0\"\n}", "version", `"1.0.0"`},
+		{`{"version": "say \"hi\""}`, "version", `"say \"hi\""`},
+	}
+	for _, tt := range tests {
+		start, end, err := jsonValueSpan([]byte(tt.data), strings.Split(tt.path, "."))
+		if err != nil {
+			t.Errorf("jsonValueSpan(%s, %s) failed: %v", tt.data, tt.path, err)
+			continue
+		}
+		if got := tt.data[start:end]; got != tt.want {
+			t.Errorf("jsonValueSpan(%s, %s) = %s, want %s", tt.data, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestJSONValueSpanErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		path string
+	}{
+		{`{"name": "app"}`, "version"},
+		{`{"version": 1}`, "version"},
+		{`{"version": {"major": "1"}}`, "version"},
+		{`{"list": [{"version": "1"}]}`, "list.version"},
+		{`{"version": "1"`, "name"},
+	}
+	for _, tt := range tests {
+		if _, _, err := jsonValueSpan([]byte(tt.data), strings.Split(tt.path, ".")); err == nil {
+			t.Errorf("jsonValueSpan(%s, %s) succeeded", tt.data, tt.path)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheEnv returns the variables pointing common build tools at a cache
+// directory, besides RELEASE_CACHE_DIR for build scripts
+func cacheEnv(dir string) []string {
+	return []string{
+		"RELEASE_CACHE_DIR=" + dir,
+		"GOCACHE=" + filepath.Join(dir, "go-build"),
+		"GOMODCACHE=" + filepath.Join(dir, "go-mod"),
+		"npm_config_cache=" + filepath.Join(dir, "npm"),
+		"npm_config_store_dir=" + filepath.Join(dir, "pnpm"),
+		"YARN_CACHE_FOLDER=" + filepath.Join(dir, "yarn"),
+		"BUN_INSTALL_CACHE_DIR=" + filepath.Join(dir, "bun"),
+	}
+}
+
+// CacheRoot returns the directory build caches are kept in: BUILD_CACHE_DIR,
+// or a directory for the repository in the user's cache directory
+func (g *GitHubReleaser) CacheRoot() (string, error) {
+	if g.config.BuildCacheDir != "" {
+		return filepath.Abs(g.config.BuildCacheDir)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no cache directory, set BUILD_CACHE_DIR: %w", err)
+	}
+	return filepath.Join(dir, "greleaser", g.ownerName, g.repoName), nil
+}
+
+// cacheDir returns the cache directory of a build, creating it if needed
+func (g *GitHubReleaser) cacheDir(b Build) (string, error) {
+	root, err := g.CacheRoot()
+	if err != nil {
+		return "", err
+	}
+	name := b.Name
+	if name == "" {
+		name = "default"
+	}
+	// Projects releasing builds of the same name get their own caches
+	if g.config.Project != "" {
+		name = filepath.Join(g.config.Project, name)
+	}
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create build cache: %w", err)
+	}
+	return dir, nil
+}
+
+// runner returns the runner of a build's commands, with its cache if it
+// has one and its secrets
+func (g *GitHubReleaser) runner(b Build, info BuildInfo) (buildRunner, error) {
+	cache := ""
+	if b.Cache {
+		var err error
+		if cache, err = g.cacheDir(b); err != nil {
+			return buildRunner{}, err
+		}
+	}
+	secrets, err := g.secretEnv(b)
+	if err != nil {
+		return buildRunner{}, err
+	}
+	runner := b.Runner(info, g.config.ContainerEngine, cache)
+	runner.Env = append(runner.Env, secrets...)
+	return runner, nil
+}
+
+// PruneCache removes the files under root that weren't modified within
+// maxAge, and the directories left empty, returning how many files were
+// removed
+func PruneCache(root string, maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			// Go's module cache is read-only
+			os.Chmod(filepath.Dir(path), 0755)
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	// Deepest first, so parents are empty by the time they're reached.
+	// Removing a directory that isn't empty fails, which is fine.
+	for i := len(dirs) - 1; i > 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return removed, nil
+}
+
+// pruneCache prunes the build cache per BUILD_CACHE_MAX_AGE, if any of the
+// builds uses it. Failing to prune doesn't fail the release.
+func (g *GitHubReleaser) pruneCache(builds []Build) {
+	cached := false
+	for _, b := range builds {
+		cached = cached || b.Cache
+	}
+	if !cached || g.config.BuildCacheMaxAge <= 0 {
+		return
+	}
+
+	ui.Step("Pruning build cache")
+	root, err := g.CacheRoot()
+	if err != nil {
+		ui.Printf("Warning: failed to prune build cache: %v\n", err)
+		return
+	}
+	removed, err := PruneCache(root, time.Duration(g.config.BuildCacheMaxAge)*24*time.Hour)
+	if err != nil {
+		ui.Printf("Warning: failed to prune build cache: %v\n", err)
+	}
+	if removed > 0 {
+		ui.Printf("Removed %d cached files unused for %d days\n", removed, g.config.BuildCacheMaxAge)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCalVerFormat is used when CALVER_FORMAT isn't set
+const defaultCalVerFormat = "YYYY.0M.MICRO"
+
+// calverTokenRe matches the format tokens from https://calver.org
+var calverTokenRe = regexp.MustCompile(`YYYY|YY|0Y|MM|0M|WW|0W|DD|0D|MICRO`)
+
+// CalVer is a calendar versioning scheme such as YYYY.0M.MICRO, where
+// MICRO counts releases within the same period
+type CalVer struct {
+	Format string
+}
+
+// NewCalVer validates a CalVer format string
+func NewCalVer(format string) (CalVer, error) {
+	if format == "" {
+		format = defaultCalVerFormat
+	}
+	if strings.Count(format, "MICRO") != 1 {
+		return CalVer{}, fmt.Errorf("CalVer format %q must contain MICRO exactly once", format)
+	}
+	if len(calverTokenRe.FindAllString(format, -1)) < 2 {
+		return CalVer{}, fmt.Errorf("CalVer format %q has no date component", format)
+	}
+	return CalVer{Format: format}, nil
+}
+
+// render replaces the date tokens in the format for t, and MICRO with micro
+func (c CalVer) render(t time.Time, micro string) string {
+	return calverTokenRe.ReplaceAllStringFunc(c.Format, func(token string) string {
+		_, week := t.ISOWeek()
+		switch token {
+		case "YYYY":
+			return strconv.Itoa(t.Year())
+		case "YY":
+			return strconv.Itoa(t.Year() - 2000)
+		case "0Y":
+			return fmt.Sprintf("%02d", t.Year()-2000)
+		case "MM":
+			return strconv.Itoa(int(t.Month()))
+		case "0M":
+			return fmt.Sprintf("%02d", int(t.Month()))
+		case "WW":
+			return strconv.Itoa(week)
+		case "0W":
+			return fmt.Sprintf("%02d", week)
+		case "DD":
+			return strconv.Itoa(t.Day())
+		case "0D":
+			return fmt.Sprintf("%02d", t.Day())
+		}
+		return micro
+	})
+}
+
+// pattern returns a regexp matching any version in this format
+func (c CalVer) pattern() *regexp.Regexp {
+	tokens := map[string]string{
+		"YYYY":  `\d{4}`,
+		"YY":    `\d{1,3}`,
+		"0Y":    `\d{2,3}`,
+		"MM":    `(?:[1-9]|1[0-2])`,
+		"0M":    `(?:0[1-9]|1[0-2])`,
+		"WW":    `(?:[1-9]|[1-4]\d|5[0-3])`,
+		"0W":    `(?:0[1-9]|[1-4]\d|5[0-3])`,
+		"DD":    `(?:[1-9]|[12]\d|3[01])`,
+		"0D":    `(?:0[1-9]|[12]\d|3[01])`,
+		"MICRO": `(?:0|[1-9]\d*)`,
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range calverTokenRe.FindAllStringIndex(c.Format, -1) {
+		b.WriteString(regexp.QuoteMeta(c.Format[last:loc[0]]))
+		b.WriteString(tokens[c.Format[loc[0]:loc[1]]])
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(c.Format[last:]))
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Validate checks that version matches the format
+func (c CalVer) Validate(version string) error {
+	if !c.pattern().MatchString(strings.TrimPrefix(version, "v")) {
+		return fmt.Errorf("invalid version %q: expected CalVer format %s", version, c.Format)
+	}
+	return nil
+}
+
+// Next returns the next version for the period containing now. MICRO
+// starts at 0 and counts up past any existing tags from the same period.
+func (c CalVer) Next(now time.Time, tags []string) string {
+	const marker = "\x00"
+	period := c.render(now, marker)
+	i := strings.Index(period, marker)
+	prefix, suffix := period[:i], period[i+len(marker):]
+
+	micro := 0
+	for _, tag := range tags {
+		tag = strings.TrimPrefix(tag, "v")
+		if len(tag) <= len(prefix)+len(suffix) || !strings.HasPrefix(tag, prefix) || !strings.HasSuffix(tag, suffix) {
+			continue
+		}
+		counter := tag[len(prefix) : len(tag)-len(suffix)]
+		if !isNumeric(counter) {
+			continue
+		}
+		if n, err := strconv.Atoi(counter); err == nil && n >= micro {
+			micro = n + 1
+		}
+	}
+
+	return c.render(now, strconv.Itoa(micro))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewCalVer(t *testing.T) {
+	if c, err := NewCalVer(""); err != nil || c.Format != defaultCalVerFormat {
+		t.Errorf("NewCalVer(\"\") = %+v, %v, want the default format", c, err)
+	}
+	for _, format := range []string{"YYYY.0M.MICRO", "YY.MM.DD.MICRO", "0Y.0W-MICRO"} {
+		if _, err := NewCalVer(format); err != nil {
+			t.Errorf("NewCalVer(%q) failed: %v", format, err)
+		}
+	}
+	for _, format := range []string{"YYYY.0M", "MICRO", "YYYY.MICRO.MICRO", "1.MICRO"} {
+		if _, err := NewCalVer(format); err == nil {
+			t.Errorf("NewCalVer(%q) succeeded", format)
+		}
+	}
+}
+
+func TestCalVerNext(t *testing.T) {
+	june := time.Date(2024, time.June, 5, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		format string
+		now    time.Time
+		tags   []string
+		want   string
+	}{
+		{"first release", "YYYY.0M.MICRO", june, nil, "2024.06.0"},
+		{"same month", "YYYY.0M.MICRO", june, []string{"v2024.06.0", "v2024.06.1"}, "2024.06.2"},
+		{"counter past gaps", "YYYY.0M.MICRO", june, []string{"2024.06.0", "v2024.06.10", "v2024.06.3"}, "2024.06.11"},
+		{"new month", "YYYY.0M.MICRO", june, []string{"v2024.05.0", "v2024.05.7"}, "2024.06.0"},
+		{"new year", "YYYY.0M.MICRO", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), []string{"v2024.12.4"}, "2025.01.0"},
+		{"same day", "YY.MM.DD.MICRO", june, []string{"v24.6.5.0", "v24.6.4.3"}, "24.6.5.1"},
+		{"next day", "YY.MM.DD.MICRO", june.AddDate(0, 0, 1), []string{"v24.6.5.0", "v24.6.5.1"}, "24.6.6.0"},
+		{"other tags ignored", "YYYY.0M.MICRO", june, []string{"v1.2.3", "v2024.06.x", "v2024.06.1-rc.1", "v2024.06."}, "2024.06.0"},
+	}
+	for _, tt := range tests {
+		c, err := NewCalVer(tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Next(tt.now, tt.tags); got != tt.want {
+			t.Errorf("%s: Next(%s, %v) = %s, want %s", tt.name, tt.now.Format("2006-01-02"), tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestCalVerValidate(t *testing.T) {
+	tests := []struct {
+		format, version string
+		valid           bool
+	}{
+		{"YYYY.0M.MICRO", "2024.06.0", true},
+		{"YYYY.0M.MICRO", "v2024.06.12", true},
+		{"YYYY.0M.MICRO", "2024.6.0", false},
+		{"YYYY.0M.MICRO", "2024.13.0", false},
+		{"YYYY.0M.MICRO", "2024.00.0", false},
+		{"YYYY.0M.MICRO", "2024.06.01", false},
+		{"YYYY.0M.MICRO", "2024.06", false},
+		{"YYYY.0M.MICRO", "2024.06.0.1", false},
+		{"YYYY.0M.MICRO", "2024x06.0", false},
+		{"YYYY.0M.MICRO", "1.2.3", false},
+		{"YY.MM.DD.MICRO", "24.6.5.0", true},
+		{"YY.MM.DD.MICRO", "24.6.32.0", false},
+		{"0Y.0W-MICRO", "24.07-3", true},
+		{"0Y.0W-MICRO", "24.54-3", false},
+	}
+	for _, tt := range tests {
+		c, err := NewCalVer(tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Validate(tt.version); (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) with %s = %v, want valid %t", tt.version, tt.format, err, tt.valid)
+		}
+	}
+}
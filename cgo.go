@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// zigArchs and zigOSes map Go's architecture and OS names to the parts of
+// a zig target triple
+var (
+	zigArchs = map[string]string{
+		"amd64":   "x86_64",
+		"386":     "x86",
+		"arm64":   "aarch64",
+		"arm":     "arm",
+		"riscv64": "riscv64",
+		"ppc64le": "powerpc64le",
+		"s390x":   "s390x",
+	}
+	zigOSes = map[string]string{
+		"linux":   "linux-gnu",
+		"darwin":  "macos",
+		"windows": "windows-gnu",
+		"freebsd": "freebsd",
+	}
+)
+
+// ZigTarget returns the zig target triple for a Go target, e.g.
+// aarch64-linux-gnu for linux/arm64
+func ZigTarget(t GoTarget) (string, error) {
+	arch, ok := zigArchs[t.Arch]
+	if !ok {
+		return "", fmt.Errorf("no zig target for %s", t)
+	}
+	osName, ok := zigOSes[t.OS]
+	if !ok {
+		return "", fmt.Errorf("no zig target for %s", t)
+	}
+	if t.OS == "linux" && t.Arch == "arm" {
+		osName = "linux-gnueabihf"
+	}
+	return arch + "-" + osName, nil
+}
+
+// ParseTargetCompilers parses the entries of a BUILD_CC or BUILD_CXX key, of
+// the form GOOS/GOARCH=compiler, by target
+func ParseTargetCompilers(key string, entries []string) (map[GoTarget]string, error) {
+	compilers := map[GoTarget]string{}
+	for _, entry := range entries {
+		target, compiler, ok := strings.Cut(entry, "=")
+		compiler = strings.TrimSpace(compiler)
+		if !ok || compiler == "" {
+			return nil, fmt.Errorf("invalid %s entry %q (expected GOOS/GOARCH=compiler)", key, entry)
+		}
+		targets, err := ParseGoTargets(key, []string{target})
+		if err != nil {
+			return nil, err
+		}
+		compilers[targets[0]] = compiler
+	}
+	return compilers, nil
+}
+
+// CgoToolchain picks the C and C++ compilers of a cgo-enabled Go build
+type CgoToolchain struct {
+	CC  map[GoTarget]string
+	CXX map[GoTarget]string
+	// Zig compiles with zig cc and zig c++ for targets without a CC
+	Zig bool
+	// Prefix is the build's config key prefix, for errors
+	Prefix string
+}
+
+// Env returns the variables enabling cgo for a target, with the compilers
+// to use. Native builds without a configured compiler use the default one.
+func (c CgoToolchain) Env(t GoTarget) ([]string, error) {
+	env := []string{"CGO_ENABLED=1"}
+	cc, cxx := c.CC[t], c.CXX[t]
+	if cc == "" && c.Zig {
+		triple, err := ZigTarget(t)
+		if err != nil {
+			return nil, err
+		}
+		cc = "zig cc -target " + triple
+		if cxx == "" {
+			cxx = "zig c++ -target " + triple
+		}
+	}
+	if cc == "" && (t.OS != runtime.GOOS || t.Arch != runtime.GOARCH) {
+		return nil, fmt.Errorf("cross-compiling %s with cgo needs a C compiler, set %sCC or %sZIG", t, c.Prefix, c.Prefix)
+	}
+	if cc != "" {
+		env = append(env, "CC="+cc)
+	}
+	if cxx != "" {
+		env = append(env, "CXX="+cxx)
+	}
+	return env, nil
+}
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// defaultChangelogSections is used when CHANGELOG_SECTIONS isn't set
+var defaultChangelogSections = []string{
+	"!=⚠ Breaking Changes",
+	"feat=Features",
+	"fix=Bug Fixes",
+	"perf=Performance",
+	"*=Other",
+}
+
+// ChangelogSection is a heading that collects commits of some types. The
+// type "!" matches breaking changes and "*" any commit not matched by
+// another section.
+type ChangelogSection struct {
+	Title string
+	Types []string
+}
+
+// ParseChangelogSections parses CHANGELOG_SECTIONS entries of the form
+// type[|type...]=Title, in the order the sections are rendered
+func ParseChangelogSections(entries []string) ([]ChangelogSection, error) {
+	if len(entries) == 0 {
+		entries = defaultChangelogSections
+	}
+
+	var sections []ChangelogSection
+	for _, entry := range entries {
+		types, title, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(title) == "" {
+			return nil, fmt.Errorf("invalid CHANGELOG_SECTIONS entry %q (expected type=Title)", entry)
+		}
+		section := ChangelogSection{Title: strings.TrimSpace(title)}
+		for _, t := range strings.Split(types, "|") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				section.Types = append(section.Types, t)
+			}
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+// defaultChangelogLabels is used when CHANGELOG_LABELS isn't set
+var defaultChangelogLabels = []string{
+	"breaking|breaking-change=!",
+	"feature|enhancement=feat",
+	"bug|bugfix=fix",
+	"performance=perf",
+}
+
+// ParseChangelogLabels parses CHANGELOG_LABELS entries of the form
+// label[|label...]=type into a map from lowercase label to type. The type
+// "!" marks breaking changes.
+func ParseChangelogLabels(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		entries = defaultChangelogLabels
+	}
+
+	labels := map[string]string{}
+	for _, entry := range entries {
+		names, t, ok := strings.Cut(entry, "=")
+		t = strings.ToLower(strings.TrimSpace(t))
+		if !ok || t == "" {
+			return nil, fmt.Errorf("invalid CHANGELOG_LABELS entry %q (expected label=type)", entry)
+		}
+		for _, name := range strings.Split(names, "|") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				labels[name] = t
+			}
+		}
+	}
+	return labels, nil
+}
+
+// ApplyLabels sets the type of a pull request's commit from its labels,
+// which take precedence over a conventional title
+func (c *Commit) ApplyLabels(labels map[string]string) {
+	typed := false
+	for _, label := range c.Labels {
+		switch t := labels[strings.ToLower(label)]; {
+		case t == "!":
+			c.Breaking = true
+		case t != "" && !typed:
+			c.Type, typed = t, true
+			if c.Description == "" {
+				c.Description = c.Subject
+			}
+		}
+	}
+}
+
+// ChangelogGroup is a section with the commits that fell into it
+type ChangelogGroup struct {
+	Title   string
+	Commits []Commit
+	// Breaking is set for the breaking changes section
+	Breaking bool
+}
+
+// GroupCommits sorts commits into sections. Breaking changes go to a "!"
+// section if there is one, other commits to the first section listing
+// their type, or else to a "*" section. Commits matching no section are
+// left out. Empty sections are omitted.
+func GroupCommits(commits []Commit, sections []ChangelogSection) []ChangelogGroup {
+	find := func(t string) int {
+		for i, s := range sections {
+			for _, st := range s.Types {
+				if st == t {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	groups := make([]ChangelogGroup, len(sections))
+	for i, s := range sections {
+		groups[i].Title = s.Title
+		groups[i].Breaking = i == find("!")
+	}
+	for _, c := range commits {
+		i := -1
+		if c.Breaking {
+			i = find("!")
+		}
+		if i < 0 && c.Type != "" {
+			i = find(c.Type)
+		}
+		if i < 0 {
+			i = find("*")
+		}
+		if i >= 0 {
+			groups[i].Commits = append(groups[i].Commits, c)
+		}
+	}
+
+	var nonEmpty []ChangelogGroup
+	for _, g := range groups {
+		if len(g.Commits) > 0 {
+			nonEmpty = append(nonEmpty, g)
+		}
+	}
+	return nonEmpty
+}
+
+// RenderChangelog formats commits as markdown. Conventional commits are
+// grouped into sections; if there are none, a flat list is rendered below
+// any breaking changes.
+func RenderChangelog(commits []Commit, sections []ChangelogSection) string {
+	conventional := false
+	for _, c := range commits {
+		if c.Type != "" {
+			conventional = true
+			break
+		}
+	}
+
+	var groups []ChangelogGroup
+	if conventional {
+		groups = GroupCommits(commits, sections)
+	} else {
+		var breaking []Commit
+		for _, c := range commits {
+			if c.Breaking {
+				breaking = append(breaking, c)
+			}
+		}
+		if len(breaking) > 0 {
+			groups = append(groups, ChangelogGroup{Title: "⚠ Breaking Changes", Commits: breaking, Breaking: true})
+		}
+	}
+
+	var blocks []string
+	for _, g := range groups {
+		lines := []string{"### " + g.Title, ""}
+		for _, c := range g.Commits {
+			lines = append(lines, "- "+c.Summary())
+			if g.Breaking && c.BreakingNote != "" {
+				lines = append(lines, "  "+c.BreakingNote)
+			}
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	if !conventional {
+		var lines []string
+		for _, c := range commits {
+			lines = append(lines, "- "+c.Summary())
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// ChangelogPath is a part of a monorepo that a changelog is broken down
+// into, with the paths it covers
+type ChangelogPath struct {
+	Title string
+	Paths []string
+}
+
+// ParseChangelogPaths parses CHANGELOG_PATHS entries of the form
+// path[|path...]=Title, in the order the parts are rendered
+func ParseChangelogPaths(entries []string) ([]ChangelogPath, error) {
+	var parts []ChangelogPath
+	for _, entry := range entries {
+		paths, title, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(title) == "" {
+			return nil, fmt.Errorf("invalid CHANGELOG_PATHS entry %q (expected path=Title)", entry)
+		}
+		part := ChangelogPath{Title: strings.TrimSpace(title)}
+		for _, p := range strings.Split(paths, "|") {
+			if p = strings.Trim(strings.TrimSpace(p), "/"); p != "" {
+				part.Paths = append(part.Paths, p)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// ChangelogPathGroup is a part of a monorepo with the commits touching it,
+// grouped into sections
+type ChangelogPathGroup struct {
+	Title   string
+	Commits []Commit
+	Groups  []ChangelogGroup
+}
+
+// GroupCommitsByPath breaks commits down by the parts of the repository
+// their files are in: the given parts, or else the top-level directories.
+// Commits touching several parts are listed in each, and commits touching
+// none under "Other".
+func GroupCommitsByPath(commits []Commit, parts []ChangelogPath, sections []ChangelogSection) []ChangelogPathGroup {
+	titles := map[string]bool{}
+	byTitle := map[string][]Commit{}
+	for _, c := range commits {
+		matched := map[string]bool{}
+		for _, f := range c.Files {
+			title := ""
+			if len(parts) == 0 {
+				if dir, _, ok := strings.Cut(f, "/"); ok {
+					title = dir
+				}
+			}
+		match:
+			for _, part := range parts {
+				for _, p := range part.Paths {
+					if f == p || strings.HasPrefix(f, p+"/") {
+						title = part.Title
+						break match
+					}
+				}
+			}
+			if title != "" && !matched[title] {
+				matched[title] = true
+				titles[title] = true
+				byTitle[title] = append(byTitle[title], c)
+			}
+		}
+		if len(matched) == 0 {
+			byTitle[""] = append(byTitle[""], c)
+		}
+	}
+
+	var order []string
+	if len(parts) > 0 {
+		for _, part := range parts {
+			order = append(order, part.Title)
+		}
+	} else {
+		for title := range titles {
+			order = append(order, title)
+		}
+		sort.Strings(order)
+	}
+	order = append(order, "")
+
+	var groups []ChangelogPathGroup
+	seen := map[string]bool{}
+	for _, title := range order {
+		if seen[title] || len(byTitle[title]) == 0 {
+			continue
+		}
+		seen[title] = true
+		group := ChangelogPathGroup{Title: title, Commits: byTitle[title]}
+		if title == "" {
+			group.Title = "Other"
+		}
+		group.Groups = GroupCommits(group.Commits, sections)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// sectionHeadingRe matches the section headings of a rendered changelog
+var sectionHeadingRe = regexp.MustCompile(`(?m)^### `)
+
+// RenderPathChangelog formats a changelog broken down by path, with each
+// part's sections one heading level below the part
+func RenderPathChangelog(groups []ChangelogPathGroup, sections []ChangelogSection) string {
+	var blocks []string
+	for _, g := range groups {
+		changelog := sectionHeadingRe.ReplaceAllString(RenderChangelog(g.Commits, sections), "#### ")
+		blocks = append(blocks, "### "+g.Title+"\n\n"+changelog)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// Summary formats a commit for a grouped changelog: the description with
+// its scope in bold, or the subject for non-conventional commits, after the
+// gitmoji and followed by the PR author or credited commit author
+func (c Commit) Summary() string {
+	summary := c.Description
+	switch {
+	case c.Description == "":
+		summary = c.Subject
+	case c.Scope != "":
+		summary = fmt.Sprintf("**%s:** %s", c.Scope, c.Description)
+	}
+	if c.Gitmoji != "" {
+		summary = c.Gitmoji + " " + summary
+	}
+	var authors []string
+	switch {
+	case c.PRAuthor != "":
+		authors = []string{"@" + c.PRAuthor}
+	case c.Author != nil:
+		authors = []string{c.Author.Handle()}
+	}
+	if len(authors) > 0 {
+		for _, co := range c.CoAuthors {
+			if co.Handle() != authors[0] {
+				authors = append(authors, co.Handle())
+			}
+		}
+		summary += " by " + joinAnd(authors)
+	}
+	return summary
+}
+
+// joinAnd joins names as "a", "a and b" or "a, b and c"
+func joinAnd(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// issueRefRe matches #123 references that aren't already part of a link
+// or a cross-repository reference
+var issueRefRe = regexp.MustCompile(`(^|[^\w/\[&])#(\d+)\b`)
+
+// LinkRefs turns #123 references in text into markdown links to the
+// repository at repoURL. The commit's own PR links to the pull request,
+// other references to the issue page, which GitHub redirects for PRs.
+func LinkRefs(text, repoURL string, pr int) string {
+	return issueRefRe.ReplaceAllStringFunc(text, func(match string) string {
+		m := issueRefRe.FindStringSubmatch(match)
+		kind := "issues"
+		if n, _ := strconv.Atoi(m[2]); n == pr {
+			kind = "pull"
+		}
+		return fmt.Sprintf("%s[#%s](%s/%s/%s)", m[1], m[2], repoURL, kind, m[2])
+	})
+}
+
+// mentionRe matches @login mentions, but not email addresses, links or
+// references like action@v4
+var mentionRe = regexp.MustCompile(`(^|[^\w@/\[])@([A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)\b`)
+
+// UnmentionHandles turns @login mentions into links to the user profiles
+// on the GitHub site at baseURL, which don't notify the users
+func UnmentionHandles(text, baseURL string) string {
+	return mentionRe.ReplaceAllString(text, "${1}[${2}]("+baseURL+"/${2})")
+}
+
+// Contributor is a commit author credited in the release notes
+type Contributor struct {
+	Name  string
+	Email string
+	// Login is the GitHub handle, if it was resolved
+	Login string
+	// FirstTime is set for authors without commits before this release
+	FirstTime bool
+
+	// commit is one of the author's commits, to resolve the login from
+	commit string
+}
+
+// Contributors returns the distinct authors and co-authors of commits, in
+// order of their first appearance
+func Contributors(commits []Commit) []Contributor {
+	var contributors []Contributor
+	seen := map[string]bool{}
+	add := func(c Contributor) {
+		key := strings.ToLower(c.Email)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		contributors = append(contributors, c)
+	}
+	for _, c := range commits {
+		add(Contributor{Name: c.AuthorName, Email: c.AuthorEmail, Login: noreplyLogin(c.AuthorEmail), commit: c.Hash})
+		for _, co := range c.CoAuthors {
+			add(co)
+		}
+	}
+	return contributors
+}
+
+// noreplyRe matches GitHub's private commit emails, which contain the login
+var noreplyRe = regexp.MustCompile(`^(?:\d+\+)?([^@+]+)@users\.noreply\.github\.com$`)
+
+// noreplyLogin returns the login in a GitHub noreply email, or ""
+func noreplyLogin(email string) string {
+	if m := noreplyRe.FindStringSubmatch(strings.ToLower(email)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Handle returns the @login if known, or else the author's name
+func (c Contributor) Handle() string {
+	if c.Login != "" {
+		return "@" + c.Login
+	}
+	return c.Name
+}
+
+// RenderContributors formats a "Contributors" release notes section,
+// calling out first-time contributors
+func RenderContributors(contributors []Contributor) string {
+	if len(contributors) == 0 {
+		return ""
+	}
+	lines := []string{"### Contributors", ""}
+	// Several emails can belong to the same account
+	seen := map[string]bool{}
+	for _, c := range contributors {
+		if seen[c.Handle()] {
+			continue
+		}
+		seen[c.Handle()] = true
+		line := "- " + c.Handle()
+		if c.FirstTime {
+			line += " made their first contribution"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ChangelogData is what CHANGELOG_TEMPLATE, NOTES_HEADER and NOTES_FOOTER
+// templates are executed with
+type ChangelogData struct {
+	Version string
+	// PreviousVersion is the ref the changelog starts from, usually the
+	// previous tag, or "" for the first release
+	PreviousVersion string
+	Date            string
+	Owner           string
+	Repo            string
+	Commits         []Commit
+	Groups          []ChangelogGroup
+	// Paths is the changelog broken down by path, with CHANGELOG_BY_PATH
+	// or CHANGELOG_PATHS
+	Paths []ChangelogPathGroup
+	// CompareURL links to the diff since PreviousVersion on GitHub
+	CompareURL   string
+	Contributors []Contributor
+}
+
+// RenderTemplateFile executes the text/template in the file at path, set
+// through the config key
+func RenderTemplateFile(key, path string, data ChangelogData) (string, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	tmpl, err := template.New(path).Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(string(text))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// changelogExport is the JSON form of a changelog
+type changelogExport struct {
+	Version         string                   `json:"version"`
+	PreviousVersion string                   `json:"previous_version"`
+	Date            string                   `json:"date"`
+	CompareURL      string                   `json:"compare_url,omitempty"`
+	Sections        []changelogExportSection `json:"sections"`
+	Contributors    []changelogExportAuthor  `json:"contributors"`
+}
+
+type changelogExportSection struct {
+	Title    string                  `json:"title"`
+	Breaking bool                    `json:"breaking"`
+	Commits  []changelogExportCommit `json:"commits"`
+}
+
+type changelogExportCommit struct {
+	SHA          string                `json:"sha"`
+	Type         string                `json:"type"`
+	Scope        string                `json:"scope"`
+	Subject      string                `json:"subject"`
+	Description  string                `json:"description"`
+	Gitmoji      string                `json:"gitmoji,omitempty"`
+	Breaking     bool                  `json:"breaking"`
+	BreakingNote string                `json:"breaking_note,omitempty"`
+	Author       changelogExportAuthor `json:"author"`
+	PR           int                   `json:"pr,omitempty"`
+	PRAuthor     string                `json:"pr_author,omitempty"`
+	Labels       []string              `json:"labels,omitempty"`
+}
+
+type changelogExportAuthor struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Login     string `json:"login,omitempty"`
+	FirstTime bool   `json:"first_time,omitempty"`
+}
+
+// MarshalChangelog returns the grouped commits and contributors in data as
+// indented JSON
+func MarshalChangelog(data ChangelogData) ([]byte, error) {
+	export := changelogExport{
+		Version:         data.Version,
+		PreviousVersion: data.PreviousVersion,
+		Date:            data.Date,
+		CompareURL:      data.CompareURL,
+		Sections:        []changelogExportSection{},
+		Contributors:    []changelogExportAuthor{},
+	}
+
+	logins := map[string]string{}
+	for _, c := range data.Contributors {
+		logins[strings.ToLower(c.Email)] = c.Login
+		export.Contributors = append(export.Contributors, changelogExportAuthor{
+			Name:      c.Name,
+			Email:     c.Email,
+			Login:     c.Login,
+			FirstTime: c.FirstTime,
+		})
+	}
+
+	for _, g := range data.Groups {
+		section := changelogExportSection{Title: g.Title, Breaking: g.Breaking}
+		for _, c := range g.Commits {
+			login := logins[strings.ToLower(c.AuthorEmail)]
+			if c.Author != nil {
+				login = c.Author.Login
+			}
+			section.Commits = append(section.Commits, changelogExportCommit{
+				SHA:          c.Hash,
+				Type:         c.Type,
+				Scope:        c.Scope,
+				Subject:      c.Subject,
+				Description:  c.Description,
+				Gitmoji:      c.Gitmoji,
+				Breaking:     c.Breaking,
+				BreakingNote: c.BreakingNote,
+				Author: changelogExportAuthor{
+					Name:  c.AuthorName,
+					Email: c.AuthorEmail,
+					Login: login,
+				},
+				PR:       c.PR,
+				PRAuthor: c.PRAuthor,
+				Labels:   c.Labels,
+			})
+		}
+		export.Sections = append(export.Sections, section)
+	}
+
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// changelogFileHeader starts a new CHANGELOG.md
+const changelogFileHeader = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/),
+and this project adheres to [Semantic Versioning](https://semver.org/spec/v2.0.0.html).
+`
+
+// UpdateChangelogFile adds a release's notes to a Keep a Changelog style
+// file, above the previous releases. The file is created if missing.
+func UpdateChangelogFile(path, version, date, notes string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data, err = []byte(changelogFileHeader), nil
+	}
+	if err != nil {
+		return err
+	}
+	content := string(data)
+
+	heading := fmt.Sprintf("## [%s] - %s", version, date)
+	if strings.Contains(content, fmt.Sprintf("## [%s]", version)) {
+		return fmt.Errorf("%s already has an entry for %s", path, version)
+	}
+	entry := heading + "\n"
+	if notes != "" {
+		entry += "\n" + notes + "\n"
+	}
+
+	// Insert before the first release, after an [Unreleased] section if any
+	releaseRe := regexp.MustCompile(`(?m)^## \[`)
+	unreleasedRe := regexp.MustCompile(`(?mi)^## \[unreleased\]`)
+	offset := 0
+	if loc := unreleasedRe.FindStringIndex(content); loc != nil {
+		offset = loc[1]
+	}
+	if loc := releaseRe.FindStringIndex(content[offset:]); loc != nil {
+		i := offset + loc[0]
+		content = content[:i] + entry + "\n" + content[i:]
+	} else {
+		content = strings.TrimRight(content, "\n") + "\n\n" + entry
+	}
+
+	return os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateChangelogFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		notes    string
+		want     string
+	}{
+		{
+			name:  "new file",
+			notes: "### Features\n\n- Add things",
+			want:  changelogFileHeader + "\n## [1.1.0] - 2024-01-02\n\n### Features\n\n- Add things\n",
+		},
+		{
+			name:     "above the previous release",
+			existing: "# Changelog\n\n## [1.0.0] - 2023-12-01\n\n- First\n",
+			notes:    "- Second",
+			want:     "# Changelog\n\n## [1.1.0] - 2024-01-02\n\n- Second\n\n## [1.0.0] - 2023-12-01\n\n- First\n",
+		},
+		{
+			name:     "after the unreleased section",
+			existing: "# Changelog\n\n## [Unreleased]\n\n- Soon\n\n## [1.0.0] - 2023-12-01\n\n- First\n",
+			notes:    "- Second",
+			want:     "# Changelog\n\n## [Unreleased]\n\n- Soon\n\n## [1.1.0] - 2024-01-02\n\n- Second\n\n## [1.0.0] - 2023-12-01\n\n- First\n",
+		},
+		{
+			name:     "no releases yet",
+			existing: "# Changelog\n\n## [unreleased]\n\n- Soon\n\n\n",
+			notes:    "- Second",
+			want:     "# Changelog\n\n## [unreleased]\n\n- Soon\n\n## [1.1.0] - 2024-01-02\n\n- Second\n",
+		},
+		{
+			name:     "empty notes",
+			existing: "# Changelog\n\n## [1.0.0] - 2023-12-01\n",
+			want:     "# Changelog\n\n## [1.1.0] - 2024-01-02\n\n## [1.0.0] - 2023-12-01\n",
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+		if tt.existing != "" {
+			if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := UpdateChangelogFile(path, "1.1.0", "2024-01-02", tt.notes); err != nil {
+			t.Errorf("%s: UpdateChangelogFile failed: %v", tt.name, err)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateChangelogFileExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	existing := "# Changelog\n\n## [1.1.0] - 2024-01-02\n\n- Second\n"
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := UpdateChangelogFile(path, "1.1.0", "2024-01-03", "- Again")
+	if err == nil || !strings.Contains(err.Error(), "already has an entry for 1.1.0") {
+		t.Errorf("UpdateChangelogFile of a released version: got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != existing {
+		t.Errorf("UpdateChangelogFile changed the file:\n%s", data)
+	}
+}
+
+// update rewrites the golden files of the tests with their output
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden compares got with the golden file testdata/name, or writes
+// it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to write it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s:\n%s", path, got)
+	}
+}
+
+func TestRenderChangelog(t *testing.T) {
+	sections, err := ParseChangelogSections(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := &Contributor{Name: "Ada", Login: "ada"}
+	var commits []Commit
+	for _, c := range []struct {
+		subject, body string
+		author        *Contributor
+		prAuthor      string
+	}{
+		{subject: "feat(cli): add --dry-run (#12)", prAuthor: "grace"},
+		{subject: "fix: handle empty tags", author: author},
+		{subject: "refactor!: rename OLD_KEY", body: "BREAKING CHANGE: set NEW_KEY\ninstead."},
+		{subject: "perf: cache logins"},
+		{subject: "✨ add gitmoji support"},
+		{subject: "docs: fix a typo", author: author, body: "Co-authored-by: Linus <1+torvalds@users.noreply.github.com>"},
+		{subject: "Update dependencies"},
+	} {
+		commit := ParseCommit("abc", c.subject, c.body)
+		commit.Author, commit.PRAuthor = c.author, c.prAuthor
+		commits = append(commits, commit)
+	}
+	checkGolden(t, "changelog.md", RenderChangelog(commits, sections)+"\n")
+
+	// Without conventional commits the list stays flat
+	flat := []Commit{
+		ParseCommit("abc", "Update README", ""),
+		ParseCommit("def", "Remove the v1 API", "BREAKING CHANGE: use v2"),
+	}
+	checkGolden(t, "changelog-flat.md", RenderChangelog(flat, sections)+"\n")
+}
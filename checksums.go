@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Checksums are files listing the checksums of the release assets, which
+// are released with them
+type Checksums struct {
+	// Enabled writes a checksums file per algorithm
+	Enabled bool
+	// Algorithms are the hash algorithms, sha256 by default
+	Algorithms []string
+	// File is where the checksums file is written, by default
+	// dist/<ALGORITHM>SUMS. It can only be set for a single algorithm.
+	File string
+	// Sidecars writes a <asset>.<algorithm> file per asset and algorithm
+	Sidecars bool
+}
+
+// checksumAlgorithms are the supported CHECKSUM_ALGORITHM values. BLAKE3
+// isn't in the standard library, so it's computed by b3sum.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"blake3": nil,
+}
+
+// checksumDir is where checksum files are written, unless File is set
+const checksumDir = "dist"
+
+// algorithms returns the hash algorithms
+func (c Checksums) algorithms() []string {
+	if len(c.Algorithms) == 0 {
+		return []string{"sha256"}
+	}
+	algorithms := make([]string, len(c.Algorithms))
+	for i, a := range c.Algorithms {
+		algorithms[i] = strings.ToLower(a)
+	}
+	return algorithms
+}
+
+// Path returns where the checksums file of an algorithm is written
+func (c Checksums) Path(algorithm string) string {
+	if c.File != "" {
+		return c.File
+	}
+	return filepath.Join(checksumDir, strings.ToUpper(algorithm)+"SUMS")
+}
+
+// Paths returns where the checksums files are written
+func (c Checksums) Paths() []string {
+	var paths []string
+	for _, algorithm := range c.algorithms() {
+		paths = append(paths, c.Path(algorithm))
+	}
+	return paths
+}
+
+// Validate checks the checksums configuration
+func (c Checksums) Validate() error {
+	for _, algorithm := range c.algorithms() {
+		if _, ok := checksumAlgorithms[algorithm]; !ok {
+			names := make([]string, 0, len(checksumAlgorithms))
+			for name := range checksumAlgorithms {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown CHECKSUM_ALGORITHM %q (expected %s)", algorithm, strings.Join(names, ", "))
+		}
+		if algorithm == "blake3" && (c.Enabled || c.Sidecars) {
+			if _, err := exec.LookPath("b3sum"); err != nil {
+				return fmt.Errorf("blake3 checksums need b3sum: %w", err)
+			}
+		}
+	}
+	if c.File != "" && len(c.algorithms()) > 1 {
+		return fmt.Errorf("CHECKSUMS_FILE can't be set for several CHECKSUM_ALGORITHM values")
+	}
+	return nil
+}
+
+// WriteChecksums writes the checksums files of the files at paths, and
+// their sidecar files, and returns what it wrote. Both are in the format of
+// sha256sum and its siblings: a line of the hex checksum and the file's
+// name per file, sorted by name.
+func WriteChecksums(c Checksums, paths []string) ([]string, error) {
+	sorted := append([]string(nil), paths...)
+	sort.Slice(sorted, func(i, j int) bool { return filepath.Base(sorted[i]) < filepath.Base(sorted[j]) })
+
+	var written []string
+	for _, algorithm := range c.algorithms() {
+		var sums strings.Builder
+		for _, path := range sorted {
+			sum, err := fileDigest(path, algorithm)
+			if err != nil {
+				return nil, err
+			}
+			line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+			sums.WriteString(line)
+			if c.Sidecars {
+				sidecar := filepath.Join(checksumDir, filepath.Base(path)+"."+algorithm)
+				if err := writeChecksumFile(sidecar, line); err != nil {
+					return nil, err
+				}
+				written = append(written, sidecar)
+			}
+		}
+		if c.Enabled {
+			if err := writeChecksumFile(c.Path(algorithm), sums.String()); err != nil {
+				return nil, err
+			}
+			written = append(written, c.Path(algorithm))
+		}
+	}
+	return written, nil
+}
+
+// writeChecksumFile writes a checksums or sidecar file
+func writeChecksumFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// fileDigest returns the hex checksum of a file with an algorithm
+func fileDigest(path, algorithm string) (string, error) {
+	if newHash := checksumAlgorithms[algorithm]; newHash != nil {
+		sum, _, err := fileChecksum(path, newHash)
+		return sum, err
+	}
+	cmd := exec.Command("b3sum", "--no-names", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("b3sum failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// fileChecksum returns the hex checksum and the size of a file
+func fileChecksum(path string, newHash func() hash.Hash) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := newHash()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Commit is a git commit, parsed as a conventional commit where possible
+// (https://www.conventionalcommits.org)
+type Commit struct {
+	Hash        string
+	Subject     string
+	Body        string
+	AuthorName  string
+	AuthorEmail string
+	Merge       bool
+	// PR is the pull request a squash or merge commit came from, or 0
+	PR int
+	// PRAuthor is the login of the PR's author, if it was looked up
+	PRAuthor string
+	// Author is the commit's author with their login, if authors are
+	// credited
+	Author *Contributor
+	// CoAuthors are credited in Co-authored-by trailers
+	CoAuthors []Contributor
+	// Labels are the pull request's labels, in the pulls changelog mode
+	Labels []string
+
+	// Type, Scope and Description are empty for non-conventional subjects.
+	// Subjects with an unknown :shortcode: only get a Description.
+	Type        string
+	Scope       string
+	Description string
+	Breaking    bool
+	// BreakingNote is the text of a BREAKING CHANGE footer
+	BreakingNote string
+	// Gitmoji is the emoji or :shortcode: the subject started with, see
+	// StyleGitmojis
+	Gitmoji string
+	// Files are the paths the commit changed, only listed for changelogs
+	// broken down by path
+	Files []string
+}
+
+// conventionalRe matches "type(scope)!: description"
+var conventionalRe = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+
+// squashPRRe matches the "(#123)" GitHub appends to squash-merged subjects,
+// and mergePRRe the subject of a GitHub merge commit
+var (
+	squashPRRe = regexp.MustCompile(`\(#(\d+)\)$`)
+	mergePRRe  = regexp.MustCompile(`^Merge pull request #(\d+) `)
+)
+
+// coAuthorRe matches a Co-authored-by trailer
+var coAuthorRe = regexp.MustCompile(`(?mi)^Co-authored-by:\s*(.*?)\s*<([^>]+)>\s*$`)
+
+// breakingFooterRe matches a BREAKING CHANGE footer in a commit body, up
+// to the end of its paragraph
+var breakingFooterRe = regexp.MustCompile(`(?ms)^BREAKING[ -]CHANGE: (.+?)(?:\n\s*\n|\z)`)
+
+// ParseCommit fills in the conventional commit fields from the subject and
+// body. Gitmoji subjects get the type their emoji stands for.
+func ParseCommit(hash, subject, body string) Commit {
+	c := Commit{Hash: hash, Subject: subject, Body: body}
+
+	// A gitmoji prefix stands in for the type, unless the rest of the
+	// subject is a conventional one
+	emoji, rest, hasEmoji := splitGitmoji(subject)
+	if hasEmoji {
+		c.Gitmoji = emoji.String()
+		c.Type = emoji.Type
+		c.Breaking = emoji.Breaking
+		c.Description = rest
+	}
+	if m := conventionalRe.FindStringSubmatch(rest); m != nil {
+		c.Type = strings.ToLower(m[1])
+		c.Scope = m[2]
+		c.Breaking = c.Breaking || m[3] == "!"
+		c.Description = m[4]
+	}
+	if m := breakingFooterRe.FindStringSubmatch(body); m != nil {
+		c.Breaking = true
+		c.BreakingNote = strings.Join(strings.Fields(m[1]), " ")
+	}
+	for _, m := range coAuthorRe.FindAllStringSubmatch(body, -1) {
+		c.CoAuthors = append(c.CoAuthors, Contributor{Name: m[1], Email: m[2], Login: noreplyLogin(m[2])})
+	}
+	for _, re := range []*regexp.Regexp{squashPRRe, mergePRRe} {
+		if m := re.FindStringSubmatch(subject); m != nil {
+			c.PR, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	return c
+}
+
+// CommitsInRange returns the commits in a git revision range, newest first.
+// An empty range means all commits reachable from HEAD. If path is set,
+// only commits touching it are returned.
+func CommitsInRange(revRange, path string) ([]Commit, error) {
+	// Unit and record separators keep multi-line bodies intact
+	args := []string{"log", "--format=%H%x1f%P%x1f%an%x1f%ae%x1f%s%x1f%b%x1e"}
+	if revRange != "" {
+		args = append(args, revRange)
+	}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+
+	out, err := gitOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		fields := strings.SplitN(record, "\x1f", 6)
+		if len(fields) != 6 {
+			continue
+		}
+		c := ParseCommit(fields[0], fields[4], strings.TrimSpace(fields[5]))
+		c.Merge = len(strings.Fields(fields[1])) > 1
+		c.AuthorName, c.AuthorEmail = fields[2], fields[3]
+		commits = append(commits, c)
+	}
+
+	return commits, nil
+}
+
+// CommitFiles returns the files changed by each commit in a revision range,
+// by hash, with the same range and path as CommitsInRange
+func CommitFiles(revRange, path string) (map[string][]string, error) {
+	args := []string{"log", "--format=%x1e%H", "--name-only"}
+	if revRange != "" {
+		args = append(args, revRange)
+	}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+
+	out, err := gitOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]string{}
+	for _, record := range strings.Split(out, "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		if lines[0] == "" {
+			continue
+		}
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line != "" {
+				files[lines[0]] = append(files[lines[0]], line)
+			}
+		}
+	}
+	return files, nil
+}
+
+// CommitFilter drops noise from changelogs
+type CommitFilter struct {
+	ExcludeMerges bool
+	ExcludeBots   bool
+	// Exclude drops commits whose subject matches any pattern
+	Exclude []*regexp.Regexp
+	// IncludeOnly, if set, drops commits whose subject matches no pattern
+	IncludeOnly []*regexp.Regexp
+}
+
+// NewCommitFilter builds a filter from the changelog configuration
+func NewCommitFilter(config Config) (CommitFilter, error) {
+	f := CommitFilter{
+		ExcludeMerges: config.ChangelogExcludeMerges,
+		ExcludeBots:   config.ChangelogExcludeBots,
+	}
+	var err error
+	if f.Exclude, err = compilePatterns("CHANGELOG_EXCLUDE", config.ChangelogExclude); err != nil {
+		return CommitFilter{}, err
+	}
+	if f.IncludeOnly, err = compilePatterns("CHANGELOG_INCLUDE_ONLY", config.ChangelogIncludeOnly); err != nil {
+		return CommitFilter{}, err
+	}
+	return f, nil
+}
+
+// compilePatterns compiles the regular expressions of a config key
+func compilePatterns(key string, patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", key, pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// isBot reports whether a commit was authored by a bot such as
+// dependabot or renovate
+func (c Commit) isBot() bool {
+	name := strings.ToLower(c.AuthorName)
+	return strings.HasSuffix(name, "[bot]") ||
+		strings.Contains(name, "dependabot") ||
+		strings.Contains(name, "renovate")
+}
+
+// Apply returns the commits the filter keeps
+func (f CommitFilter) Apply(commits []Commit) []Commit {
+	var kept []Commit
+	for _, c := range commits {
+		if f.keep(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+func (f CommitFilter) keep(c Commit) bool {
+	if f.ExcludeMerges && c.Merge {
+		return false
+	}
+	if f.ExcludeBots && c.isBot() {
+		return false
+	}
+	for _, re := range f.Exclude {
+		if re.MatchString(c.Subject) {
+			return false
+		}
+	}
+	if len(f.IncludeOnly) == 0 {
+		return true
+	}
+	for _, re := range f.IncludeOnly {
+		if re.MatchString(c.Subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// InferBump applies semver rules to conventional commits: any breaking
+// change is a major bump, any feature a minor bump, and anything else a
+// patch bump
+func InferBump(commits []Commit) string {
+	level := "patch"
+	for _, c := range commits {
+		if c.Breaking {
+			return "major"
+		}
+		if c.Type == "feat" {
+			level = "minor"
+		}
+	}
+	return level
+}
+
+// AutoVersion computes the next version from the component's conventional
+// commits since its latest tag. The result has no tag prefix.
+func AutoVersion(comp Component) (string, error) {
+	revRange := ""
+	if tag, err := comp.LatestTag(); err == nil {
+		revRange = tag + "..HEAD"
+	}
+
+	commits, err := comp.Commits(revRange)
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commits since the latest tag, nothing to release")
+	}
+
+	return BumpVersion(comp, InferBump(commits))
+}
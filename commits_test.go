@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferBump(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     string
+	}{
+		{"plain fix", []string{"fix: handle empty input"}, "patch"},
+		{"non-conventional", []string{"Update README"}, "patch"},
+		{"feature", []string{"fix: a bug", "feat: add a flag"}, "minor"},
+		{"feat!", []string{"feat!: drop the old API"}, "major"},
+		{"scoped fix!", []string{"fix(api)!: return 404 for missing releases"}, "major"},
+		{"breaking footer", []string{"feat: add a flag", "refactor: rename config\n\nBREAKING CHANGE: OLD_KEY is now NEW_KEY"}, "major"},
+		{"breaking-change footer", []string{"fix: a bug\n\nBREAKING-CHANGE: output changed"}, "major"},
+		{"breaking gitmoji", []string{"💥 remove the v1 endpoints"}, "major"},
+		{"footer-like text in the subject", []string{"fix: mention BREAKING CHANGE: in docs"}, "patch"},
+	}
+	for _, tt := range tests {
+		var commits []Commit
+		for _, message := range tt.messages {
+			subject, body, _ := strings.Cut(message, "\n\n")
+			commits = append(commits, ParseCommit("", subject, body))
+		}
+		if got := InferBump(commits); got != tt.want {
+			t.Errorf("%s: InferBump = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newTestRepo creates a git repository in a temporary directory and changes
+// to it for the rest of the test
+func newTestRepo(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "Test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "Test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_CONFIG_GLOBAL", os.DevNull}, {"GIT_CONFIG_NOSYSTEM", "1"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "init", "-q")
+}
+
+// runGit runs a git command in the working directory, failing the test if
+// it fails
+func runGit(t *testing.T, args ...string) {
+	t.Helper()
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestAutoVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     string
+	}{
+		{"plain fix", []string{"fix: handle empty input"}, "v1.2.4"},
+		{"feature", []string{"fix: a bug", "feat: add a flag"}, "v1.3.0"},
+		{"feat!", []string{"feat!: drop the old API"}, "v2.0.0"},
+		{"breaking footer", []string{"refactor: rename config\n\nBREAKING CHANGE: OLD_KEY is now NEW_KEY"}, "v2.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestRepo(t)
+			runGit(t, "commit", "-q", "--allow-empty", "-m", "feat: first release")
+			runGit(t, "tag", "v1.2.3")
+			for _, message := range tt.messages {
+				runGit(t, "commit", "-q", "--allow-empty", "-m", message)
+			}
+			got, err := AutoVersion(Component{})
+			if err != nil {
+				t.Fatalf("AutoVersion failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AutoVersion = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no commits", func(t *testing.T) {
+		newTestRepo(t)
+		runGit(t, "commit", "-q", "--allow-empty", "-m", "feat: first release")
+		runGit(t, "tag", "v1.2.3")
+		if got, err := AutoVersion(Component{}); err == nil {
+			t.Errorf("AutoVersion = %s, want an error", got)
+		}
+	})
+}
+
+func TestParseCommit(t *testing.T) {
+	tests := []struct {
+		subject, body string
+		want          Commit
+	}{
+		{
+			subject: "Update README",
+			want:    Commit{},
+		},
+		{
+			subject: "feat: add a flag",
+			want:    Commit{Type: "feat", Description: "add a flag"},
+		},
+		{
+			subject: "Fix(api): handle 404s",
+			want:    Commit{Type: "fix", Scope: "api", Description: "handle 404s"},
+		},
+		{
+			subject: "feat(cli)!: drop --old",
+			want:    Commit{Type: "feat", Scope: "cli", Description: "drop --old", Breaking: true},
+		},
+		{
+			subject: "feat: no space after the colon:x",
+			want:    Commit{Type: "feat", Description: "no space after the colon:x"},
+		},
+		{
+			subject: "feat:missing space",
+			want:    Commit{},
+		},
+		{
+			subject: "refactor: rename config",
+			body:    "Longer explanation.\n\nBREAKING CHANGE: OLD_KEY is now\nNEW_KEY.\n\nRefs: #4",
+			want:    Commit{Type: "refactor", Description: "rename config", Breaking: true, BreakingNote: "OLD_KEY is now NEW_KEY."},
+		},
+		{
+			subject: "fix: a bug",
+			body:    "BREAKING-CHANGE: output changed",
+			want:    Commit{Type: "fix", Description: "a bug", Breaking: true, BreakingNote: "output changed"},
+		},
+		// Gitmojis stand in for the type
+		{
+			subject: "✨ add a flag",
+			want:    Commit{Type: "feat", Description: "add a flag", Gitmoji: "✨"},
+		},
+		{
+			subject: ":bug: fix a crash",
+			want:    Commit{Type: "fix", Description: "fix a crash", Gitmoji: "🐛"},
+		},
+		{
+			subject: "💥 remove v1",
+			want:    Commit{Type: "feat", Description: "remove v1", Gitmoji: "💥", Breaking: true},
+		},
+		{
+			subject: ":unknown: something",
+			want:    Commit{Description: "something", Gitmoji: ":unknown:"},
+		},
+		{
+			subject: "🐛 feat(ui): a conventional subject wins",
+			want:    Commit{Type: "feat", Scope: "ui", Description: "a conventional subject wins", Gitmoji: "🐛"},
+		},
+		// Co-authors and pull requests
+		{
+			subject: "fix: pair on it",
+			body:    "Co-authored-by: Ada <ada@example.com>\nco-authored-by:  Linus <123+torvalds@users.noreply.github.com> ",
+			want: Commit{Type: "fix", Description: "pair on it", CoAuthors: []Contributor{
+				{Name: "Ada", Email: "ada@example.com"},
+				{Name: "Linus", Email: "123+torvalds@users.noreply.github.com", Login: "torvalds"},
+			}},
+		},
+		{
+			subject: "feat: squashed (#42)",
+			want:    Commit{Type: "feat", Description: "squashed (#42)", PR: 42},
+		},
+		{
+			subject: "Merge pull request #7 from me/branch",
+			want:    Commit{PR: 7},
+		},
+	}
+	for _, tt := range tests {
+		got := ParseCommit("abc", tt.subject, tt.body)
+		want := tt.want
+		want.Hash, want.Subject, want.Body = "abc", tt.subject, tt.body
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseCommit(%q, %q) =\n%+v\nwant\n%+v", tt.subject, tt.body, got, want)
+		}
+	}
+}
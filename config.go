@@ -0,0 +1,639 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the configuration loaded from environment
+type Config struct {
+	GithubToken string
+	// Build is the default build, set through the BUILD_* keys
+	Build Build
+	// Builds are the named builds listed in BUILDS, each set through the
+	// BUILD_<NAME>_* keys
+	Builds     []Build
+	buildNames []string
+	// BuildParallelism is how many build jobs may run at once
+	BuildParallelism int
+	ContainerEngine  string
+	Reproducible     bool
+	BuildLog         bool
+	BuildLogDir      string
+	BuildLogUpload   bool
+	BuildCacheDir    string
+	// BuildCacheMaxAge is how many days unused cache files are kept
+	BuildCacheMaxAge int
+	SecretsFile      string
+	Hooks            Hooks
+	Verify           Verify
+	Plugins          []string
+	GitRemote        string
+	GithubAPIURL     string
+	CreateTag        bool
+	SignTag          bool
+	SigningKey       string
+	SigningFormat    string
+	NoVPrefix        bool
+	VersionScheme    string
+	CalVerFormat     string
+	AllowDirty       bool
+	Branches         []string
+	AnyBranch        bool
+	OnExisting       string
+	ChangelogFrom    string
+	ChangelogTo      string
+
+	ChangelogExcludeMerges bool
+	ChangelogExcludeBots   bool
+	ChangelogExclude       []string
+	ChangelogIncludeOnly   []string
+	ChangelogSections      []string
+	ChangelogTemplate      string
+	ChangelogLinks         bool
+	ChangelogPRAuthors     bool
+	ChangelogContributors  bool
+	ChangelogAuthors       bool
+	ChangelogNoMentions    bool
+	ChangelogMode          string
+	ChangelogLabels        []string
+	ChangelogFile          string
+	ChangelogEmoji         string
+	ChangelogByPath        bool
+	ChangelogPaths         []string
+	ChangelogCompareLink   bool
+
+	Notes     string
+	NotesFile string
+	NotesMode string
+	EditNotes bool
+
+	NotesLanguages        []string
+	NotesLanguagesMode    string
+	NotesTranslateCommand string
+
+	NotesHeader string
+	NotesFooter string
+
+	SummaryAPIURL string
+	SummaryAPIKey string
+	SummaryModel  string
+	SummaryPrompt string
+
+	TagPrefix     string
+	ComponentPath string
+
+	VersionFiles         []string
+	VersionCommitMessage string
+
+	FetchDepth int
+	Submodules bool
+	Target     string
+
+	// ArtifactsManifest is where the artifacts are described as JSON, if set
+	ArtifactsManifest string
+	Checksums         Checksums
+	// Assets are glob patterns of extra files to upload with the release
+	Assets []string
+	// AssetLabels are pattern=label entries of the labels assets get
+	AssetLabels []string
+	// UploadParallelism is how many assets may be uploaded at once
+	UploadParallelism int
+	// UploadRetries is how many times a failed upload is retried
+	UploadRetries int
+	// SplitSize is the size above which assets are split into parts
+	SplitSize string
+	// SourceArchive releases a git archive of the released commit
+	SourceArchive bool
+	// SBOM holds the formats of the SBOMs written for every artifact
+	SBOM []string
+	// DeltaFormat is the format of the patches from the assets of earlier
+	// releases, none if empty
+	DeltaFormat string
+	// DeltaReleases is how many earlier releases get patches
+	DeltaReleases int
+
+	// Projects are the projects listed in PROJECTS, each released on its
+	// own with the PROJECT_<NAME>_* keys overriding the others
+	Projects []string
+	// Project is the project the configuration was selected for
+	Project string
+	// projectKeys holds the PROJECT_<NAME>_* entries by project
+	projectKeys map[string][]configEntry
+}
+
+// Component returns the monorepo component the configuration releases
+func (c Config) Component() Component {
+	return Component{TagPrefix: c.TagPrefix, Path: c.ComponentPath}
+}
+
+// Remote returns the git remote to release to
+func (c Config) Remote() string {
+	if c.GitRemote == "" {
+		return "origin"
+	}
+	return c.GitRemote
+}
+
+// configField describes a known configuration key. The type of the value
+// is taken from the pointer returned by field: *string, *[]string, *bool,
+// *int or *time.Duration.
+type configField struct {
+	Key      string
+	Required bool
+	field    func(c *Config) interface{}
+}
+
+// configSchema lists every key LoadConfig accepts, besides the keys of
+// named builds
+var configSchema = append([]configField{
+	{"GITHUB_TOKEN", true, func(c *Config) interface{} { return &c.GithubToken }},
+	{"PROJECTS", false, func(c *Config) interface{} { return &c.Projects }},
+	{"BUILDS", false, func(c *Config) interface{} { return &c.buildNames }},
+	{"BUILD_PARALLELISM", false, func(c *Config) interface{} { return &c.BuildParallelism }},
+	{"REPRODUCIBLE", false, func(c *Config) interface{} { return &c.Reproducible }},
+	{"BUILD_LOG", false, func(c *Config) interface{} { return &c.BuildLog }},
+	{"BUILD_LOG_DIR", false, func(c *Config) interface{} { return &c.BuildLogDir }},
+	{"BUILD_LOG_UPLOAD", false, func(c *Config) interface{} { return &c.BuildLogUpload }},
+	{"BUILD_CACHE_DIR", false, func(c *Config) interface{} { return &c.BuildCacheDir }},
+	{"BUILD_CACHE_MAX_AGE", false, func(c *Config) interface{} { return &c.BuildCacheMaxAge }},
+	{"SECRETS_FILE", false, func(c *Config) interface{} { return &c.SecretsFile }},
+	{"CONTAINER_ENGINE", false, func(c *Config) interface{} { return &c.ContainerEngine }},
+	{"HOOK_BEFORE_BUILD", false, func(c *Config) interface{} { return &c.Hooks.BeforeBuild }},
+	{"HOOK_AFTER_BUILD", false, func(c *Config) interface{} { return &c.Hooks.AfterBuild }},
+	{"HOOK_BEFORE_PUBLISH", false, func(c *Config) interface{} { return &c.Hooks.BeforePublish }},
+	{"HOOK_AFTER_PUBLISH", false, func(c *Config) interface{} { return &c.Hooks.AfterPublish }},
+	{"VERIFY_COMMAND", false, func(c *Config) interface{} { return &c.Verify.Command }},
+	{"VERIFY_TIMEOUT", false, func(c *Config) interface{} { return &c.Verify.Timeout }},
+	{"VERIFY_LOG", false, func(c *Config) interface{} { return &c.Verify.Log }},
+	{"ARTIFACTS_MANIFEST", false, func(c *Config) interface{} { return &c.ArtifactsManifest }},
+	{"ASSETS", false, func(c *Config) interface{} { return &c.Assets }},
+	{"ASSET_LABELS", false, func(c *Config) interface{} { return &c.AssetLabels }},
+	{"UPLOAD_PARALLELISM", false, func(c *Config) interface{} { return &c.UploadParallelism }},
+	{"UPLOAD_RETRIES", false, func(c *Config) interface{} { return &c.UploadRetries }},
+	{"SPLIT_SIZE", false, func(c *Config) interface{} { return &c.SplitSize }},
+	{"SOURCE_ARCHIVE", false, func(c *Config) interface{} { return &c.SourceArchive }},
+	{"SBOM", false, func(c *Config) interface{} { return &c.SBOM }},
+	{"DELTA_FORMAT", false, func(c *Config) interface{} { return &c.DeltaFormat }},
+	{"DELTA_RELEASES", false, func(c *Config) interface{} { return &c.DeltaReleases }},
+	{"CHECKSUMS", false, func(c *Config) interface{} { return &c.Checksums.Enabled }},
+	{"CHECKSUM_ALGORITHM", false, func(c *Config) interface{} { return &c.Checksums.Algorithms }},
+	{"CHECKSUMS_FILE", false, func(c *Config) interface{} { return &c.Checksums.File }},
+	{"CHECKSUM_SIDECARS", false, func(c *Config) interface{} { return &c.Checksums.Sidecars }},
+	{"PLUGINS", false, func(c *Config) interface{} { return &c.Plugins }},
+	{"GIT_REMOTE", false, func(c *Config) interface{} { return &c.GitRemote }},
+	{"GITHUB_API_URL", false, func(c *Config) interface{} { return &c.GithubAPIURL }},
+	{"CREATE_TAG", false, func(c *Config) interface{} { return &c.CreateTag }},
+	{"SIGN_TAG", false, func(c *Config) interface{} { return &c.SignTag }},
+	{"SIGNING_KEY", false, func(c *Config) interface{} { return &c.SigningKey }},
+	{"SIGNING_FORMAT", false, func(c *Config) interface{} { return &c.SigningFormat }},
+	{"NO_V_PREFIX", false, func(c *Config) interface{} { return &c.NoVPrefix }},
+	{"VERSION_SCHEME", false, func(c *Config) interface{} { return &c.VersionScheme }},
+	{"CALVER_FORMAT", false, func(c *Config) interface{} { return &c.CalVerFormat }},
+	{"ALLOW_DIRTY", false, func(c *Config) interface{} { return &c.AllowDirty }},
+	{"RELEASE_BRANCHES", false, func(c *Config) interface{} { return &c.Branches }},
+	{"ANY_BRANCH", false, func(c *Config) interface{} { return &c.AnyBranch }},
+	{"ON_EXISTING", false, func(c *Config) interface{} { return &c.OnExisting }},
+	{"CHANGELOG_FROM", false, func(c *Config) interface{} { return &c.ChangelogFrom }},
+	{"CHANGELOG_TO", false, func(c *Config) interface{} { return &c.ChangelogTo }},
+	{"CHANGELOG_EXCLUDE_MERGES", false, func(c *Config) interface{} { return &c.ChangelogExcludeMerges }},
+	{"CHANGELOG_EXCLUDE_BOTS", false, func(c *Config) interface{} { return &c.ChangelogExcludeBots }},
+	{"CHANGELOG_EXCLUDE", false, func(c *Config) interface{} { return &c.ChangelogExclude }},
+	{"CHANGELOG_INCLUDE_ONLY", false, func(c *Config) interface{} { return &c.ChangelogIncludeOnly }},
+	{"CHANGELOG_SECTIONS", false, func(c *Config) interface{} { return &c.ChangelogSections }},
+	{"CHANGELOG_TEMPLATE", false, func(c *Config) interface{} { return &c.ChangelogTemplate }},
+	{"CHANGELOG_LINKS", false, func(c *Config) interface{} { return &c.ChangelogLinks }},
+	{"CHANGELOG_PR_AUTHORS", false, func(c *Config) interface{} { return &c.ChangelogPRAuthors }},
+	{"CHANGELOG_CONTRIBUTORS", false, func(c *Config) interface{} { return &c.ChangelogContributors }},
+	{"CHANGELOG_AUTHORS", false, func(c *Config) interface{} { return &c.ChangelogAuthors }},
+	{"CHANGELOG_NO_MENTIONS", false, func(c *Config) interface{} { return &c.ChangelogNoMentions }},
+	{"CHANGELOG_MODE", false, func(c *Config) interface{} { return &c.ChangelogMode }},
+	{"CHANGELOG_LABELS", false, func(c *Config) interface{} { return &c.ChangelogLabels }},
+	{"CHANGELOG_FILE", false, func(c *Config) interface{} { return &c.ChangelogFile }},
+	{"CHANGELOG_EMOJI", false, func(c *Config) interface{} { return &c.ChangelogEmoji }},
+	{"CHANGELOG_BY_PATH", false, func(c *Config) interface{} { return &c.ChangelogByPath }},
+	{"CHANGELOG_PATHS", false, func(c *Config) interface{} { return &c.ChangelogPaths }},
+	{"CHANGELOG_COMPARE_LINK", false, func(c *Config) interface{} { return &c.ChangelogCompareLink }},
+	{"NOTES", false, func(c *Config) interface{} { return &c.Notes }},
+	{"NOTES_FILE", false, func(c *Config) interface{} { return &c.NotesFile }},
+	{"NOTES_MODE", false, func(c *Config) interface{} { return &c.NotesMode }},
+	{"EDIT_NOTES", false, func(c *Config) interface{} { return &c.EditNotes }},
+	{"NOTES_LANGUAGES", false, func(c *Config) interface{} { return &c.NotesLanguages }},
+	{"NOTES_LANGUAGES_MODE", false, func(c *Config) interface{} { return &c.NotesLanguagesMode }},
+	{"NOTES_TRANSLATE_COMMAND", false, func(c *Config) interface{} { return &c.NotesTranslateCommand }},
+	{"NOTES_HEADER", false, func(c *Config) interface{} { return &c.NotesHeader }},
+	{"NOTES_FOOTER", false, func(c *Config) interface{} { return &c.NotesFooter }},
+	{"SUMMARY_API_URL", false, func(c *Config) interface{} { return &c.SummaryAPIURL }},
+	{"SUMMARY_API_KEY", false, func(c *Config) interface{} { return &c.SummaryAPIKey }},
+	{"SUMMARY_MODEL", false, func(c *Config) interface{} { return &c.SummaryModel }},
+	{"SUMMARY_PROMPT", false, func(c *Config) interface{} { return &c.SummaryPrompt }},
+	{"TAG_PREFIX", false, func(c *Config) interface{} { return &c.TagPrefix }},
+	{"COMPONENT_PATH", false, func(c *Config) interface{} { return &c.ComponentPath }},
+	{"VERSION_FILES", false, func(c *Config) interface{} { return &c.VersionFiles }},
+	{"VERSION_COMMIT_MESSAGE", false, func(c *Config) interface{} { return &c.VersionCommitMessage }},
+	{"FETCH_DEPTH", false, func(c *Config) interface{} { return &c.FetchDepth }},
+	{"SUBMODULES", false, func(c *Config) interface{} { return &c.Submodules }},
+	{"RELEASE_TARGET", false, func(c *Config) interface{} { return &c.Target }},
+}, buildConfigFields("BUILD_", func(c *Config) *Build { return &c.Build })...)
+
+// buildField describes a key of a build, which follows BUILD_ for the
+// default build and BUILD_<NAME>_ for named builds
+type buildField struct {
+	Suffix string
+	field  func(b *Build) interface{}
+}
+
+// buildSchema lists the keys of a build
+var buildSchema = []buildField{
+	{"PATH", func(b *Build) interface{} { return &b.Path }},
+	{"COMMAND", func(b *Build) interface{} { return &b.Command }},
+	{"SCRIPT", func(b *Build) interface{} { return &b.Script }},
+	{"TOOL", func(b *Build) interface{} { return &b.Tool }},
+	{"TOOL_ARGS", func(b *Build) interface{} { return &b.ToolArgs }},
+	{"TARGETS", func(b *Build) interface{} { return &b.Targets }},
+	{"GOOS", func(b *Build) interface{} { return &b.Goos }},
+	{"GOARCH", func(b *Build) interface{} { return &b.Goarch }},
+	{"IGNORE", func(b *Build) interface{} { return &b.Ignore }},
+	{"TARGET_ENV", func(b *Build) interface{} { return &b.TargetEnv }},
+	{"MAIN", func(b *Build) interface{} { return &b.Main }},
+	{"BINARY", func(b *Build) interface{} { return &b.Binary }},
+	{"STAMP_VARS", func(b *Build) interface{} { return &b.StampVars }},
+	{"DIR", func(b *Build) interface{} { return &b.Dir }},
+	{"ENV", func(b *Build) interface{} { return &b.Env }},
+	{"IMAGE", func(b *Build) interface{} { return &b.Image }},
+	{"ARTIFACTS", func(b *Build) interface{} { return &b.Artifacts }},
+	{"CACHE", func(b *Build) interface{} { return &b.Cache }},
+	{"CGO", func(b *Build) interface{} { return &b.Cgo }},
+	{"CC", func(b *Build) interface{} { return &b.CC }},
+	{"CXX", func(b *Build) interface{} { return &b.CXX }},
+	{"ZIG", func(b *Build) interface{} { return &b.Zig }},
+	{"UNIVERSAL", func(b *Build) interface{} { return &b.Universal }},
+	{"FLAGS", func(b *Build) interface{} { return &b.Go.Flags }},
+	{"TAGS", func(b *Build) interface{} { return &b.Go.Tags }},
+	{"ASMFLAGS", func(b *Build) interface{} { return &b.Go.Asmflags }},
+	{"GCFLAGS", func(b *Build) interface{} { return &b.Go.Gcflags }},
+	{"LDFLAGS", func(b *Build) interface{} { return &b.Go.Ldflags }},
+	{"TRIMPATH", func(b *Build) interface{} { return &b.Go.Trimpath }},
+	{"TIMEOUT", func(b *Build) interface{} { return &b.Timeout }},
+	{"RETRIES", func(b *Build) interface{} { return &b.Retries }},
+	{"SECRETS", func(b *Build) interface{} { return &b.Secrets }},
+	{"FORMAT", func(b *Build) interface{} { return &b.Format }},
+	{"TARGET_FORMAT", func(b *Build) interface{} { return &b.TargetFormat }},
+	{"COMPRESSION", func(b *Build) interface{} { return &b.Compression }},
+	{"FILES", func(b *Build) interface{} { return &b.Files }},
+	{"EXCLUDE", func(b *Build) interface{} { return &b.Exclude }},
+	{"PACKAGES", func(b *Build) interface{} { return &b.Packages }},
+	{"PACKAGE_NAME", func(b *Build) interface{} { return &b.Package.Name }},
+	{"PACKAGE_MAINTAINER", func(b *Build) interface{} { return &b.Package.Maintainer }},
+	{"PACKAGE_DESCRIPTION", func(b *Build) interface{} { return &b.Package.Description }},
+	{"PACKAGE_HOMEPAGE", func(b *Build) interface{} { return &b.Package.Homepage }},
+	{"PACKAGE_LICENSE", func(b *Build) interface{} { return &b.Package.License }},
+	{"PACKAGE_DEPENDS", func(b *Build) interface{} { return &b.Package.Depends }},
+	{"PACKAGE_SYSTEMD_UNIT", func(b *Build) interface{} { return &b.Package.SystemdUnit }},
+	{"PACKAGE_CONFIG_FILES", func(b *Build) interface{} { return &b.Package.ConfigFiles }},
+	{"PACKAGE_SIGN_COMMAND", func(b *Build) interface{} { return &b.Package.SignCommand }},
+	{"INSTALLERS", func(b *Build) interface{} { return &b.Installers }},
+	{"INSTALLER_APP_NAME", func(b *Build) interface{} { return &b.Installer.AppName }},
+	{"INSTALLER_PUBLISHER", func(b *Build) interface{} { return &b.Installer.Publisher }},
+	{"INSTALLER_DIR", func(b *Build) interface{} { return &b.Installer.Dir }},
+	{"INSTALLER_SHORTCUTS", func(b *Build) interface{} { return &b.Installer.Shortcuts }},
+	{"INSTALLER_UPGRADE_CODE", func(b *Build) interface{} { return &b.Installer.UpgradeCode }},
+	{"DMG_BACKGROUND", func(b *Build) interface{} { return &b.Installer.DMGBackground }},
+	{"DMG_WINDOW_SIZE", func(b *Build) interface{} { return &b.Installer.DMGWindowSize }},
+	{"DMG_ICON_SIZE", func(b *Build) interface{} { return &b.Installer.DMGIconSize }},
+	{"DMG_ICONS", func(b *Build) interface{} { return &b.Installer.DMGIcons }},
+	{"PKG_IDENTIFIER", func(b *Build) interface{} { return &b.Installer.PkgIdentifier }},
+	{"PKG_INSTALL_LOCATION", func(b *Build) interface{} { return &b.Installer.PkgInstallLocation }},
+	{"PKG_SIGN_IDENTITY", func(b *Build) interface{} { return &b.Installer.PkgSignIdentity }},
+	{"APPIMAGE_ICON", func(b *Build) interface{} { return &b.Installer.AppImageIcon }},
+	{"APPIMAGE_DESKTOP_FILE", func(b *Build) interface{} { return &b.Installer.AppImageDesktopFile }},
+	{"APPIMAGE_EXEC", func(b *Build) interface{} { return &b.Installer.AppImageExec }},
+	{"APPIMAGE_CATEGORIES", func(b *Build) interface{} { return &b.Installer.AppImageCategories }},
+	{"APPIMAGE_TERMINAL", func(b *Build) interface{} { return &b.Installer.AppImageTerminal }},
+	{"WRAP", func(b *Build) interface{} { return &b.Wrap }},
+	{"WRAP_TEMPLATE", func(b *Build) interface{} { return &b.WrapTemplate }},
+	{"NAME_TEMPLATE", func(b *Build) interface{} { return &b.NameTemplate }},
+}
+
+// buildConfigFields returns the config keys of a build's fields
+func buildConfigFields(prefix string, build func(c *Config) *Build) []configField {
+	var fields []configField
+	for _, bf := range buildSchema {
+		bf := bf
+		fields = append(fields, configField{prefix + bf.Suffix, false, func(c *Config) interface{} { return bf.field(build(c)) }})
+	}
+	return fields
+}
+
+// buildKey returns the key prefix of a named build, e.g. BUILD_WEB_UI_ for
+// web-ui
+func buildKey(name string) string {
+	return "BUILD_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_"
+}
+
+// configEntry is a KEY=VALUE line of the config file
+type configEntry struct {
+	Key      string
+	Value    string
+	Location string
+}
+
+// configConflicts lists groups of keys that can't be set together
+var configConflicts = [][]string{
+	{"NOTES", "NOTES_FILE"},
+}
+
+// envPrefix starts the names of the environment variables setting keys, so
+// that the ones CI systems and other tools set aren't taken for them
+const envPrefix = "GRELEASER_"
+
+// envKey returns the environment variable setting a key. GITHUB_TOKEN is
+// read as is, as CI systems provide it.
+func envKey(key string) string {
+	if key == "GITHUB_TOKEN" {
+		return key
+	}
+	return envPrefix + key
+}
+
+// lookupConfigEnv returns the environment variable setting a key and its
+// value. The unprefixed variable is still read when the prefixed one isn't
+// set, with a deprecation warning, for setups from before the prefix.
+func lookupConfigEnv(key string) (string, string, bool) {
+	name := envKey(key)
+	if value := os.Getenv(name); value != "" {
+		return name, value, true
+	}
+	if name == key {
+		return "", "", false
+	}
+	value := os.Getenv(key)
+	if value == "" {
+		return "", "", false
+	}
+	ui.Printf("Warning: environment variable %s is deprecated, set %s instead\n", key, name)
+	return key, value, true
+}
+
+// LoadConfig loads configuration from environment file
+func LoadConfig(envFile string) (Config, error) {
+	config := Config{UploadRetries: defaultUploadRetries, DeltaReleases: defaultDeltaReleases}
+
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return config, err
+		}
+		ui.Printf("Warning: %s not found\n", envFile)
+		// Don't return here - continue to check environment variables
+	}
+
+	schema := make(map[string]configField, len(configSchema))
+	for _, f := range configSchema {
+		schema[f.Key] = f
+	}
+
+	// Where each key was set, for error messages
+	sources := map[string]string{}
+	var problems []string
+
+	set := func(f configField, value, location string) {
+		if prev, ok := sources[f.Key]; ok {
+			problems = append(problems, fmt.Sprintf("%s: %s already set at %s", location, f.Key, prev))
+			return
+		}
+		if err := setConfigValue(&config, f, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s: %v", location, f.Key, err))
+			return
+		}
+		sources[f.Key] = location
+	}
+
+	// Keys of named builds and projects are only known once BUILDS and
+	// PROJECTS are
+	var pending []configEntry
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		location := fmt.Sprintf("%s:%d", envFile, i+1)
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			problems = append(problems, fmt.Sprintf("%s: expected KEY=VALUE, got %q", location, line))
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := unquote(strings.TrimSpace(parts[1]))
+
+		f, ok := schema[key]
+		if !ok {
+			pending = append(pending, configEntry{key, value, location})
+			continue
+		}
+
+		// An empty value leaves the key to the environment
+		if value == "" {
+			continue
+		}
+		set(f, value, location)
+	}
+
+	// Check environment variables if not found in file
+	lookupEnv := func(fields []configField) {
+		for _, f := range fields {
+			if _, ok := sources[f.Key]; ok {
+				continue
+			}
+			name, value, ok := lookupConfigEnv(f.Key)
+			if !ok {
+				continue
+			}
+			location := fmt.Sprintf("environment variable %s", name)
+			if err := setConfigValue(&config, f, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", location, err))
+				continue
+			}
+			sources[f.Key] = location
+		}
+	}
+	lookupEnv(configSchema)
+
+	var buildFields []configField
+	for i, name := range config.buildNames {
+		i := i
+		config.Builds = append(config.Builds, Build{Name: name})
+		buildFields = append(buildFields, buildConfigFields(buildKey(name), func(c *Config) *Build { return &c.Builds[i] })...)
+	}
+	for _, f := range buildFields {
+		schema[f.Key] = f
+	}
+	for _, p := range pending {
+		f, ok := schema[p.Key]
+		if !ok {
+			if name := config.projectOf(p.Key); name != "" {
+				if config.projectKeys == nil {
+					config.projectKeys = map[string][]configEntry{}
+				}
+				config.projectKeys[name] = append(config.projectKeys[name], p)
+				continue
+			}
+			msg := fmt.Sprintf("%s: unknown key %s", p.Location, p.Key)
+			if suggestion := suggestKey(p.Key); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			problems = append(problems, msg)
+			continue
+		}
+		if p.Value != "" {
+			set(f, p.Value, p.Location)
+		}
+	}
+	lookupEnv(buildFields)
+
+	for _, group := range configConflicts {
+		var set []string
+		for _, key := range group {
+			if source, ok := sources[key]; ok {
+				set = append(set, fmt.Sprintf("%s (%s)", key, source))
+			}
+		}
+		if len(set) > 1 {
+			problems = append(problems, fmt.Sprintf("options are mutually exclusive: %s", strings.Join(set, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return config, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	// Projects are checked once one is selected
+	if len(config.Projects) > 0 {
+		return config, nil
+	}
+	if missing := config.missingFields(); len(missing) > 0 {
+		return config, fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+
+	return config, nil
+}
+
+// missingFields returns the required keys the configuration lacks
+func (c Config) missingFields() []string {
+	var missingFields []string
+	for _, f := range configSchema {
+		if value, ok := f.field(&c).(*string); f.Required && ok && *value == "" {
+			missingFields = append(missingFields, f.Key)
+		}
+	}
+	// Every build needs an output path, except for prebuilt artifacts and
+	// tools with a conventional one, and the default build is only optional
+	// next to named builds
+	if c.Build.OutputPath() == "" && len(c.Build.Artifacts) == 0 && (len(c.Builds) == 0 || c.Build.Configured()) {
+		missingFields = append(missingFields, "BUILD_PATH")
+	}
+	for _, b := range c.Builds {
+		if b.OutputPath() == "" && len(b.Artifacts) == 0 {
+			missingFields = append(missingFields, buildKey(b.Name)+"PATH")
+		}
+	}
+	return missingFields
+}
+
+// setConfigValue parses value according to the field's type and stores it
+func setConfigValue(config *Config, f configField, value string) error {
+	switch ptr := f.field(config).(type) {
+	case *string:
+		*ptr = value
+	case *[]string:
+		*ptr = splitList(value)
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		*ptr = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		*ptr = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 90s or 10m, got %q", value)
+		}
+		*ptr = d
+	default:
+		return fmt.Errorf("unsupported config type %T", ptr)
+	}
+	return nil
+}
+
+// suggestKey returns the known key closest to an unknown one, if any is
+// close enough to plausibly be a typo
+func suggestKey(key string) string {
+	best, bestDist := "", 3
+	keys := make([]string, 0, len(configSchema))
+	for _, f := range configSchema {
+		keys = append(keys, f.Key)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if d := editDistance(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// unquote removes a pair of quotes around a value, keeping quotes that
+// only end it, as in a shell command like sh -c 'echo hi'
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// splitList splits a comma-separated config value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
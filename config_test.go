@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a .release.env with lines to a temporary directory
+func writeConfig(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".release.env")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigProblems(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name:  "unknown key",
+			lines: []string{"GITHUB_TOKEN=x", "BUILD_COMMAND=make", "BUILD_PAHT=dist"},
+			want:  []string{".release.env:3: unknown key BUILD_PAHT (did you mean BUILD_PATH?)"},
+		},
+		{
+			name:  "wrong type",
+			lines: []string{"GITHUB_TOKEN=x", "BUILD_PATH=dist", "", "UPLOAD_RETRIES=many"},
+			want:  []string{".release.env:4: UPLOAD_RETRIES: expected a number"},
+		},
+		{
+			name:  "conflicting keys",
+			lines: []string{"GITHUB_TOKEN=x", "BUILD_PATH=dist", "NOTES=Hello", "NOTES_FILE=notes.md"},
+			want:  []string{"options are mutually exclusive: NOTES (", ".release.env:3", "NOTES_FILE (", ".release.env:4"},
+		},
+		{
+			name:  "malformed line",
+			lines: []string{"GITHUB_TOKEN=x", "BUILD_PATH"},
+			want:  []string{`.release.env:2: expected KEY=VALUE, got "BUILD_PATH"`},
+		},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfig(writeConfig(t, tt.lines...))
+		if err == nil {
+			t.Errorf("%s: LoadConfig succeeded", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q doesn't mention %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestLoadConfigEnvironment(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		env   map[string]string
+		want  string
+	}{
+		{
+			name:  "file",
+			lines: []string{"BUILD_PATH=dist"},
+			env:   map[string]string{"GRELEASER_BUILD_PATH": "env"},
+			want:  "dist",
+		},
+		{
+			name:  "empty value in the file",
+			lines: []string{"BUILD_PATH="},
+			env:   map[string]string{"GRELEASER_BUILD_PATH": "env"},
+			want:  "env",
+		},
+		{
+			name: "prefixed variable",
+			env:  map[string]string{"GRELEASER_BUILD_PATH": "env"},
+			want: "env",
+		},
+		{
+			name: "deprecated unprefixed variable",
+			env:  map[string]string{"BUILD_PATH": "legacy"},
+			want: "legacy",
+		},
+		{
+			name: "prefixed variable over unprefixed one",
+			env:  map[string]string{"GRELEASER_BUILD_PATH": "env", "BUILD_PATH": "legacy"},
+			want: "env",
+		},
+	}
+	for _, tt := range tests {
+		t.Setenv("GITHUB_TOKEN", "x")
+		t.Setenv("GRELEASER_BUILD_PATH", "")
+		t.Setenv("BUILD_PATH", "")
+		for k, v := range tt.env {
+			t.Setenv(k, v)
+		}
+		config, err := LoadConfig(writeConfig(t, tt.lines...))
+		if err != nil {
+			t.Errorf("%s: LoadConfig failed: %v", tt.name, err)
+			continue
+		}
+		if config.GithubToken != "x" {
+			t.Errorf("%s: GITHUB_TOKEN = %q, want it from the environment", tt.name, config.GithubToken)
+		}
+		if got := config.Build.Path; got != tt.want {
+			t.Errorf("%s: BUILD_PATH = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
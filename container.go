@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// buildRunner creates the commands of a build, run on the host or, if an
+// image is set, in a container
+type buildRunner struct {
+	// Image is the container image to build in, empty to build on the host
+	Image string
+	// Engine is the container CLI, docker or podman
+	Engine string
+	// Dir is the working directory, relative to the repository root
+	Dir string
+	// Env holds the KEY=VALUE variables set for the build. Host builds
+	// inherit the process environment as well, container builds don't.
+	Env []string
+	// Cache is the build's cache directory, if it has one
+	Cache string
+}
+
+// Runner returns the runner of a build's commands, using the cache
+// directory unless it's empty
+func (b Build) Runner(info BuildInfo, engine, cache string) buildRunner {
+	env := info.Env()
+	if cache != "" {
+		env = append(env, cacheEnv(cache)...)
+	}
+	for _, entry := range b.Env {
+		key, value, _ := strings.Cut(entry, "=")
+		env = append(env, strings.TrimSpace(key)+"="+value)
+	}
+	return buildRunner{Image: b.Image, Engine: engine, Dir: b.Dir, Env: env, Cache: cache}
+}
+
+// Command returns a command running name with args, with extra variables
+// added to the build's environment. It's killed when ctx is done.
+func (r buildRunner) Command(ctx context.Context, extra []string, name string, args ...string) (*exec.Cmd, error) {
+	env := append(append([]string{}, r.Env...), extra...)
+	if r.Image == "" {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = r.Dir
+		cmd.Env = append(os.Environ(), env...)
+		cmd.WaitDelay = killWaitDelay
+		return cmd, nil
+	}
+
+	engine, err := containerEngine(r.Engine)
+	if err != nil {
+		return nil, err
+	}
+	// The repository is mounted at the same path as on the host, so
+	// absolute paths such as go build's output mean the same inside
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	run := []string{"run", "--rm", "-v", root + ":" + root, "-w", filepath.Join(root, r.Dir)}
+	if r.Cache != "" {
+		run = append(run, "-v", r.Cache+":"+r.Cache)
+	}
+	// Docker runs as root by default, which would leave root-owned build
+	// output behind. Rootless podman maps root to the invoking user.
+	if filepath.Base(engine) != "podman" && runtime.GOOS != "windows" {
+		run = append(run, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+		env = append(env, "HOME=/tmp")
+	}
+	// Values are passed through the engine's environment rather than its
+	// arguments, which other users can see
+	for _, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		run = append(run, "-e", key)
+	}
+	run = append(run, r.Image, name)
+	run = append(run, args...)
+
+	cmd := exec.CommandContext(ctx, engine, run...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = killWaitDelay
+	return cmd, nil
+}
+
+// killWaitDelay bounds the wait for a killed command's output, which its
+// child processes may hold open
+const killWaitDelay = 5 * time.Second
+
+// Shell returns the arguments running command with the shell: sh, or cmd
+// for host builds on Windows
+func (r buildRunner) Shell(command string) []string {
+	if r.Image == "" && runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
+
+// ShellScript returns the arguments running a script file with the shell
+func (r buildRunner) ShellScript(path string) []string {
+	if r.Image == "" && runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", path}
+	}
+	return []string{"sh", path}
+}
+
+// containerEngine resolves the container CLI: the configured one, or
+// docker or podman, whichever is installed
+func containerEngine(engine string) (string, error) {
+	switch engine {
+	case "docker", "podman":
+		path, err := exec.LookPath(engine)
+		if err != nil {
+			return "", fmt.Errorf("CONTAINER_ENGINE %s not found: %w", engine, err)
+		}
+		return path, nil
+	case "":
+		for _, name := range []string{"docker", "podman"} {
+			if path, err := exec.LookPath(name); err == nil {
+				return path, nil
+			}
+		}
+		return "", fmt.Errorf("building in a container needs docker or podman, neither was found")
+	default:
+		return "", fmt.Errorf("unknown CONTAINER_ENGINE %q (expected docker or podman)", engine)
+	}
+}
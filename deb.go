@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// debArchs maps GOARCH values to Debian architectures
+var debArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "amd64",
+	"arm":      "armhf",
+	"arm64":    "arm64",
+	"loong64":  "loong64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64le": "mips64el",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64el",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// writeDeb builds a .deb package in dir: an ar archive of the format
+// version, the control files and the installed files
+func writeDeb(dir string, p linuxPackage) (string, error) {
+	arch, ok := debArchs[p.Arch]
+	if !ok {
+		return "", fmt.Errorf("no Debian architecture for %s", p.Arch)
+	}
+
+	data, sums, size, err := debData(p)
+	if err != nil {
+		return "", err
+	}
+	control, err := debControl(p, arch, sums, size)
+	if err != nil {
+		return "", err
+	}
+
+	var deb bytes.Buffer
+	deb.WriteString("!<arch>\n")
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", control},
+		{"data.tar.gz", data},
+	} {
+		fmt.Fprintf(&deb, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, p.Date.Unix(), 0, 0, "100644", len(member.data))
+		deb.Write(member.data)
+		if len(member.data)%2 == 1 {
+			deb.WriteByte('\n')
+		}
+	}
+
+	out := filepath.Join(dir, fmt.Sprintf("%s_%s_%s.deb", p.Name, packageVersion(p.Version), arch))
+	if err := os.WriteFile(out, deb.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// debData returns the data.tar.gz of the installed files, their md5sums
+// and their size
+func debData(p linuxPackage) ([]byte, string, int64, error) {
+	var sums strings.Builder
+	var size int64
+	tarball, err := gzipTar(func(tw *tar.Writer) error {
+		for _, dir := range p.dirs() {
+			if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "." + dir + "/", Mode: 0755, ModTime: p.Date}); err != nil {
+				return err
+			}
+		}
+		for _, f := range p.Files {
+			content, err := os.ReadFile(f.Src)
+			if err != nil {
+				return err
+			}
+			header := &tar.Header{Typeflag: tar.TypeReg, Name: "." + f.Dst, Mode: f.Mode, Size: int64(len(content)), ModTime: p.Date}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(content); err != nil {
+				return err
+			}
+			sum := md5.Sum(content)
+			fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), strings.TrimPrefix(f.Dst, "/"))
+			size += int64(len(content))
+		}
+		return nil
+	})
+	return tarball, sums.String(), size, err
+}
+
+// debControl returns the control.tar.gz of a package
+func debControl(p linuxPackage, arch, sums string, size int64) ([]byte, error) {
+	var control strings.Builder
+	fmt.Fprintf(&control, "Package: %s\n", p.Name)
+	fmt.Fprintf(&control, "Version: %s\n", packageVersion(p.Version))
+	fmt.Fprintf(&control, "Architecture: %s\n", arch)
+	fmt.Fprintf(&control, "Maintainer: %s\n", p.Maintainer)
+	fmt.Fprintf(&control, "Installed-Size: %d\n", (size+1023)/1024)
+	if len(p.Depends) > 0 {
+		fmt.Fprintf(&control, "Depends: %s\n", strings.Join(p.Depends, ", "))
+	}
+	control.WriteString("Section: utils\nPriority: optional\n")
+	if p.Homepage != "" {
+		fmt.Fprintf(&control, "Homepage: %s\n", p.Homepage)
+	}
+	fmt.Fprintf(&control, "Description: %s\n", p.Description)
+
+	var conffiles strings.Builder
+	for _, f := range p.Files {
+		if f.Config {
+			fmt.Fprintln(&conffiles, f.Dst)
+		}
+	}
+
+	postinst, prerm, postrm := p.systemdScripts(`[ "$1" = remove ]`)
+	files := []struct {
+		name, content string
+		mode          int64
+	}{
+		{"control", control.String(), 0644},
+		{"md5sums", sums, 0644},
+		{"conffiles", conffiles.String(), 0644},
+		{"postinst", postinst, 0755},
+		{"prerm", prerm, 0755},
+		{"postrm", postrm, 0755},
+	}
+	return gzipTar(func(tw *tar.Writer) error {
+		for _, f := range files {
+			if f.content == "" {
+				continue
+			}
+			header := &tar.Header{Typeflag: tar.TypeReg, Name: "./" + f.name, Mode: f.mode, Size: int64(len(f.content)), ModTime: p.Date}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(tw, f.content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// gzipTar returns a gzipped tarball of what write adds to it. Entries
+// belong to root.
+func gzipTar(write func(tw *tar.Writer) error) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := write(tw); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Delta patch formats
+const (
+	DeltaZstd   = "zstd"
+	DeltaBsdiff = "bsdiff"
+)
+
+// deltaFormats lists the supported DELTA_FORMAT values
+var deltaFormats = []string{DeltaZstd, DeltaBsdiff}
+
+// deltaSuffixes end the names of the patches of each format
+var deltaSuffixes = map[string]string{
+	DeltaZstd:   ".zstpatch",
+	DeltaBsdiff: ".bsdiff",
+}
+
+// defaultDeltaReleases is how many earlier releases get patches unless
+// DELTA_RELEASES says otherwise
+const defaultDeltaReleases = 1
+
+// patchManifestPath is where the patches manifest is written
+const patchManifestPath = "dist/patches.json"
+
+// deltaTypes are the artifact types patches are made for. SBOMs, notes and
+// the like are small enough to download whole.
+var deltaTypes = map[string]bool{
+	ArtifactArchive:   true,
+	ArtifactBinary:    true,
+	ArtifactPackage:   true,
+	ArtifactInstaller: true,
+	ArtifactPrebuilt:  true,
+	ArtifactAsset:     true,
+}
+
+// Patch describes a patch in the patches manifest
+type Patch struct {
+	// From is the version the patch applies to
+	From string `json:"from"`
+	// Asset is the name of the asset the patch rebuilds, and Patch the
+	// patch's
+	Asset  string `json:"asset"`
+	Patch  string `json:"patch"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	// FromSHA256 and SHA256 are the checksums of the asset of the earlier
+	// release and of the rebuilt one
+	FromSHA256 string `json:"from_sha256"`
+	SHA256     string `json:"sha256"`
+}
+
+// PatchManifest maps the earlier versions to the patches updating their
+// assets to this release's
+type PatchManifest struct {
+	Version string  `json:"version"`
+	Patches []Patch `json:"patches"`
+}
+
+// ValidateDelta checks DELTA_FORMAT and DELTA_RELEASES
+func ValidateDelta(format string, releases int) error {
+	if format == "" {
+		return nil
+	}
+	if _, ok := deltaSuffixes[format]; !ok {
+		return fmt.Errorf("unknown DELTA_FORMAT %q (expected %s)", format, strings.Join(deltaFormats, ", "))
+	}
+	if releases < 0 {
+		return fmt.Errorf("DELTA_RELEASES must not be negative")
+	}
+	return nil
+}
+
+// deltaTags returns the tags of the stable releases before the released
+// commit, most recent first, up to n of them. The release's own tag is
+// skipped, for re-releases.
+func deltaTags(comp Component, target, tag string, n int) []string {
+	var tags []string
+	for ref := target; len(tags) < n; {
+		previous, err := comp.latestTag(ref)
+		if err != nil {
+			break
+		}
+		if previous != tag {
+			tags = append(tags, previous)
+		}
+		ref = previous + "^"
+	}
+	return tags
+}
+
+// WritePatches writes binary patches from the assets of the DELTA_RELEASES
+// earlier releases to the artifacts of the same names, their versions
+// aside if they have any, and the manifest listing them. An asset an earlier
+// release split into parts is joined again. A patch that isn't smaller than
+// the artifact is left out, and so are releases without a GitHub release
+// and assets they don't have. Without DELTA_FORMAT it does nothing.
+func (g *GitHubReleaser) WritePatches(info BuildInfo, artifacts []Artifact) ([]Artifact, error) {
+	format := g.config.DeltaFormat
+	if format == "" {
+		return nil, nil
+	}
+	tool, err := exec.LookPath(format)
+	if err != nil {
+		return nil, fmt.Errorf("%s patches need %s: %w", format, format, err)
+	}
+	tmp, err := os.MkdirTemp("", "greleaser-delta-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest := PatchManifest{Version: info.Version, Patches: []Patch{}}
+	var patches []Artifact
+	comp := g.config.Component()
+	for _, tag := range deltaTags(comp, info.Commit, info.Tag, g.config.DeltaReleases) {
+		release, err := g.GetReleaseByTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if release == nil {
+			continue
+		}
+		assets, err := g.ReleaseAssets(release)
+		if err != nil {
+			return nil, err
+		}
+		byName := map[string]githubAsset{}
+		for _, a := range assets {
+			byName[a.Name] = a
+		}
+
+		from := strings.TrimPrefix(strings.TrimPrefix(tag, comp.TagPrefix), "v")
+		for _, a := range artifacts {
+			name := strings.ReplaceAll(a.Name, info.Version, from)
+			parts := assetParts(byName, name)
+			if !deltaTypes[a.Type] || len(parts) == 0 {
+				continue
+			}
+			// Names without a version are the same in every release
+			oldPath := filepath.Join(tmp, tag, name)
+			if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+				ui.Step("Downloading %s from %s", name, tag)
+				if err := g.downloadJoined(parts, oldPath); err != nil {
+					return nil, err
+				}
+			}
+
+			path := filepath.FromSlash(a.Path)
+			out := fmt.Sprintf("%s.from-%s%s", path, from, deltaSuffixes[format])
+			ui.Step("Writing %s", filepath.Base(out))
+			if err := writePatch(tool, format, oldPath, path, out); err != nil {
+				return nil, fmt.Errorf("failed to write the patch of %s from %s: %w", a.Name, from, err)
+			}
+			sum, size, err := fileSHA256(path)
+			if err != nil {
+				return nil, err
+			}
+			patch := newArtifact(out, ArtifactPatch)
+			stat, err := os.Stat(out)
+			if err != nil {
+				return nil, err
+			}
+			if patch.Size = stat.Size(); patch.Size >= size {
+				ui.Printf("Skipping %s, which is no smaller than %s\n", patch.Name, a.Name)
+				os.Remove(out)
+				continue
+			}
+			fromSum, _, err := fileSHA256(oldPath)
+			if err != nil {
+				return nil, err
+			}
+			patch.Platform, patch.Build = a.Platform, a.Build
+			patches = append(patches, patch)
+			manifest.Patches = append(manifest.Patches, Patch{
+				From:       from,
+				Asset:      a.Name,
+				Patch:      patch.Name,
+				Format:     format,
+				Size:       patch.Size,
+				FromSHA256: fromSum,
+				SHA256:     sum,
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(patchManifestPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(patchManifestPath, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", patchManifestPath, err)
+	}
+	return append(patches, newArtifact(patchManifestPath, ArtifactPatchManifest)), nil
+}
+
+// assetParts returns the asset of a release named name, or its parts if
+// SPLIT_SIZE split it, in order. It returns nothing if there's neither.
+func assetParts(byName map[string]githubAsset, name string) []githubAsset {
+	if a, ok := byName[name]; ok {
+		return []githubAsset{a}
+	}
+	var parts []githubAsset
+	for n := 1; ; n++ {
+		part, ok := byName[fmt.Sprintf("%s.part%d", name, n)]
+		if !ok {
+			return parts
+		}
+		parts = append(parts, part)
+	}
+}
+
+// downloadJoined downloads assets into one file at path, joining the parts
+// of a split file
+func (g *GitHubReleaser) downloadJoined(parts []githubAsset, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if len(parts) == 1 {
+		return g.DownloadAsset(parts[0], path)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, part := range parts {
+		partPath := path + filepath.Ext(part.Name)
+		if err := g.DownloadAsset(part, partPath); err != nil {
+			return err
+		}
+		err := appendFile(out, partPath)
+		os.Remove(partPath)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// appendFile copies the file at path to the end of out
+func appendFile(out *os.File, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// writePatch writes the patch turning the file at oldPath into the one at
+// newPath
+func writePatch(tool, format, oldPath, newPath, out string) error {
+	var cmd *exec.Cmd
+	switch format {
+	case DeltaZstd:
+		cmd = exec.Command(tool, "-q", "-f", "-19", "--patch-from="+oldPath, newPath, "-o", out)
+	case DeltaBsdiff:
+		cmd = exec.Command(tool, oldPath, newPath, out)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", filepath.Base(tool), err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
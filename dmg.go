@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writeDMG builds a disk image of a macOS app in dir, holding its files at
+// the top of the volume. create-dmg lays out the window; without it, or any
+// DMG_* layout, hdiutil builds a plain image.
+func writeDMG(dir string, app desktopApp) (string, error) {
+	out := filepath.Join(dir, app.installerName("darwin", ".dmg"))
+	volume := fmt.Sprintf("%s %s", app.AppName, app.Version)
+	args, layout := dmgLayout(app)
+
+	tool, err := exec.LookPath("create-dmg")
+	if err != nil {
+		if layout {
+			return "", fmt.Errorf("dmg layouts need create-dmg: %w", err)
+		}
+		if tool, err = exec.LookPath("hdiutil"); err != nil {
+			return "", fmt.Errorf("dmg installers need create-dmg or hdiutil: %w", err)
+		}
+	}
+
+	tmp, err := os.MkdirTemp("", "greleaser-dmg-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := app.stage(tmp); err != nil {
+		return "", err
+	}
+	// Both tools refuse to replace the image of an earlier run
+	if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	if filepath.Base(tool) == "hdiutil" {
+		cmd = exec.Command(tool, "create", "-volname", volume, "-srcfolder", tmp, "-format", "UDZO", "-ov", out)
+	} else {
+		args = append([]string{"--volname", volume, "--no-internet-enable"}, args...)
+		cmd = exec.Command(tool, append(args, out, tmp)...)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", filepath.Base(tool), err, strings.TrimSpace(output.String()))
+	}
+	return out, nil
+}
+
+// dmgLayout returns the create-dmg options of the DMG_* keys, and whether
+// there are any
+func dmgLayout(app desktopApp) ([]string, bool) {
+	var args []string
+	if app.DMGBackground != "" {
+		args = append(args, "--background", app.DMGBackground)
+	}
+	if width, height, ok := parsePair(app.DMGWindowSize, "x"); ok {
+		args = append(args, "--window-size", strconv.Itoa(width), strconv.Itoa(height))
+	}
+	if app.DMGIconSize > 0 {
+		args = append(args, "--icon-size", strconv.Itoa(app.DMGIconSize))
+	}
+	for _, entry := range app.DMGIcons {
+		name, position, _ := strings.Cut(entry, "=")
+		x, y, _ := parsePair(position, ":")
+		if name = strings.TrimSpace(name); name == "Applications" {
+			args = append(args, "--app-drop-link", strconv.Itoa(x), strconv.Itoa(y))
+		} else {
+			args = append(args, "--icon", name, strconv.Itoa(x), strconv.Itoa(y))
+		}
+	}
+	return args, len(args) > 0
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitOutput runs a git command and returns its trimmed output
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// sameCommit reports whether two refs point at the same commit
+func sameCommit(a, b string) bool {
+	ca, err := gitOutput("rev-parse", "--verify", "--quiet", a+"^{commit}")
+	if err != nil {
+		return false
+	}
+	cb, err := gitOutput("rev-parse", "--verify", "--quiet", b+"^{commit}")
+	return err == nil && ca == cb
+}
+
+// Component scopes tags and commits to one part of a monorepo. The zero
+// value covers the whole repository.
+type Component struct {
+	// TagPrefix is prepended to version tags, e.g. "api/" for api/v1.2.0
+	TagPrefix string
+	// Path limits commits to those touching this directory
+	Path string
+}
+
+// Name returns a display name for the component, or "" for the whole repository
+func (c Component) Name() string {
+	return strings.Trim(c.TagPrefix, "/-_@")
+}
+
+// NightlyTag returns the rolling tag nightly releases are published under
+func (c Component) NightlyTag() string {
+	return c.TagPrefix + "nightly"
+}
+
+// describeArgs limits git describe to the component's version tags. The
+// whole repository excludes components' tags such as api/v1.2.0, and the
+// rolling nightly tag is never a version.
+func (c Component) describeArgs(pattern string) []string {
+	args := []string{"describe", "--tags", "--match", c.TagPrefix + pattern, "--exclude", c.NightlyTag()}
+	if c.TagPrefix == "" {
+		args = append(args, "--exclude", "*/*")
+	}
+	return args
+}
+
+// LatestTag returns the most recent stable tag reachable from HEAD.
+// Pre-release tags (v1.2.0-rc.1) are skipped so channel releases don't
+// affect stable version history.
+func (c Component) LatestTag() (string, error) {
+	return c.latestTag("HEAD")
+}
+
+// latestTag is LatestTag for any ref
+func (c Component) latestTag(ref string) (string, error) {
+	return gitOutput(append(c.describeArgs("*"), "--abbrev=0", "--exclude", c.TagPrefix+"*-*", ref)...)
+}
+
+// PreviousTag returns the tag the changelog of a release at ref starts
+// from: the latest stable tag, or for a pre-release channel, the latest tag
+// of that channel if it is more recent
+func (c Component) PreviousTag(channel, ref string) (string, error) {
+	stable, err := c.latestTag(ref)
+	if channel == "" {
+		return stable, err
+	}
+
+	channelTag, channelErr := gitOutput(append(c.describeArgs("*-"+channel+".*"), "--abbrev=0", ref)...)
+	if channelErr != nil {
+		return stable, err
+	}
+	if err != nil {
+		return channelTag, nil
+	}
+
+	if exec.Command("git", "merge-base", "--is-ancestor", stable, channelTag).Run() == nil {
+		return channelTag, nil
+	}
+	return stable, nil
+}
+
+// HeadTag returns the component's tag pointing at HEAD, if any
+func (c Component) HeadTag() (string, error) {
+	return gitOutput(append(c.describeArgs("*"), "--exact-match", "HEAD")...)
+}
+
+// Tags lists the component's tags, with the prefix removed
+func (c Component) Tags(pattern string) ([]string, error) {
+	out, err := gitOutput("tag", "--list", c.TagPrefix+pattern)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, tag := range strings.Fields(out) {
+		tags = append(tags, strings.TrimPrefix(tag, c.TagPrefix))
+	}
+	return tags, nil
+}
+
+// Commits returns the commits in a revision range that touch the component
+func (c Component) Commits(revRange string) ([]Commit, error) {
+	return CommitsInRange(revRange, c.Path)
+}
+
+// EnterGitRoot changes to the root of the repository the working directory
+// is in, so that the config file, BUILD_PATH and remote detection behave
+// the same from any subdirectory, and returns it
+func EnterGitRoot() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the working directory: %w", err)
+	}
+	root, err := FindGitRoot(cwd)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chdir(root); err != nil {
+		return "", fmt.Errorf("failed to change to the repository root: %w", err)
+	}
+	return root, nil
+}
+
+// FindGitRoot walks up from dir until it finds a directory containing .git.
+// Like git itself, a .git file (worktrees, submodules) counts as a match.
+func FindGitRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("not a git repository (or any of the parent directories)")
+		}
+		dir = parent
+	}
+}
+
+// ParseRemoteURL extracts the host, owner and repository name from a git
+// remote URL. It accepts scp-like (git@host:owner/repo.git), ssh://, git://
+// and http(s):// forms, with or without a .git suffix or trailing slash.
+// The host keeps a non-default port of http(s) URLs, which is the web
+// server's too, but not the port of ssh:// ones.
+func ParseRemoteURL(raw string) (host, owner, repo string, err error) {
+	raw = strings.TrimSpace(raw)
+
+	var path string
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", "", "", fmt.Errorf("invalid remote URL %q: %w", raw, err)
+		}
+		host, path = u.Hostname(), u.Path
+		if port := u.Port(); port != "" && (u.Scheme == "https" && port != "443" || u.Scheme == "http" && port != "80") {
+			host = u.Host
+		}
+	} else {
+		// scp-like syntax: [user@]host:path
+		i := strings.Index(raw, ":")
+		if i < 0 {
+			return "", "", "", fmt.Errorf("unsupported remote URL %q", raw)
+		}
+		host, path = raw[:i], raw[i+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if host == "" || len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", "", fmt.Errorf("cannot determine owner/repo from remote URL %q", raw)
+	}
+
+	return strings.ToLower(host), parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// remoteScheme returns the scheme of the web server behind a git remote:
+// http for a plain HTTP remote, and https for every other form
+func remoteScheme(raw string) string {
+	if u, err := url.Parse(strings.TrimSpace(raw)); err == nil && u.Scheme == "http" {
+		return "http"
+	}
+	return "https"
+}
+
+// TagSigning configures how created tags are signed
+type TagSigning struct {
+	Enabled bool
+	// Key is a GPG key ID or SSH key path; git's user.signingkey is used if empty
+	Key string
+	// Format is "gpg" (default) or "ssh"
+	Format string
+}
+
+// args returns the git arguments that sign a tag
+func (s TagSigning) args() ([]string, error) {
+	var args []string
+	switch s.Format {
+	case "", "gpg":
+	case "ssh":
+		args = append(args, "-c", "gpg.format=ssh")
+	default:
+		return nil, fmt.Errorf("unsupported signing format %q (expected gpg or ssh)", s.Format)
+	}
+
+	key := s.Key
+	if key == "" {
+		key, _ = gitOutput("config", "--get", "user.signingkey")
+	}
+	if key == "" {
+		return nil, fmt.Errorf("tag signing requested but no signing key is configured (set SIGNING_KEY or git config user.signingkey)")
+	}
+
+	return append(args, "tag", "--sign", "--local-user="+key), nil
+}
+
+// CreateTag creates an annotated tag on commit, signed if requested. An
+// existing tag is accepted only if it already points at the commit and,
+// when signing is requested, carries a valid signature.
+func CreateTag(name, commit, message string, signing TagSigning) error {
+	if existing, err := gitOutput("rev-list", "-n", "1", "refs/tags/"+name); err == nil {
+		if existing != commit {
+			return fmt.Errorf("tag %s already exists at %s, not %s", name, existing, commit)
+		}
+		if signing.Enabled {
+			if err := exec.Command("git", "verify-tag", name).Run(); err != nil {
+				return fmt.Errorf("existing tag %s is not validly signed", name)
+			}
+		}
+		return nil
+	}
+
+	args := []string{"tag", "--annotate"}
+	if signing.Enabled {
+		var err error
+		if args, err = signing.args(); err != nil {
+			return err
+		}
+	}
+	args = append(args, "--cleanup=verbatim", "--file=-", name, commit)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(message)
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	if err := cmd.Run(); err != nil {
+		if signing.Enabled {
+			return fmt.Errorf("failed to sign tag %s, check your signing setup: %w", name, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// MoveTag points a rolling tag such as "nightly" at commit and
+// force-pushes it to the given remote
+func MoveTag(remote, name, commit string) error {
+	if err := exec.Command("git", "tag", "--force", name, commit).Run(); err != nil {
+		return fmt.Errorf("failed to move tag %s: %w", name, err)
+	}
+
+	cmd := exec.Command("git", "push", "--force", remote, "refs/tags/"+name)
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	return cmd.Run()
+}
+
+// PushBranch pushes the current branch to the given remote
+func PushBranch(remote string) error {
+	branch := CurrentBranch()
+	if branch == "" {
+		return fmt.Errorf("cannot push from a detached HEAD outside a CI branch build")
+	}
+
+	cmd := exec.Command("git", "push", remote, "HEAD:refs/heads/"+branch)
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	return cmd.Run()
+}
+
+// PushTag pushes a tag to the given remote
+func PushTag(remote, name string) error {
+	cmd := exec.Command("git", "push", remote, "refs/tags/"+name)
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	return cmd.Run()
+}
+
+// CheckClean returns an error listing uncommitted changes, if any
+func CheckClean() error {
+	status, err := gitOutput("status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return fmt.Errorf("working tree has uncommitted changes:\n%s", status)
+	}
+	return nil
+}
+
+// IsShallow reports whether the repository is a shallow clone
+func IsShallow() bool {
+	out, err := gitOutput("rev-parse", "--is-shallow-repository")
+	return err == nil && out == "true"
+}
+
+// FetchHistory fetches the tags and history missing from a shallow clone.
+// A depth of 0 fetches the full history, otherwise the history is deepened
+// by that many commits.
+func FetchHistory(remote string, depth int) error {
+	args := []string{"fetch", "--tags"}
+	if depth > 0 {
+		args = append(args, fmt.Sprintf("--deepen=%d", depth))
+	} else {
+		args = append(args, "--unshallow")
+	}
+	args = append(args, remote)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	return cmd.Run()
+}
+
+// CheckPushed returns an error if ref isn't on any branch of the remote
+func CheckPushed(remote, ref string) error {
+	branches, err := gitOutput("branch", "--remotes", "--contains", ref, "--list", remote+"/*")
+	if err != nil {
+		return err
+	}
+	if branches == "" {
+		return fmt.Errorf("%s is not pushed to %s", ref, remote)
+	}
+	return nil
+}
+
+// CurrentBranch returns the checked-out branch. On a detached HEAD, as in
+// most CI checkouts, it falls back to the branch the CI system reports, or
+// "" if there is none.
+func CurrentBranch() string {
+	branch, err := gitOutput("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return CIBranch()
+	}
+	return branch
+}
+
+// CIBranch returns the branch a CI build runs for, from the environment
+// variables of common CI systems, or "" outside CI and for tag builds
+func CIBranch() string {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		// Pull request builds check out a merge commit of the head branch
+		if ref := os.Getenv("GITHUB_HEAD_REF"); ref != "" {
+			return ref
+		}
+		if os.Getenv("GITHUB_REF_TYPE") == "branch" {
+			return os.Getenv("GITHUB_REF_NAME")
+		}
+		return ""
+	}
+
+	for _, key := range []string{
+		"CI_COMMIT_BRANCH", // GitLab
+		"BUILDKITE_BRANCH", // Buildkite
+		"CIRCLE_BRANCH",    // CircleCI
+		"BRANCH_NAME",      // Jenkins multibranch pipelines
+	} {
+		if branch := os.Getenv(key); branch != "" {
+			return branch
+		}
+	}
+	return ""
+}
+
+// SetCIOutput sets a step output in GitHub Actions, for later steps of the
+// workflow. Elsewhere it does nothing.
+func SetCIOutput(name, value string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to set output %s: %w", name, err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s=%s\n", name, value)
+	return err
+}
+
+// CheckBranch returns an error unless ref is on a branch matching one of
+// the allowed patterns (path.Match globs such as release/*). For HEAD the
+// checked-out branch counts; other refs, and a detached HEAD outside CI,
+// pass if a matching branch on the remote contains them.
+func CheckBranch(allowed []string, remote, ref string) error {
+	matches := func(branch string) bool {
+		for _, pattern := range allowed {
+			if ok, _ := path.Match(pattern, branch); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if branch := CurrentBranch(); ref == "HEAD" && branch != "" {
+		if !matches(branch) {
+			return fmt.Errorf("releases are only allowed from %s, not %s", strings.Join(allowed, ", "), branch)
+		}
+		return nil
+	}
+
+	out, err := gitOutput("branch", "--remotes", "--contains", ref, "--format=%(refname:short)")
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Fields(out) {
+		if branch, ok := strings.CutPrefix(name, remote+"/"); ok && matches(branch) {
+			return nil
+		}
+	}
+	if ref == "HEAD" {
+		return fmt.Errorf("detached HEAD is not on any of %s", strings.Join(allowed, ", "))
+	}
+	return fmt.Errorf("%s is not on any of %s", ref, strings.Join(allowed, ", "))
+}
+
+// Submodule is a checked-out git submodule
+type Submodule struct {
+	Path   string
+	Commit string
+}
+
+// UpdateSubmodules checks out all submodules, recursively, at the commits
+// recorded in the superproject
+func UpdateSubmodules() error {
+	cmd := exec.Command("git", "submodule", "update", "--init", "--recursive")
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	return cmd.Run()
+}
+
+// Submodules lists the submodules, recursively, with their commits
+func Submodules() ([]Submodule, error) {
+	out, err := gitOutput("submodule", "status", "--recursive")
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []Submodule
+	for _, line := range strings.Split(out, "\n") {
+		// Lines look like " <sha> <path> (<describe>)", where the first
+		// column flags uninitialized or modified submodules
+		fields := strings.Fields(strings.TrimLeft(line, " -+U"))
+		if len(fields) < 2 {
+			continue
+		}
+		subs = append(subs, Submodule{Path: fields[1], Commit: fields[0]})
+	}
+	return subs, nil
+}
+
+// RemoteTagCommit returns the commit a tag points at on the remote, or ""
+// if the remote has no such tag
+func RemoteTagCommit(remote, tag string) (string, error) {
+	out, err := gitOutput("ls-remote", "--tags", remote, "refs/tags/"+tag, "refs/tags/"+tag+"^{}")
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags on %s: %w", remote, err)
+	}
+
+	// Annotated tags are listed twice, and the peeled ^{} entry is the commit
+	commit := ""
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.HasSuffix(fields[1], "^{}") || commit == "" {
+			commit = fields[0]
+		}
+	}
+	return commit, nil
+}
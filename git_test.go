@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRemoteURL(t *testing.T) {
+	tests := []struct {
+		raw         string
+		host        string
+		owner, repo string
+		api         string
+	}{
+		{"git@github.com:me/app.git", "github.com", "me", "app", "https://api.github.com"},
+		{"https://github.com/me/app", "github.com", "me", "app", "https://api.github.com"},
+		{"https://github.com:443/me/app.git/", "github.com", "me", "app", "https://api.github.com"},
+		{"https://token@GitHub.com/me/app.git", "github.com", "me", "app", "https://api.github.com"},
+		{"ssh://git@github.com/me/app.git", "github.com", "me", "app", "https://api.github.com"},
+		{"ssh://git@ghe.example.com:2222/org/app.git", "ghe.example.com", "org", "app", "https://ghe.example.com/api/v3"},
+		{"git@ghe.example.com:org/app.git", "ghe.example.com", "org", "app", "https://ghe.example.com/api/v3"},
+		{"ghe.example.com:org/app", "ghe.example.com", "org", "app", "https://ghe.example.com/api/v3"},
+		{"https://ghe.example.com:8443/org/app.git", "ghe.example.com:8443", "org", "app", "https://ghe.example.com:8443/api/v3"},
+		{"http://ghe.example.com:80/org/app", "ghe.example.com", "org", "app", "http://ghe.example.com/api/v3"},
+		{"http://ghe.internal:8080/owner/repo", "ghe.internal:8080", "owner", "repo", "http://ghe.internal:8080/api/v3"},
+		{"git://ghe.example.com/group/sub/app.git", "ghe.example.com", "sub", "app", "https://ghe.example.com/api/v3"},
+	}
+	for _, tt := range tests {
+		host, owner, repo, err := ParseRemoteURL(tt.raw)
+		if err != nil {
+			t.Errorf("ParseRemoteURL(%q) failed: %v", tt.raw, err)
+			continue
+		}
+		if host != tt.host || owner != tt.owner || repo != tt.repo {
+			t.Errorf("ParseRemoteURL(%q) = %q, %q, %q, want %q, %q, %q", tt.raw, host, owner, repo, tt.host, tt.owner, tt.repo)
+		}
+		scheme := remoteScheme(tt.raw)
+		if api := defaultAPIURL(scheme, host); api != tt.api {
+			t.Errorf("defaultAPIURL(%q, %q) = %q, want %q", scheme, host, api, tt.api)
+		}
+	}
+}
+
+func TestParseRemoteURLInvalid(t *testing.T) {
+	for _, raw := range []string{"", "app", "https://github.com/app", "git@github.com:", "/srv/git/app.git"} {
+		if _, _, _, err := ParseRemoteURL(raw); err == nil {
+			t.Errorf("ParseRemoteURL(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestEnterGitRoot(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	nested := filepath.Join(root, "cmd", "app")
+	for _, dir := range []string{nested, filepath.Join(root, "dist")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ".release.env"), []byte("GITHUB_TOKEN=x\nBUILD_PATH=dist\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "dist", "app.zip"), []byte("zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GRELEASER_BUILD_PATH", "")
+	t.Setenv("BUILD_PATH", "")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+	if err := os.Chdir(nested); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := EnterGitRoot()
+	if err != nil {
+		t.Fatalf("EnterGitRoot failed: %v", err)
+	}
+	if got != root {
+		t.Errorf("EnterGitRoot() = %q, want %q", got, root)
+	}
+	config, err := LoadConfig(".release.env")
+	if err != nil {
+		t.Fatalf("LoadConfig from %s failed: %v", nested, err)
+	}
+	if config.Build.Path != "dist" {
+		t.Fatalf("BUILD_PATH = %q, want dist", config.Build.Path)
+	}
+	// Relative paths resolve against the root, not the directory run from
+	abs, err := filepath.Abs(filepath.Join(config.Build.Path, "app.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "dist", "app.zip"); abs != want {
+		t.Errorf("BUILD_PATH resolves to %q, want %q", abs, want)
+	}
+	if _, err := os.Stat(abs); err != nil {
+		t.Errorf("BUILD_PATH doesn't resolve to the built files: %v", err)
+	}
+}
+
+func TestFindGitRoot(t *testing.T) {
+	root := t.TempDir()
+	// Worktrees and submodules have a .git file instead of a directory
+	if err := os.WriteFile(filepath.Join(root, ".git"), []byte("gitdir: /elsewhere\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(root, "a", "b", "c")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{root, nested} {
+		got, err := FindGitRoot(dir)
+		if err != nil {
+			t.Errorf("FindGitRoot(%q) failed: %v", dir, err)
+			continue
+		}
+		if got != root {
+			t.Errorf("FindGitRoot(%q) = %q, want %q", dir, got, root)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubAsset describes a release asset returned by the GitHub API
+type githubAsset struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	// State is "uploaded" once the upload completed. Failed uploads leave
+	// assets in other states behind.
+	State string `json:"state"`
+}
+
+// githubRelease describes a release returned by the GitHub API
+type githubRelease struct {
+	ID        int64         `json:"id"`
+	TagName   string        `json:"tag_name"`
+	HTMLURL   string        `json:"html_url"`
+	UploadURL string        `json:"upload_url"`
+	Assets    []githubAsset `json:"assets"`
+}
+
+// apiError turns an unexpected GitHub API response into an error
+func apiError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("failed to %s: %s", action, body)
+}
+
+// webURL returns the repository's page on GitHub
+func (g *GitHubReleaser) webURL() string {
+	return fmt.Sprintf("%s://%s/%s/%s", g.scheme, g.host, g.ownerName, g.repoName)
+}
+
+// compareURL links to the diff between two refs on GitHub
+func (g *GitHubReleaser) compareURL(from, to string) string {
+	return fmt.Sprintf("%s/compare/%s...%s", g.webURL(), from, to)
+}
+
+// repoURL returns the API endpoint of the repository
+func (g *GitHubReleaser) repoURL() string {
+	return fmt.Sprintf("%s/repos/%s/%s", g.apiURL, g.ownerName, g.repoName)
+}
+
+// releasesURL returns the releases API endpoint for the repository
+func (g *GitHubReleaser) releasesURL() string {
+	return g.repoURL() + "/releases"
+}
+
+// getJSON fetches an API endpoint and decodes the response into v
+func (g *GitHubReleaser) getJSON(action, url string, v interface{}) error {
+	resp, err := g.makeRequest("GET", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(action, resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GenerateNotes asks GitHub to generate release notes for a tag from the
+// pull requests merged since the previous tag, or since the beginning if
+// previous is empty
+func (g *GitHubReleaser) GenerateNotes(tag, target, previous string) (string, error) {
+	data := map[string]string{"tag_name": tag}
+	if target != "" {
+		data["target_commitish"] = target
+	}
+	if previous != "" {
+		data["previous_tag_name"] = previous
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	resp, err := g.makeRequest("POST", g.releasesURL()+"/generate-notes", bytes.NewBuffer(jsonData), headers)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", apiError("generate release notes", resp)
+	}
+
+	var notes struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&notes); err != nil {
+		return "", err
+	}
+	return notes.Body, nil
+}
+
+// CommitAuthor returns the login of the GitHub user a commit's author email
+// belongs to, or "" if it isn't linked to an account
+func (g *GitHubReleaser) CommitAuthor(sha string) (string, error) {
+	var commit struct {
+		Author *struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	}
+	if err := g.getJSON("look up commit "+sha, fmt.Sprintf("%s/commits/%s", g.repoURL(), sha), &commit); err != nil {
+		return "", err
+	}
+	if commit.Author == nil {
+		return "", nil
+	}
+	return commit.Author.Login, nil
+}
+
+// PullRequestAuthor returns the login of the user who opened a pull request
+func (g *GitHubReleaser) PullRequestAuthor(number int) (string, error) {
+	var pr struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	}
+	if err := g.getJSON(fmt.Sprintf("look up pull request #%d", number), fmt.Sprintf("%s/pulls/%d", g.repoURL(), number), &pr); err != nil {
+		return "", err
+	}
+	return pr.User.Login, nil
+}
+
+// pullRequest is a merged pull request listed by MergedPullRequests
+type pullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	MergedAt       *time.Time `json:"merged_at"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// MergedPullRequests returns the pull requests merged since a time, or all
+// merged pull requests if since is zero, most recently updated first
+func (g *GitHubReleaser) MergedPullRequests(since time.Time) ([]pullRequest, error) {
+	var merged []pullRequest
+	for page := 1; ; page++ {
+		var prs []pullRequest
+		url := fmt.Sprintf("%s/pulls?state=closed&sort=updated&direction=desc&per_page=100&page=%d", g.repoURL(), page)
+		if err := g.getJSON("list pull requests", url, &prs); err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			if pr.MergedAt != nil && !pr.MergedAt.Before(since) {
+				merged = append(merged, pr)
+			}
+		}
+		// Pull requests merged since then were updated since then too
+		if len(prs) < 100 || prs[len(prs)-1].UpdatedAt.Before(since) {
+			return merged, nil
+		}
+	}
+}
+
+// GetReleaseByTag returns the release for a tag, or nil if there is none
+func (g *GitHubReleaser) GetReleaseByTag(tag string) (*githubRelease, error) {
+	resp, err := g.makeRequest("GET", fmt.Sprintf("%s/tags/%s", g.releasesURL(), url.PathEscape(tag)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("look up release", resp)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// saveRelease creates a release, or updates it if id is non-zero
+func (g *GitHubReleaser) saveRelease(id int64, data map[string]interface{}) (*githubRelease, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	method, url, status := "POST", g.releasesURL(), http.StatusCreated
+	if id != 0 {
+		method, url, status = "PATCH", fmt.Sprintf("%s/%d", g.releasesURL(), id), http.StatusOK
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	resp, err := g.makeRequest(method, url, bytes.NewBuffer(jsonData), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		if id != 0 {
+			return nil, apiError("update release", resp)
+		}
+		return nil, apiError("create release", resp)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// ReleaseAssets lists the assets of a release
+func (g *GitHubReleaser) ReleaseAssets(release *githubRelease) ([]githubAsset, error) {
+	var assets []githubAsset
+	for page := 1; ; page++ {
+		var batch []githubAsset
+		url := fmt.Sprintf("%s/%d/assets?per_page=100&page=%d", g.releasesURL(), release.ID, page)
+		if err := g.getJSON("list release assets", url, &batch); err != nil {
+			return nil, err
+		}
+		assets = append(assets, batch...)
+		if len(batch) < 100 {
+			return assets, nil
+		}
+	}
+}
+
+// DeleteAsset removes a release asset
+func (g *GitHubReleaser) DeleteAsset(asset githubAsset) error {
+	url := fmt.Sprintf("%s/assets/%d", g.releasesURL(), asset.ID)
+	resp, err := g.makeRequest("DELETE", url, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return apiError(fmt.Sprintf("delete asset %s", asset.Name), resp)
+	}
+	return nil
+}
+
+// DownloadAsset streams a release asset into a file at path. GitHub
+// redirects to the file's storage, which doesn't get the token.
+func (g *GitHubReleaser) DownloadAsset(asset githubAsset, path string) error {
+	url := fmt.Sprintf("%s/assets/%d", g.releasesURL(), asset.ID)
+	resp, err := g.makeRequest("GET", url, nil, map[string]string{"Accept": "application/octet-stream"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(fmt.Sprintf("download asset %s", asset.Name), resp)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	body := ui.TrackReader(asset.Name, resp.Body, asset.Size)
+	defer ui.Untrack(body)
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to download asset %s: %w", asset.Name, err)
+	}
+	return file.Close()
+}
+
+// UploadAsset streams a file to a release as the request body, with an
+// optional label shown instead of its name, returning the new asset
+func (g *GitHubReleaser) UploadAsset(release *githubRelease, path, label string) (*githubAsset, error) {
+	name := filepath.Base(path)
+	uploadURL := strings.Split(release.UploadURL, "{")[0] + "?name=" + url.QueryEscape(name)
+	if label != "" {
+		uploadURL += "&label=" + url.QueryEscape(label)
+	}
+
+	// The file is streamed rather than read into memory, since assets can
+	// be larger than the runner's memory
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"Content-Type":   assetContentType(name),
+		"Content-Length": strconv.FormatInt(info.Size(), 10),
+	}
+	body := ui.TrackReader(name, file, info.Size())
+	defer ui.Untrack(body)
+	resp, err := g.makeRequest("POST", uploadURL, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, apiError("upload asset", resp)
+	}
+
+	var asset githubAsset
+	if err := json.NewDecoder(resp.Body).Decode(&asset); err != nil {
+		return nil, fmt.Errorf("failed to decode uploaded asset: %w", err)
+	}
+	return &asset, nil
+}
+
+// assetContentTypes are the media types of release assets by extension,
+// for those the mime package doesn't know or gets wrong for downloads
+var assetContentTypes = map[string]string{
+	".zip":    "application/zip",
+	".gz":     "application/gzip",
+	".tgz":    "application/gzip",
+	".zst":    "application/zstd",
+	".xz":     "application/x-xz",
+	".tar":    "application/x-tar",
+	".deb":    "application/vnd.debian.binary-package",
+	".rpm":    "application/x-rpm",
+	".apk":    "application/octet-stream",
+	".json":   "application/json",
+	".md":     "text/markdown; charset=utf-8",
+	".txt":    "text/plain; charset=utf-8",
+	".sha1":   "text/plain; charset=utf-8",
+	".sha256": "text/plain; charset=utf-8",
+	".sha512": "text/plain; charset=utf-8",
+	".blake3": "text/plain; charset=utf-8",
+	".asc":    "application/pgp-signature",
+	".sig":    "application/pgp-signature",
+}
+
+// assetContentType returns the Content-Type of an asset upload. Checksums
+// files are text, and anything unknown is binary.
+func assetContentType(name string) string {
+	if strings.HasSuffix(name, "SUMS") {
+		return "text/plain; charset=utf-8"
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := assetContentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// gitmoji describes an emoji from https://gitmoji.dev and the conventional
+// commit type it stands for
+type gitmoji struct {
+	Shortcode string
+	Emoji     string
+	Type      string
+	Breaking  bool
+}
+
+// gitmojis lists the common gitmojis, spelled as on gitmoji.dev. Subjects
+// may leave out the variation selector U+FE0F.
+var gitmojis = []gitmoji{
+	{Shortcode: ":sparkles:", Emoji: "✨", Type: "feat"},
+	{Shortcode: ":tada:", Emoji: "🎉", Type: "feat"},
+	{Shortcode: ":globe_with_meridians:", Emoji: "🌐", Type: "feat"},
+	{Shortcode: ":wheelchair:", Emoji: "♿", Type: "feat"},
+	{Shortcode: ":lipstick:", Emoji: "💄", Type: "feat"},
+	{Shortcode: ":boom:", Emoji: "💥", Type: "feat", Breaking: true},
+	{Shortcode: ":bug:", Emoji: "🐛", Type: "fix"},
+	{Shortcode: ":ambulance:", Emoji: "🚑\ufe0f", Type: "fix"},
+	{Shortcode: ":adhesive_bandage:", Emoji: "🩹", Type: "fix"},
+	{Shortcode: ":lock:", Emoji: "🔒\ufe0f", Type: "fix"},
+	{Shortcode: ":pencil2:", Emoji: "✏\ufe0f", Type: "fix"},
+	{Shortcode: ":zap:", Emoji: "⚡\ufe0f", Type: "perf"},
+	{Shortcode: ":memo:", Emoji: "📝", Type: "docs"},
+	{Shortcode: ":recycle:", Emoji: "♻\ufe0f", Type: "refactor"},
+	{Shortcode: ":truck:", Emoji: "🚚", Type: "refactor"},
+	{Shortcode: ":art:", Emoji: "🎨", Type: "style"},
+	{Shortcode: ":white_check_mark:", Emoji: "✅", Type: "test"},
+	{Shortcode: ":arrow_up:", Emoji: "⬆\ufe0f", Type: "build"},
+	{Shortcode: ":arrow_down:", Emoji: "⬇\ufe0f", Type: "build"},
+	{Shortcode: ":heavy_plus_sign:", Emoji: "➕", Type: "build"},
+	{Shortcode: ":heavy_minus_sign:", Emoji: "➖", Type: "build"},
+	{Shortcode: ":construction_worker:", Emoji: "👷", Type: "ci"},
+	{Shortcode: ":green_heart:", Emoji: "💚", Type: "ci"},
+	{Shortcode: ":rewind:", Emoji: "⏪", Type: "revert"},
+	{Shortcode: ":wrench:", Emoji: "🔧", Type: "chore"},
+	{Shortcode: ":fire:", Emoji: "🔥", Type: "chore"},
+	{Shortcode: ":rocket:", Emoji: "🚀", Type: "chore"},
+	{Shortcode: ":bookmark:", Emoji: "🔖", Type: "chore"},
+	{Shortcode: ":construction:", Emoji: "🚧", Type: "chore"},
+}
+
+// shortcodeRe matches a leading :emoji: shortcode
+var shortcodeRe = regexp.MustCompile(`^:[a-z0-9_+-]+:\s*`)
+
+// splitGitmoji splits a leading gitmoji or :shortcode: off a subject. The
+// returned gitmoji has only a Shortcode for shortcodes it doesn't know.
+func splitGitmoji(subject string) (gitmoji, string, bool) {
+	if m := shortcodeRe.FindString(subject); m != "" {
+		code := strings.TrimSpace(m)
+		for _, g := range gitmojis {
+			if g.Shortcode == code {
+				return g, subject[len(m):], true
+			}
+		}
+		return gitmoji{Shortcode: code}, subject[len(m):], true
+	}
+
+	for _, g := range gitmojis {
+		if rest, ok := strings.CutPrefix(subject, strings.TrimSuffix(g.Emoji, "\ufe0f")); ok {
+			rest = strings.TrimPrefix(rest, "\ufe0f")
+			return g, strings.TrimLeft(rest, " "), true
+		}
+	}
+	return gitmoji{}, subject, false
+}
+
+// String returns the emoji, or the shortcode for unknown ones
+func (g gitmoji) String() string {
+	if g.Emoji != "" {
+		return g.Emoji
+	}
+	return g.Shortcode
+}
+
+// StyleGitmojis renders the commits' gitmojis in the CHANGELOG_EMOJI style:
+// "unicode" (default), "shortcode" or "strip". GitHub renders shortcodes in
+// release notes too, so unknown ones are kept as they are.
+func StyleGitmojis(commits []Commit, style string) error {
+	switch style {
+	case "", "unicode", "shortcode", "strip":
+	default:
+		return fmt.Errorf("unknown CHANGELOG_EMOJI %q (expected unicode, shortcode or strip)", style)
+	}
+
+	for i, c := range commits {
+		if c.Gitmoji == "" {
+			continue
+		}
+		g, _, _ := splitGitmoji(c.Gitmoji)
+		switch style {
+		case "strip":
+			commits[i].Gitmoji = ""
+		case "shortcode":
+			commits[i].Gitmoji = g.Shortcode
+		default:
+			commits[i].Gitmoji = g.String()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Hooks are commands run around the build and publish steps, next to the
+// plugin events of the same name
+type Hooks struct {
+	BeforeBuild   string
+	AfterBuild    string
+	BeforePublish string
+	AfterPublish  string
+}
+
+// RunHook runs a hook command with the shell, with the build info in its
+// environment and the paths of the release's artifacts in
+// RELEASE_ARTIFACTS, separated by spaces. An empty command does nothing.
+func RunHook(key, command string, info BuildInfo, artifacts []string) error {
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+
+	ui.Step("Running %s", key)
+	parts := buildRunner{}.Shell(command)
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Env = append(os.Environ(), info.Env()...)
+	cmd.Env = append(cmd.Env, "RELEASE_ARTIFACTS="+strings.Join(artifacts, " "))
+	cmd.Stdout = ui.Output()
+	cmd.Stderr = ui.Output()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", key, err)
+	}
+	return nil
+}
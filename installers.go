@@ -0,0 +1,430 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Installer formats, each for the targets of one operating system
+const (
+	InstallerNSIS = "nsis"
+	InstallerMSI  = "msi"
+	InstallerDMG  = "dmg"
+	InstallerPKG  = "pkg"
+	// InstallerAppImage is a portable application, not an installer, but
+	// it's built from the same description
+	InstallerAppImage = "appimage"
+)
+
+// installerOS maps the INSTALLERS formats to the GOOS of their targets
+var installerOS = map[string]string{
+	InstallerNSIS: "windows",
+	InstallerMSI:  "windows",
+	InstallerDMG:  "darwin",
+	InstallerPKG:  "darwin",
+
+	InstallerAppImage: "linux",
+}
+
+// installerFormats lists the supported INSTALLERS values
+var installerFormats = []string{InstallerNSIS, InstallerMSI, InstallerDMG, InstallerPKG, InstallerAppImage}
+
+// InstallerInfo describes the installers of a Go build's desktop targets.
+// The package metadata, such as the description and homepage, is shared
+// with them.
+type InstallerInfo struct {
+	// AppName is the application's display name, the package's or binary's
+	// name by default
+	AppName string
+	// Publisher is shown as the application's vendor, the package
+	// maintainer by default
+	Publisher string
+	// Dir is the installation directory's name, in Program Files on
+	// Windows, AppName by default
+	Dir string
+	// Shortcuts hold Label=file entries of Start Menu shortcuts to the
+	// installed files
+	Shortcuts []string
+	// UpgradeCode identifies the application across MSI versions, derived
+	// from its name by default
+	UpgradeCode string
+
+	// DMG window layout: the background image, the window's WxH size, the
+	// icons' size, and Name=X:Y positions of the top-level entries, an
+	// Applications entry being a link to /Applications
+	DMGBackground string
+	DMGWindowSize string
+	DMGIconSize   int
+	DMGIcons      []string
+
+	// PkgIdentifier is the reverse-DNS identifier of .pkg installers, such
+	// as com.example.tool
+	PkgIdentifier string
+	// PkgInstallLocation is where .pkg installers put the files,
+	// /usr/local/bin by default
+	PkgInstallLocation string
+	// PkgSignIdentity is the Developer ID Installer identity in the
+	// keychain .pkg installers are signed with, if any
+	PkgSignIdentity string
+
+	// AppImageIcon is the PNG or SVG icon of AppImages
+	AppImageIcon string
+	// AppImageDesktopFile is the desktop entry of AppImages, generated from
+	// the other keys if empty
+	AppImageDesktopFile string
+	// AppImageExec is the installed file AppImages run, the binary by
+	// default
+	AppImageExec string
+	// AppImageCategories are the desktop entry's menu categories, Utility
+	// by default
+	AppImageCategories []string
+	// AppImageTerminal marks the application as one that runs in a
+	// terminal
+	AppImageTerminal bool
+}
+
+// pkgIdentifierPattern matches a reverse-DNS package identifier
+var pkgIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+
+// guidPattern matches a GUID such as an MSI upgrade code
+var guidPattern = regexp.MustCompile(`^\{?[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}?$`)
+
+// validateInstallers checks the INSTALLERS and INSTALLER_* keys of a build
+func (b Build) validateInstallers() error {
+	if len(b.Installers) == 0 {
+		return nil
+	}
+	if !b.goMatrix() {
+		return fmt.Errorf("%s only applies to Go builds", b.Key("INSTALLERS"))
+	}
+	for _, format := range b.Installers {
+		if _, ok := installerOS[format]; !ok {
+			return fmt.Errorf("unknown %s format %q (expected %s)", b.Key("INSTALLERS"), format, strings.Join(installerFormats, ", "))
+		}
+		if format == InstallerMSI && b.Installer.Publisher == "" && b.Package.Maintainer == "" {
+			return fmt.Errorf("%s or %s is required for MSI installers", b.Key("INSTALLER_PUBLISHER"), b.Key("PACKAGE_MAINTAINER"))
+		}
+		if format == InstallerPKG && b.Installer.PkgIdentifier == "" {
+			return fmt.Errorf("%s is required for pkg installers", b.Key("PKG_IDENTIFIER"))
+		}
+		if format == InstallerAppImage && b.Installer.AppImageIcon == "" {
+			return fmt.Errorf("%s is required for AppImages", b.Key("APPIMAGE_ICON"))
+		}
+	}
+	i := b.Installer
+	if strings.ContainsAny(i.Dir, `/\:`) {
+		return fmt.Errorf("invalid %s %q (expected a directory name)", b.Key("INSTALLER_DIR"), i.Dir)
+	}
+	for _, entry := range i.Shortcuts {
+		label, file, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(label) == "" || !validInstallerPath(file) {
+			return fmt.Errorf("invalid %s entry %q (expected Label=file, relative to the installation directory)", b.Key("INSTALLER_SHORTCUTS"), entry)
+		}
+	}
+	if i.UpgradeCode != "" && !guidPattern.MatchString(i.UpgradeCode) {
+		return fmt.Errorf("invalid %s %q (expected a GUID)", b.Key("INSTALLER_UPGRADE_CODE"), i.UpgradeCode)
+	}
+	if err := b.validateMacInstallers(); err != nil {
+		return err
+	}
+	return b.validateAppImage()
+}
+
+// validateMacInstallers checks the DMG_* and PKG_* keys of a build
+func (b Build) validateMacInstallers() error {
+	i := b.Installer
+	if i.DMGBackground != "" {
+		if _, err := os.Stat(i.DMGBackground); err != nil {
+			return fmt.Errorf("%s: %w", b.Key("DMG_BACKGROUND"), err)
+		}
+	}
+	if i.DMGWindowSize != "" {
+		if _, _, ok := parsePair(i.DMGWindowSize, "x"); !ok {
+			return fmt.Errorf("invalid %s %q (expected WIDTHxHEIGHT)", b.Key("DMG_WINDOW_SIZE"), i.DMGWindowSize)
+		}
+	}
+	if i.DMGIconSize < 0 {
+		return fmt.Errorf("%s must not be negative", b.Key("DMG_ICON_SIZE"))
+	}
+	for _, entry := range i.DMGIcons {
+		name, position, ok := strings.Cut(entry, "=")
+		if _, _, valid := parsePair(position, ":"); !ok || !valid || strings.TrimSpace(name) == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid %s entry %q (expected Name=X:Y)", b.Key("DMG_ICONS"), entry)
+		}
+	}
+	if i.PkgIdentifier != "" && !pkgIdentifierPattern.MatchString(i.PkgIdentifier) {
+		return fmt.Errorf("invalid %s %q (expected a reverse-DNS identifier such as com.example.tool)", b.Key("PKG_IDENTIFIER"), i.PkgIdentifier)
+	}
+	if i.PkgInstallLocation != "" && !path.IsAbs(i.PkgInstallLocation) {
+		return fmt.Errorf("%s must be an absolute path", b.Key("PKG_INSTALL_LOCATION"))
+	}
+	return nil
+}
+
+// parsePair parses two non-negative integers separated by sep, such as
+// 640x480
+func parsePair(value, sep string) (int, int, bool) {
+	first, second, ok := strings.Cut(strings.TrimSpace(value), sep)
+	if !ok {
+		return 0, 0, false
+	}
+	a, errA := strconv.Atoi(strings.TrimSpace(first))
+	b, errB := strconv.Atoi(strings.TrimSpace(second))
+	return a, b, errA == nil && errB == nil && a >= 0 && b >= 0
+}
+
+// validInstallerPath reports whether name is a relative path inside the
+// installation directory
+func validInstallerPath(name string) bool {
+	name = strings.ReplaceAll(strings.TrimSpace(name), `\`, "/")
+	clean := path.Clean(name)
+	return name != "" && !path.IsAbs(name) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// installerFile is a file an installer installs
+type installerFile struct {
+	// Src is where it is, Name its slash-separated path in the
+	// installation directory
+	Src  string
+	Name string
+	Mode os.FileMode
+}
+
+// desktopApp is what the installers of a Go target are built from
+type desktopApp struct {
+	InstallerInfo
+	PackageInfo
+	Version string
+	// Arch is the GOARCH of the target
+	Arch string
+	// Binary is the name of the executable in the installation directory
+	Binary string
+	Files  []installerFile
+	// Date is the time the files get, as in the archives
+	Date time.Time
+}
+
+// dirs returns the directories the app's files are in, parents first
+func (a desktopApp) dirs() []string {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, f := range a.Files {
+		var parents []string
+		for dir := path.Dir(f.Name); dir != "."; dir = path.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// shortcuts returns the labels and files of the Start Menu shortcuts
+func (a desktopApp) shortcuts() (labels, files []string) {
+	for _, entry := range a.Shortcuts {
+		label, file, _ := strings.Cut(entry, "=")
+		labels = append(labels, strings.TrimSpace(label))
+		files = append(files, path.Clean(strings.ReplaceAll(strings.TrimSpace(file), `\`, "/")))
+	}
+	return labels, files
+}
+
+// fileVersion returns the numeric major.minor.patch.0 version Windows
+// installers need. Pre-releases and build metadata are left out.
+func (a desktopApp) fileVersion() string {
+	release, _, _ := strings.Cut(a.Version, "-")
+	release, _, _ = strings.Cut(release, "+")
+	parts := strings.Split(release, ".")
+	numbers := make([]string, 4)
+	for i := range numbers {
+		numbers[i] = "0"
+		if i < len(parts) {
+			if n, err := strconv.Atoi(parts[i]); err == nil && n >= 0 {
+				numbers[i] = strconv.Itoa(n)
+			}
+		}
+	}
+	return strings.Join(numbers, ".")
+}
+
+// guid returns a GUID derived from the application's name and key, which is
+// the same for every release of it
+func (a desktopApp) guid(key string) string {
+	sum := sha1.Sum([]byte("greleaser:" + a.AppName + ":" + key))
+	// A version 5 UUID, in the RFC 4122 variant
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
+
+// upgradeCode returns the MSI upgrade code
+func (a desktopApp) upgradeCode() string {
+	if a.UpgradeCode != "" {
+		return strings.ToUpper(strings.Trim(a.UpgradeCode, "{}"))
+	}
+	return a.guid("upgrade")
+}
+
+// desktopApp describes the installers of a target: what its archive holds,
+// without the WRAP directory, installed in its own directory
+func (g *GitHubReleaser) desktopApp(b Build, gb GoBuild, t GoTarget, opts ArchiveOptions, date time.Time) (desktopApp, error) {
+	app := desktopApp{InstallerInfo: b.Installer, PackageInfo: b.Package, Version: gb.Info.Version, Arch: t.Arch, Binary: gb.BinaryName(t), Date: date}
+	if app.Name == "" {
+		app.Name = strings.ToLower(gb.Binary)
+	}
+	if app.AppName == "" {
+		app.AppName = gb.Binary
+		if b.Package.Name != "" {
+			app.AppName = b.Package.Name
+		}
+	}
+	if app.Publisher == "" {
+		app.Publisher = app.Maintainer
+	}
+	if app.Description == "" {
+		app.Description = app.AppName
+	}
+	if app.Dir == "" {
+		app.Dir = app.AppName
+	}
+
+	opts.Wrap = ""
+	entries, err := g.archiveEntries(gb.Dir(t), opts)
+	if err != nil {
+		return app, err
+	}
+	installed := map[string]bool{}
+	for _, e := range entries {
+		if e.Info.IsDir() {
+			continue
+		}
+		info, err := e.file()
+		if err != nil {
+			return app, err
+		}
+		app.Files = append(app.Files, installerFile{Src: e.Path, Name: e.Name, Mode: e.mode(info)})
+		installed[e.Name] = true
+	}
+	_, files := app.shortcuts()
+	for _, file := range files {
+		if !installed[file] {
+			return app, fmt.Errorf("%s names %s, which isn't installed", b.Key("INSTALLER_SHORTCUTS"), file)
+		}
+	}
+	if exec := app.appImageExec(); t.OS == "linux" && !installed[exec] {
+		return app, fmt.Errorf("%s names %s, which isn't installed", b.Key("APPIMAGE_EXEC"), exec)
+	}
+	return app, nil
+}
+
+// BuildInstallers builds the INSTALLERS of a Go target into the output
+// directory, those of formats for other operating systems aside
+func (g *GitHubReleaser) BuildInstallers(b Build, gb GoBuild, t GoTarget, opts ArchiveOptions, log buildLog) ([]string, error) {
+	var formats []string
+	for _, format := range b.Installers {
+		if installerOS[format] == t.OS {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, nil
+	}
+	date := g.sourceDate
+	if date.IsZero() {
+		date = time.Now().UTC().Truncate(time.Second)
+	}
+	app, err := g.desktopApp(b, gb, t, opts, date)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, format := range formats {
+		var out string
+		var err error
+		switch format {
+		case InstallerNSIS:
+			out, err = writeNSIS(gb.OutDir, app)
+		case InstallerMSI:
+			out, err = writeMSI(gb.OutDir, app)
+		case InstallerDMG:
+			out, err = writeDMG(gb.OutDir, app)
+		case InstallerPKG:
+			out, err = writePKG(gb.OutDir, app)
+		case InstallerAppImage:
+			out, err = writeAppImage(gb.OutDir, app)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s installer: %w", format, err)
+		}
+		log.Step("Built %s", out)
+		if err := signPackage(app.SignCommand, out, format, log); err != nil {
+			return nil, err
+		}
+		paths = append(paths, out)
+	}
+	return paths, nil
+}
+
+// stage copies the app's files into dir as they are installed, for the
+// installers built from a directory
+func (a desktopApp) stage(dir string) error {
+	for _, f := range a.Files {
+		dst := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := copyInstalled(f.Src, dst, f.Mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dst, a.Date, a.Date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyInstalled copies the file at src to dst with the given mode
+func copyInstalled(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// installerName returns the file name of an installer of the app
+func (a desktopApp) installerName(goos, suffix string) string {
+	return fmt.Sprintf("%s_%s_%s_%s%s", a.Name, a.Version, goos, a.Arch, suffix)
+}
+
+// isInstaller reports whether path is an installer
+func isInstaller(path string) bool {
+	for _, suffix := range []string{"_setup.exe", ".msi", ".dmg", ".pkg", ".AppImage"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
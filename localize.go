@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NotesLanguage is a language the release notes are published in besides
+// the primary one
+type NotesLanguage struct {
+	Code string
+	// Template renders the notes in this language; if empty, they are
+	// translated with NOTES_TRANSLATE_COMMAND
+	Template string
+}
+
+// ParseNotesLanguages parses NOTES_LANGUAGES entries of the form
+// code[=template]
+func ParseNotesLanguages(entries []string) ([]NotesLanguage, error) {
+	var languages []NotesLanguage
+	for _, entry := range entries {
+		code, template, _ := strings.Cut(entry, "=")
+		code = strings.TrimSpace(code)
+		if code == "" {
+			return nil, fmt.Errorf("invalid NOTES_LANGUAGES entry %q (expected code or code=template)", entry)
+		}
+		languages = append(languages, NotesLanguage{Code: code, Template: strings.TrimSpace(template)})
+	}
+	return languages, nil
+}
+
+// Translate runs the translation command with the notes on stdin and the
+// language code in NOTES_LANGUAGE, and returns its output
+func Translate(command, code, notes string) (string, error) {
+	parts := buildRunner{}.Shell(command)
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Env = append(os.Environ(), "NOTES_LANGUAGE="+code)
+	cmd.Stdin = strings.NewReader(notes)
+	cmd.Stderr = ui.Output()
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("translation to %s failed: %w", code, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// LocalizeNotes renders the release notes in each of NOTES_LANGUAGES, from
+// its template or by translating notes. Depending on NOTES_LANGUAGES_MODE,
+// the translations are appended to notes as collapsible sections, or
+// written to RELEASE_NOTES.<code>.md files to upload with the release.
+func (g *GitHubReleaser) LocalizeNotes(notes string) (string, []string, error) {
+	mode := g.config.NotesLanguagesMode
+	switch mode {
+	case "", "sections", "assets":
+	default:
+		return "", nil, fmt.Errorf("unknown NOTES_LANGUAGES_MODE %q (expected sections or assets)", mode)
+	}
+
+	languages, err := ParseNotesLanguages(g.config.NotesLanguages)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var dir string
+	var files []string
+	blocks := []string{notes}
+	for _, lang := range languages {
+		var localized string
+		switch {
+		case lang.Template != "":
+			localized, err = RenderTemplateFile("NOTES_LANGUAGES", lang.Template, g.changelogData)
+		case g.config.NotesTranslateCommand != "":
+			localized, err = Translate(g.config.NotesTranslateCommand, lang.Code, notes)
+		default:
+			err = fmt.Errorf("no template for %s in NOTES_LANGUAGES and no NOTES_TRANSLATE_COMMAND", lang.Code)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		if mode == "assets" {
+			if dir == "" {
+				if dir, err = os.MkdirTemp("", "greleaser-notes-"); err != nil {
+					return "", nil, err
+				}
+				cleanups = append(cleanups, func() { os.RemoveAll(dir) })
+			}
+			path := filepath.Join(dir, fmt.Sprintf("RELEASE_NOTES.%s.md", lang.Code))
+			if err := os.WriteFile(path, []byte(localized+"\n"), 0644); err != nil {
+				return "", nil, err
+			}
+			files = append(files, path)
+			continue
+		}
+		blocks = append(blocks, fmt.Sprintf("<details>\n<summary>Release notes (%s)</summary>\n\n%s\n\n</details>", lang.Code, localized))
+	}
+	return strings.Join(blocks, "\n\n"), files, nil
+}
@@ -2,31 +2,50 @@ package main
 
 import (
 	"archive/zip"
-	"bytes"
-	"encoding/json"
+	"compress/flate"
+	"context"
+	"flag"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Config holds the configuration loaded from environment
-type Config struct {
-	GithubToken  string
-	BuildPath    string
-	BuildCommand string
-}
-
 // GitHubReleaser manages GitHub releases
 type GitHubReleaser struct {
+	config    Config
 	token     string
 	headers   map[string]string
+	apiURL    string
+	scheme    string
+	host      string
+	remote    string
 	repoName  string
 	ownerName string
+	// logins caches the GitHub logins of author emails
+	logins map[string]string
+	// changelogData is what the last changelog was rendered from, for
+	// localized templates
+	changelogData ChangelogData
+	// changelog is the last changelog as rendered, without the summary,
+	// notes, header and footer the release notes wrap it in
+	changelog string
+	// buildLog is the build log being written, which isn't archived even
+	// if it's in a build's output directory
+	buildLog string
+	// sourceDate is the time archive entries get, so that archives of the
+	// same files are identical: SOURCE_DATE_EPOCH or the released commit's
+	// date, zero if it's unknown
+	sourceDate time.Time
+	// secrets are the contents of SECRETS_FILE, loaded when building
+	secrets map[string]string
 }
 
 // NewGitHubReleaser creates a new GitHubReleaser instance
@@ -35,28 +54,51 @@ func NewGitHubReleaser(config Config) (*GitHubReleaser, error) {
 		return nil, fmt.Errorf("GitHub token is required")
 	}
 
+	remote := config.Remote()
+
 	// Get repo info from git config
-	repoURL, err := exec.Command("git", "config", "--get", "remote.origin.url").Output()
+	repoURL, err := gitOutput("config", "--get", fmt.Sprintf("remote.%s.url", remote))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get git remote URL: %w", err)
+		return nil, fmt.Errorf("failed to get URL of git remote %s: %w", remote, err)
+	}
+
+	host, ownerName, repoName, err := ParseRemoteURL(repoURL)
+	if err != nil {
+		return nil, err
 	}
 
-	urlParts := strings.Split(strings.TrimSpace(string(repoURL)), "/")
-	repoName := strings.TrimSuffix(urlParts[len(urlParts)-1], ".git")
-	ownerParts := strings.Split(urlParts[len(urlParts)-2], ":")
-	ownerName := ownerParts[len(ownerParts)-1]
+	scheme := remoteScheme(repoURL)
+	apiURL := config.GithubAPIURL
+	if apiURL == "" {
+		apiURL = defaultAPIURL(scheme, host)
+	}
 
 	return &GitHubReleaser{
-		token: config.GithubToken,
+		config: config,
+		token:  config.GithubToken,
 		headers: map[string]string{
 			"Authorization": fmt.Sprintf("token %s", config.GithubToken),
 			"Accept":        "application/vnd.github.v3+json",
 		},
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		scheme:    scheme,
+		host:      host,
+		remote:    remote,
 		repoName:  repoName,
 		ownerName: ownerName,
+		logins:    map[string]string{},
 	}, nil
 }
 
+// defaultAPIURL returns the API URL of a GitHub host. GitHub Enterprise
+// serves the API under /api/v3 on its own host, with the same scheme.
+func defaultAPIURL(scheme, host string) string {
+	if host == "github.com" {
+		return "https://api.github.com"
+	}
+	return fmt.Sprintf("%s://%s/api/v3", scheme, host)
+}
+
 // makeRequest makes an HTTP request to the GitHub API
 func (g *GitHubReleaser) makeRequest(method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, body)
@@ -69,31 +111,93 @@ func (g *GitHubReleaser) makeRequest(method, url string, body io.Reader, headers
 		req.Header.Set(k, v)
 	}
 
-	// Set additional headers
+	// Set additional headers. Net/http sends a Content-Length header only
+	// from the request's own field, which it can't work out for wrapped
+	// readers.
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
+	if length := req.Header.Get("Content-Length"); length != "" {
+		if req.ContentLength, err = strconv.ParseInt(length, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid Content-Length %q", length)
+		}
+	}
 
 	client := &http.Client{}
 	return client.Do(req)
 }
 
-// RunBuild executes the build command
-func (g *GitHubReleaser) RunBuild(buildCmd string) error {
-	fmt.Println("Building project...")
-	cmdParts := strings.Fields(buildCmd)
-	cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// RunBuild executes a build's command or script with the shell, or its
+// tool's build command, in its working directory on the host or in its
+// container image, with the build info and its variables in its
+// environment. Without any, a Node.js project is installed and built with
+// the package manager its lockfile belongs to. The commands are killed
+// when ctx is done.
+func (g *GitHubReleaser) RunBuild(ctx context.Context, b Build, info BuildInfo, log buildLog) error {
+	runner, err := g.runner(b, info)
+	if err != nil {
+		return err
+	}
+	var commands [][]string
+	switch {
+	case b.Command != "":
+		commands = [][]string{runner.Shell(b.Command)}
+	case b.Tool != "":
+		output, err := filepath.Abs(b.OutputPath())
+		if err != nil {
+			return err
+		}
+		commands = [][]string{buildTools[b.Tool].Command(b, output)}
+	case b.Script != "":
+		// The path is relative to the repository root, not the build's
+		// directory
+		script, err := filepath.Abs(b.Script)
+		if err != nil {
+			return err
+		}
+		commands = [][]string{runner.ShellScript(script)}
+	default:
+		pm, ok := DetectNodePackageManager(b.Dir)
+		if !ok {
+			return fmt.Errorf("%s is not set and no Node.js lockfile was found", b.Key("COMMAND"))
+		}
+		log.Step("Installing dependencies with %s", pm.Name)
+		commands = [][]string{pm.Install, pm.Build()}
+	}
+	for i, parts := range commands {
+		if i > 0 {
+			log.Step("Running %s", strings.Join(parts, " "))
+		}
+		cmd, err := runner.Command(ctx, nil, parts[0], parts[1:]...)
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = log.Output()
+		cmd.Stderr = log.Output()
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// CreateZip creates a ZIP file from the build directory
-func (g *GitHubReleaser) CreateZip(buildPath, outputFile string) error {
-	fmt.Printf("Creating ZIP archive from %s...\n", buildPath)
+// generated reports whether path is a file GReleaser writes itself, the
+// build log, the artifacts manifest or the checksums file, which isn't
+// archived even if it's in a build's output directory
+func (g *GitHubReleaser) generated(path string) bool {
+	for _, file := range append([]string{g.buildLog, g.config.ArtifactsManifest}, g.config.Checksums.Paths()...) {
+		if file != "" && filepath.Clean(path) == filepath.Clean(file) {
+			return true
+		}
+	}
+	return false
+}
 
-	if _, err := os.Stat(buildPath); os.IsNotExist(err) {
-		return fmt.Errorf("build directory %s not found", buildPath)
+// createZip creates a ZIP file from the build directory
+func (g *GitHubReleaser) createZip(buildPath, outputFile string, opts ArchiveOptions) error {
+	entries, err := g.archiveEntries(buildPath, opts)
+	if err != nil {
+		return err
 	}
 
 	zipFile, err := os.Create(outputFile)
@@ -104,260 +208,1395 @@ func (g *GitHubReleaser) CreateZip(buildPath, outputFile string) error {
 
 	archive := zip.NewWriter(zipFile)
 	defer archive.Close()
+	if opts.Level > 0 {
+		archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, opts.Level)
+		})
+	}
 
-	return filepath.Walk(buildPath, func(path string, info os.FileInfo, err error) error {
+	for _, e := range entries {
+		info, err := e.file()
 		if err != nil {
 			return err
 		}
-
 		if info.IsDir() {
-			return nil
+			continue
 		}
 
-		relPath, err := filepath.Rel(buildPath, path)
+		// Unix modes make extracted binaries executable, and links are
+		// stored with their target as content, as unzip expects
+		header := &zip.FileHeader{Name: e.Name, Method: zip.Deflate}
+		header.SetMode(e.mode(info))
+		if opts.Level == LevelStore {
+			header.Method = zip.Store
+		}
+		if e.Link != "" {
+			header.Method = zip.Store
+			header.SetMode(os.ModeSymlink | 0777)
+		}
+		// Entries carry the source date rather than the time of the build
+		if !g.sourceDate.IsZero() {
+			header.Modified = g.sourceDate
+		}
+		file, err := archive.CreateHeader(header)
 		if err != nil {
 			return err
 		}
+		if e.Link != "" {
+			if _, err := io.WriteString(file, e.Link); err != nil {
+				return err
+			}
+			continue
+		}
 
-		file, err := archive.Create(relPath)
+		src, err := os.Open(e.Path)
 		if err != nil {
 			return err
 		}
-
-		src, err := os.Open(path)
+		_, err = io.Copy(file, src)
+		src.Close()
 		if err != nil {
 			return err
 		}
-		defer src.Close()
+	}
+	return nil
+}
 
-		_, err = io.Copy(file, src)
-		return err
-	})
+// ChangelogOptions selects the commits of a changelog
+type ChangelogOptions struct {
+	// Version and Tag are the release's version and tag name, which only
+	// differ for nightly releases
+	Version string
+	Tag     string
+	// Channel is the pre-release channel, "" for stable releases
+	Channel string
+	// From and To are the range of commits. An empty From means the
+	// previous release in the channel, and an empty To means HEAD.
+	From string
+	To   string
+	// Target is the commit the release is created for
+	Target string
 }
 
-// GenerateChangelog generates a changelog from git commits
-func (g *GitHubReleaser) GenerateChangelog() (string, error) {
-	// Try to get the last tag
-	lastTag, err := exec.Command("git", "describe", "--tags", "--abbrev=0").Output()
+// GenerateChangelog generates the release notes: a changelog from the git
+// commits in a range, GitHub's generated notes, or both, per CHANGELOG_MODE,
+// combined with any given notes and wrapped in the header and footer
+func (g *GitHubReleaser) GenerateChangelog(opts ChangelogOptions) (string, error) {
+	mode := g.config.ChangelogMode
+	switch mode {
+	case "", "local", "pulls", "github", "merged":
+	default:
+		return "", fmt.Errorf("unknown CHANGELOG_MODE %q (expected local, pulls, github or merged)", mode)
+	}
+
+	data, to := g.newChangelogData(opts)
+	from := data.PreviousVersion
 
-	var commits []byte
-	if err == nil {
-		// Get commits since last tag
-		commits, err = exec.Command("git", "log",
-			fmt.Sprintf("%s..HEAD", strings.TrimSpace(string(lastTag))),
-			"--pretty=format:- %s").Output()
-	} else {
-		// If no tags exist, get all commits
-		commits, err = exec.Command("git", "log", "--pretty=format:- %s").Output()
+	var local, generated string
+	var err error
+	if mode != "github" {
+		if local, err = g.localChangelog(&data, to); err != nil {
+			return "", err
+		}
+	}
+	if mode == "github" || mode == "merged" {
+		// GitHub only accepts a tag as the start of the range
+		previous := ""
+		if _, err := gitOutput("rev-parse", "--verify", "--quiet", "refs/tags/"+from); err == nil {
+			previous = from
+		}
+		if generated, err = g.GenerateNotes(opts.Tag, opts.Target, previous); err != nil {
+			return "", err
+		}
+	}
+
+	// GitHub's generated notes and templates have their own compare link
+	if g.config.ChangelogCompareLink && generated == "" && g.config.ChangelogTemplate == "" && from != "" {
+		local += fmt.Sprintf("\n\n**Full Changelog**: %s", data.CompareURL)
 	}
 
+	g.changelogData = data
+	changelog := strings.TrimSpace(local + "\n\n" + generated)
+	if g.config.ChangelogNoMentions {
+		changelog = UnmentionHandles(changelog, g.scheme+"://"+g.host)
+	}
+	g.changelog = changelog
+	if g.config.SummaryModel != "" && changelog != "" {
+		ui.Step("Summarizing changelog")
+		summarizer := Summarizer{
+			URL:    g.config.SummaryAPIURL,
+			Model:  g.config.SummaryModel,
+			APIKey: g.config.SummaryAPIKey,
+			Prompt: g.config.SummaryPrompt,
+		}
+		// The summary is a nicety, so a failing endpoint doesn't stop the release
+		if summary, err := summarizer.Summarize(changelog); err != nil {
+			ui.Printf("Warning: failed to summarize changelog: %v\n", err)
+		} else if summary != "" {
+			changelog = summary + "\n\n" + changelog
+		}
+	}
+
+	notes, err := applyNotes(g.config, changelog)
 	if err != nil {
 		return "", err
 	}
 
-	return string(commits), nil
+	blocks := []string{notes}
+	if g.config.NotesHeader != "" {
+		header, err := RenderTemplateFile("NOTES_HEADER", g.config.NotesHeader, data)
+		if err != nil {
+			return "", err
+		}
+		blocks = append([]string{header}, blocks...)
+	}
+	if g.config.NotesFooter != "" {
+		footer, err := RenderTemplateFile("NOTES_FOOTER", g.config.NotesFooter, data)
+		if err != nil {
+			return "", err
+		}
+		blocks = append(blocks, footer)
+	}
+	return strings.TrimSpace(strings.Join(blocks, "\n\n")), nil
 }
 
-// CreateRelease creates a GitHub release and uploads the ZIP file
-func (g *GitHubReleaser) CreateRelease(version, zipFile string) error {
-	fmt.Printf("Creating GitHub release %s...\n", version)
+// ExportChangelog returns the changelog as "markdown", the same as the
+// release notes, or as "json" with the commits grouped into sections
+func (g *GitHubReleaser) ExportChangelog(opts ChangelogOptions, format string) (string, error) {
+	switch format {
+	case "", "markdown":
+		return g.GenerateChangelog(opts)
+	case "json":
+	default:
+		return "", fmt.Errorf("unknown format %q (expected markdown or json)", format)
+	}
+
+	data, to := g.newChangelogData(opts)
+	if _, err := g.collectCommits(&data, to); err != nil {
+		return "", err
+	}
+	out, err := MarshalChangelog(data)
+	return string(out), err
+}
+
+// newChangelogData returns the data of a changelog without its commits,
+// and the end of its range
+func (g *GitHubReleaser) newChangelogData(opts ChangelogOptions) (ChangelogData, string) {
+	from, to := opts.From, opts.To
+	if to == "" {
+		to = "HEAD"
+	}
+
+	// Try to get the last tag; if no tags exist, use all commits. A tag on
+	// the end of the range is the release itself, so look before it.
+	if from == "" {
+		comp := g.config.Component()
+		from, _ = comp.PreviousTag(opts.Channel, to)
+		if from != "" && sameCommit(from, to) {
+			from, _ = comp.PreviousTag(opts.Channel, to+"^")
+		}
+	}
 
-	changelog, err := g.GenerateChangelog()
+	data := ChangelogData{
+		Version:         opts.Version,
+		PreviousVersion: from,
+		Date:            time.Now().Format("2006-01-02"),
+		Owner:           g.ownerName,
+		Repo:            g.repoName,
+	}
+	if from != "" {
+		data.CompareURL = g.compareURL(from, opts.Tag)
+	}
+	return data, to
+}
+
+// localChangelog renders the commits from data.PreviousVersion to to, with
+// CHANGELOG_TEMPLATE if set, and records them in data
+func (g *GitHubReleaser) localChangelog(data *ChangelogData, to string) (string, error) {
+	sections, err := g.collectCommits(data, to)
 	if err != nil {
-		return fmt.Errorf("failed to generate changelog: %w", err)
+		return "", err
 	}
 
-	// Create release
-	releaseURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases",
-		g.ownerName, g.repoName)
+	if g.config.ChangelogTemplate != "" {
+		return RenderTemplateFile("CHANGELOG_TEMPLATE", g.config.ChangelogTemplate, *data)
+	}
 
-	releaseData := map[string]interface{}{
-		"tag_name":   version,
-		"name":       fmt.Sprintf("Release %s", version),
-		"body":       changelog,
-		"draft":      false,
-		"prerelease": false,
+	changelog := RenderChangelog(data.Commits, sections)
+	if data.Paths != nil {
+		changelog = RenderPathChangelog(data.Paths, sections)
+	}
+	if g.config.ChangelogContributors {
+		changelog = strings.TrimSpace(changelog + "\n\n" + RenderContributors(data.Contributors))
 	}
+	return changelog, nil
+}
 
-	jsonData, err := json.Marshal(releaseData)
+// collectCommits records the filtered commits from data.PreviousVersion to
+// to in data, grouped into the returned sections, with their PR authors
+// and contributors looked up as configured
+func (g *GitHubReleaser) collectCommits(data *ChangelogData, to string) ([]ChangelogSection, error) {
+	comp := g.config.Component()
+	from := data.PreviousVersion
+
+	revRange := to
+	if from != "" {
+		revRange = fmt.Sprintf("%s..%s", from, to)
+	}
+
+	commits, err := comp.Commits(revRange)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if g.config.ChangelogMode == "pulls" {
+		if commits, err = g.pullRequestCommits(commits, from); err != nil {
+			return nil, err
+		}
 	}
 
-	headers := map[string]string{"Content-Type": "application/json"}
-	resp, err := g.makeRequest("POST", releaseURL, bytes.NewBuffer(jsonData), headers)
+	filter, err := NewCommitFilter(g.config)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	commits = filter.Apply(commits)
+	if err := StyleGitmojis(commits, g.config.ChangelogEmoji); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create release: %s", body)
+	repoURL := g.webURL()
+	authors := map[int]string{}
+	for i := range commits {
+		c := &commits[i]
+		if g.config.ChangelogPRAuthors && c.PR != 0 && c.PRAuthor == "" {
+			if _, ok := authors[c.PR]; !ok {
+				login, err := g.PullRequestAuthor(c.PR)
+				if err != nil {
+					ui.Printf("Warning: %v\n", err)
+				}
+				authors[c.PR] = login
+			}
+			c.PRAuthor = authors[c.PR]
+		}
+		if g.config.ChangelogAuthors {
+			c.Author = &Contributor{Name: c.AuthorName, Email: c.AuthorEmail, Login: g.authorLogin(c.AuthorEmail, c.Hash)}
+		}
+		if g.config.ChangelogLinks {
+			c.Subject = LinkRefs(c.Subject, repoURL, c.PR)
+			c.Description = LinkRefs(c.Description, repoURL, c.PR)
+		}
 	}
 
-	var release struct {
-		UploadURL string `json:"upload_url"`
+	sections, err := ParseChangelogSections(g.config.ChangelogSections)
+	if err != nil {
+		return nil, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return err
+
+	contributors := Contributors(commits)
+	if g.config.ChangelogContributors {
+		if err := g.resolveContributors(contributors, from); err != nil {
+			return nil, err
+		}
 	}
 
-	// Upload asset
-	fmt.Println("Uploading release asset...")
-	uploadURL := strings.Split(release.UploadURL, "{")[0]
-	uploadURL = fmt.Sprintf("%s?name=%s", uploadURL, filepath.Base(zipFile))
+	data.Commits = commits
+	data.Groups = GroupCommits(commits, sections)
+	data.Contributors = contributors
+
+	if g.config.ChangelogByPath || len(g.config.ChangelogPaths) > 0 {
+		parts, err := ParseChangelogPaths(g.config.ChangelogPaths)
+		if err != nil {
+			return nil, err
+		}
+		files, err := CommitFiles(revRange, comp.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list changed files: %w", err)
+		}
+		for i := range commits {
+			commits[i].Files = files[commits[i].Hash]
+		}
+		data.Paths = GroupCommitsByPath(commits, parts, sections)
+	}
+	return sections, nil
+}
 
-	file, err := os.Open(zipFile)
+// pullRequestCommits replaces commits with the pull requests they merged,
+// titled, labelled and credited like the pull requests. Commits pushed
+// without a pull request are left out.
+func (g *GitHubReleaser) pullRequestCommits(commits []Commit, from string) ([]Commit, error) {
+	labels, err := ParseChangelogLabels(g.config.ChangelogLabels)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var since time.Time
+	if from != "" {
+		date, err := gitOutput("log", "-1", "--format=%cI", from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get date of %s: %w", from, err)
+		}
+		if since, err = time.Parse(time.RFC3339, date); err != nil {
+			return nil, err
+		}
 	}
-	defer file.Close()
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", filepath.Base(zipFile))
+	ui.Step("Listing merged pull requests")
+	prs, err := g.MergedPullRequests(since)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	bySHA := map[string]pullRequest{}
+	for _, pr := range prs {
+		bySHA[pr.MergeCommitSHA] = pr
 	}
 
-	if _, err := io.Copy(part, file); err != nil {
-		return err
+	var merged []Commit
+	for _, c := range commits {
+		pr, ok := bySHA[c.Hash]
+		if !ok {
+			continue
+		}
+		// The commit body keeps breaking change footers and co-authors
+		pc := ParseCommit(c.Hash, fmt.Sprintf("%s (#%d)", pr.Title, pr.Number), c.Body)
+		pc.AuthorName, pc.AuthorEmail = c.AuthorName, c.AuthorEmail
+		pc.PRAuthor = pr.User.Login
+		for _, l := range pr.Labels {
+			pc.Labels = append(pc.Labels, l.Name)
+		}
+		pc.ApplyLabels(labels)
+		merged = append(merged, pc)
+	}
+	return merged, nil
+}
+
+// resolveContributors looks up the contributors' GitHub handles and marks
+// those without commits before from as first-time contributors. Nobody is
+// a first-time contributor to the first release.
+func (g *GitHubReleaser) resolveContributors(contributors []Contributor, from string) error {
+	previous := map[string]bool{}
+	if from != "" {
+		out, err := gitOutput("log", "--format=%ae%n%(trailers:key=Co-authored-by,valueonly)", from)
+		if err != nil {
+			return fmt.Errorf("failed to list previous contributors: %w", err)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			// Co-author trailers are "Name <email>"
+			if i := strings.LastIndex(line, "<"); i >= 0 {
+				line = strings.TrimSuffix(line[i+1:], ">")
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				previous[strings.ToLower(line)] = true
+			}
+		}
 	}
-	writer.Close()
 
-	headers = map[string]string{"Content-Type": writer.FormDataContentType()}
-	resp, err = g.makeRequest("POST", uploadURL, body, headers)
+	for i := range contributors {
+		c := &contributors[i]
+		c.FirstTime = from != "" && !previous[strings.ToLower(c.Email)]
+		// Co-authors have no commit of their own to look up
+		if c.Login != "" || c.commit == "" {
+			continue
+		}
+		c.Login = g.authorLogin(c.Email, c.commit)
+	}
+	return nil
+}
+
+// authorLogin returns the GitHub login of an author email, looked up
+// through one of their commits, or "" if it isn't linked to an account
+func (g *GitHubReleaser) authorLogin(email, sha string) string {
+	if login := noreplyLogin(email); login != "" {
+		return login
+	}
+	key := strings.ToLower(email)
+	if login, ok := g.logins[key]; ok {
+		return login
+	}
+	login, err := g.CommitAuthor(sha)
 	if err != nil {
-		return err
+		ui.Printf("Warning: %v\n", err)
 	}
-	defer resp.Body.Close()
+	g.logins[key] = login
+	return login
+}
+
+// applyNotes combines the generated changelog with notes given through
+// NOTES or NOTES_FILE ("-" for stdin), according to NOTES_MODE
+func applyNotes(config Config, changelog string) (string, error) {
+	notes := config.Notes
+	switch config.NotesFile {
+	case "":
+	case "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		notes = string(data)
+	default:
+		data, err := os.ReadFile(config.NotesFile)
+		if err != nil {
+			return "", err
+		}
+		notes = string(data)
+	}
+	notes = strings.TrimSpace(notes)
+	if notes == "" {
+		return changelog, nil
+	}
+
+	switch config.NotesMode {
+	case "", "replace":
+		return notes, nil
+	case "prepend":
+		return strings.TrimSpace(notes + "\n\n" + changelog), nil
+	case "append":
+		return strings.TrimSpace(changelog + "\n\n" + notes), nil
+	}
+	return "", fmt.Errorf("unknown NOTES_MODE %q (expected replace, prepend or append)", config.NotesMode)
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to upload asset: %s", body)
+// EditNotes opens the release notes in the user's editor, chosen the same
+// way as for git commit, and returns the edited text. Emptying the notes
+// aborts the release.
+func EditNotes(notes string) (string, error) {
+	editor, err := gitOutput("var", "GIT_EDITOR")
+	if err != nil || editor == "" {
+		return "", fmt.Errorf("no editor configured, set $EDITOR")
 	}
 
+	file, err := os.CreateTemp("", "greleaser-notes-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(notes + "\n"); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	// The editor needs the terminal to itself
+	ui.Done(nil)
+	fmt.Printf("Waiting for your editor to close %s...\n", file.Name())
+	// Like git, the editor is run by the shell with the file as its last
+	// argument, so that it can hold a quoted path and options
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, file.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	edited := strings.TrimSpace(string(data))
+	if edited == "" {
+		return "", fmt.Errorf("release notes are empty, aborting")
+	}
+	return edited, nil
+}
+
+// formatSubmodules renders the submodule commits as a release notes section
+func formatSubmodules(subs []Submodule) string {
+	if len(subs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n### Submodules\n")
+	for _, sub := range subs {
+		fmt.Fprintf(&b, "\n- `%s` at %s", sub.Path, sub.Commit)
+	}
+	return b.String()
+}
+
+// ReleaseParams describes the GitHub release to create
+type ReleaseParams struct {
+	Version    string
+	Name       string
+	Body       string
+	Prerelease bool
+	// Target is the commit GitHub creates the tag at if it doesn't exist
+	Target string
+	// OnExisting is what to do if the release already exists: "fail"
+	// (default), "update" its details, "overwrite" the assets of the same
+	// names as well, or "replace" all its assets
+	OnExisting string
+}
+
+// CheckExisting fails early if the tag or release for version already
+// exists in a way the OnExisting mode doesn't allow
+func (g *GitHubReleaser) CheckExisting(version, commit, onExisting string) error {
+	switch onExisting {
+	case "", "fail", "update", "overwrite", "replace":
+	default:
+		return fmt.Errorf("unknown ON_EXISTING mode %q (expected fail, update, overwrite or replace)", onExisting)
+	}
+	if onExisting != "" && onExisting != "fail" {
+		return nil
+	}
+
+	const hint = "\nUse --on-existing=update, overwrite or replace to overwrite it"
+
+	if existing, err := gitOutput("rev-list", "-n", "1", "refs/tags/"+version); err == nil && existing != commit {
+		return fmt.Errorf("tag %s already exists at %s, not %s%s", version, existing, commit, hint)
+	}
+	if existing, err := RemoteTagCommit(g.remote, version); err != nil {
+		return err
+	} else if existing != "" && existing != commit {
+		return fmt.Errorf("tag %s already exists on %s at %s, not %s%s", version, g.remote, existing, commit, hint)
+	}
+
+	existing, err := g.GetReleaseByTag(version)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("release %s already exists: %s%s", version, existing.HTMLURL, hint)
+	}
 	return nil
 }
 
-// LoadConfig loads configuration from environment file
-func LoadConfig(envFile string) (Config, error) {
-	config := Config{}
+// CreateRelease creates a GitHub release and uploads the assets, returning
+// their download URLs by path
+func (g *GitHubReleaser) CreateRelease(params ReleaseParams, assets []Artifact) (map[string]string, error) {
+	version := params.Version
+	ui.Step("Creating GitHub release %s", version)
 
-	data, err := os.ReadFile(envFile)
+	existing, err := g.GetReleaseByTag(version)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return config, err
+		return nil, err
+	}
+
+	releaseData := map[string]interface{}{
+		"tag_name":   version,
+		"name":       params.Name,
+		"body":       params.Body,
+		"draft":      false,
+		"prerelease": params.Prerelease,
+	}
+	if params.Target != "" {
+		releaseData["target_commitish"] = params.Target
+	}
+
+	var release *githubRelease
+	if existing == nil {
+		release, err = g.saveRelease(0, releaseData)
+	} else {
+		switch params.OnExisting {
+		case "update", "overwrite", "replace":
+			ui.Step("Updating existing GitHub release %s", version)
+			release, err = g.saveRelease(existing.ID, releaseData)
+		default:
+			return nil, fmt.Errorf("release %s already exists: %s (use --on-existing=update, overwrite or replace)", version, existing.HTMLURL)
 		}
-		fmt.Printf("Warning: %s not found\n", envFile)
-		// Don't return here - continue to check environment variables
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	if existing != nil && params.OnExisting == "replace" {
+		ui.Step("Deleting existing release assets")
+		for _, asset := range existing.Assets {
+			if err := g.DeleteAsset(asset); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Re-runs of a release overwrite what they upload again, and keep the
+	// rest, such as assets uploaded by other jobs
+	if existing != nil && params.OnExisting == "overwrite" {
+		if err := g.deleteMatchingAssets(release, assets); err != nil {
+			return nil, err
 		}
+	}
+
+	return g.uploadAssets(release, assets)
+}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+// deleteMatchingAssets deletes the assets of a release that have the name
+// of one of assets
+func (g *GitHubReleaser) deleteMatchingAssets(release *githubRelease, assets []Artifact) error {
+	names := map[string]bool{}
+	for _, a := range assets {
+		names[a.Name] = true
+	}
+	existing, err := g.ReleaseAssets(release)
+	if err != nil {
+		return err
+	}
+	for _, asset := range existing {
+		if !names[asset.Name] {
 			continue
 		}
+		ui.Step("Deleting existing asset %s", asset.Name)
+		if err := g.DeleteAsset(asset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+// defaultUploadParallelism is how many assets are uploaded at once unless
+// UPLOAD_PARALLELISM is set
+const defaultUploadParallelism = 4
 
-		switch key {
-		case "GITHUB_TOKEN":
-			config.GithubToken = value
-		case "BUILD_PATH":
-			config.BuildPath = value
-		case "BUILD_COMMAND":
-			config.BuildCommand = value
-		}
+// defaultUploadRetries is how many times a failed upload is retried unless
+// UPLOAD_RETRIES is set
+const defaultUploadRetries = 3
+
+// uploadAssets uploads the assets to a release, several at once up to
+// UPLOAD_PARALLELISM, returning their download URLs by path. Once an upload
+// fails no new ones are started.
+func (g *GitHubReleaser) uploadAssets(release *githubRelease, assets []Artifact) (map[string]string, error) {
+	workers := g.config.UploadParallelism
+	if workers <= 0 {
+		workers = defaultUploadParallelism
+	}
+	if workers > len(assets) {
+		workers = len(assets)
 	}
 
-	// Check environment variables if not found in file
-	if config.GithubToken == "" {
-		config.GithubToken = os.Getenv("GITHUB_TOKEN")
+	urls := map[string]string{}
+	if workers <= 1 {
+		for _, asset := range assets {
+			ui.Step("Uploading %s", asset.Name)
+			uploaded, err := g.uploadAsset(release, asset)
+			if err != nil {
+				return nil, err
+			}
+			urls[asset.Path] = uploaded.BrowserDownloadURL
+		}
+		return urls, nil
 	}
-	if config.BuildPath == "" {
-		config.BuildPath = os.Getenv("BUILD_PATH")
+
+	ui.Step("Uploading %d assets, %d at a time", len(assets), workers)
+	errs := make([]error, len(assets))
+	var mu sync.Mutex
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if failed.Load() {
+					continue
+				}
+				asset := assets[i]
+				uploaded, err := g.uploadAsset(release, asset)
+				if err != nil {
+					errs[i] = err
+					failed.Store(true)
+					ui.Printf("Failed to upload %s: %v\n", asset.Name, err)
+					continue
+				}
+				ui.Printf("Uploaded %s\n", asset.Name)
+				mu.Lock()
+				urls[asset.Path] = uploaded.BrowserDownloadURL
+				mu.Unlock()
+			}
+		}()
 	}
-	if config.BuildCommand == "" {
-		config.BuildCommand = os.Getenv("BUILD_COMMAND")
+	for i := range assets {
+		queue <- i
 	}
+	close(queue)
+	wg.Wait()
 
-	// Validate required fields
-	var missingFields []string
-	if config.GithubToken == "" {
-		missingFields = append(missingFields, "GITHUB_TOKEN")
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
-	if config.BuildPath == "" {
-		missingFields = append(missingFields, "BUILD_PATH")
+	return urls, nil
+}
+
+// uploadAsset uploads an asset, retrying failed uploads up to
+// UPLOAD_RETRIES times with exponential backoff. GitHub keeps the asset of
+// a failed upload and rejects new uploads of the same name, so it's
+// deleted before retrying, unless the upload went through after all.
+func (g *GitHubReleaser) uploadAsset(release *githubRelease, asset Artifact) (*githubAsset, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		uploaded, err := g.UploadAsset(release, filepath.FromSlash(asset.Path), asset.Label)
+		if err == nil || attempt >= g.config.UploadRetries {
+			return uploaded, err
+		}
+		ui.Printf("Upload of %s failed (attempt %d of %d): %v\n", asset.Name, attempt+1, g.config.UploadRetries+1, err)
+
+		// The API may not list the broken asset right away, so it's
+		// looked for after waiting
+		time.Sleep(delay)
+		delay *= 2
+		existing, err := g.ReleaseAssets(release)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range existing {
+			if a.Name != asset.Name {
+				continue
+			}
+			if info, err := os.Stat(filepath.FromSlash(asset.Path)); err == nil && a.State == "uploaded" && a.Size == info.Size() {
+				return &a, nil
+			}
+			ui.Printf("Deleting broken asset %s\n", a.Name)
+			if err := g.DeleteAsset(a); err != nil {
+				return nil, err
+			}
+		}
 	}
-	if config.BuildCommand == "" {
-		missingFields = append(missingFields, "BUILD_COMMAND")
+}
+
+// usage prints command-line help
+func usage() {
+	fmt.Println("Usage: greleaser [release] [flags] [version]")
+	fmt.Println("       greleaser bump patch|minor|major [flags]")
+	fmt.Println("       greleaser nightly [flags]")
+	fmt.Println("       greleaser changelog [flags] [version]")
+	fmt.Println("       greleaser self-update [--force]")
+	fmt.Println("Example: greleaser v1.0.0")
+	fmt.Println("\nIf the version is omitted it is taken from the tag on HEAD, or")
+	fmt.Println("inferred from the conventional commits since the latest tag.")
+	fmt.Println("\nFlags:")
+	flag.PrintDefaults()
+	fmt.Println("\nNote: Create a .release.env file with your configuration:")
+	fmt.Println("GITHUB_TOKEN=your-token-here")
+	fmt.Println("BUILD_PATH=dist")
+	fmt.Println("BUILD_COMMAND=npm run build")
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		// The flag sets use ExitOnError, so Parse only returns on success
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
+}
 
-	if len(missingFields) > 0 {
-		return config, fmt.Errorf("missing required configuration: %s", strings.Join(missingFields, ", "))
+// cleanups remove temporary files on exit, including after fatal errors
+var cleanups []func()
+
+// runCleanups runs the registered cleanups in reverse order
+func runCleanups() {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
 	}
+	cleanups = nil
+}
 
-	return config, nil
+// fatalf marks the current step as failed, prints the error and exits
+func fatalf(format string, args ...interface{}) {
+	ui.Done(fmt.Errorf(format, args...))
+	ui.Printf(format+"\n", args...)
+	runCleanups()
+	os.Exit(1)
 }
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go <version>")
-		fmt.Println("Example: go run main.go v1.0.0")
-		fmt.Println("\nNote: Create a .release.env file with your configuration:")
-		fmt.Println("GITHUB_TOKEN=your-token-here")
-		fmt.Println("BUILD_PATH=dist")
-		fmt.Println("BUILD_COMMAND=npm run build")
-		os.Exit(1)
+	plain := flag.Bool("plain", false, "print plain log lines instead of the interactive progress view")
+	createTag := flag.Bool("create-tag", false, "create an annotated tag and push it before publishing")
+	signTag := flag.Bool("sign-tag", false, "sign the created tag (implies --create-tag)")
+	noVPrefix := flag.Bool("no-v-prefix", false, "use tags without a leading 'v' (e.g., 1.0.0)")
+	auto := flag.Bool("auto", false, "infer the next version from conventional commits since the latest tag")
+	channel := flag.String("channel", "", "release the next pre-release in a channel, e.g. rc or beta")
+	allowDirty := flag.Bool("allow-dirty", false, "release even with uncommitted changes or unpushed commits")
+	anyBranch := flag.Bool("any-branch", false, "release from branches not listed in RELEASE_BRANCHES")
+	onExisting := flag.String("on-existing", "", "what to do if the release exists: fail, update, overwrite or replace")
+	since := flag.String("since", "", "start the changelog after this ref instead of the previous tag")
+	from := flag.String("from", "", "same as --since")
+	to := flag.String("to", "", "end the changelog at this ref instead of HEAD")
+	target := flag.String("target", "", "release this branch or commit instead of HEAD")
+	notes := flag.String("notes", "", "release notes text, or - to read them from stdin")
+	notesFile := flag.String("notes-file", "", "read the release notes from this file")
+	notesMode := flag.String("notes-mode", "", "how --notes combine with the changelog: replace, prepend or append")
+	edit := flag.Bool("edit", false, "review and edit the release notes in your editor before publishing")
+	format := flag.String("format", "markdown", "changelog command output format: markdown or json")
+	output := flag.String("output", "", "write the changelog command output to this file instead of stdout")
+	project := flag.String("project", "", "release only this project of PROJECTS")
+	all := flag.Bool("all", false, "release every project of PROJECTS in turn")
+	parallelism := flag.Int("parallelism", 0, "how many build jobs to run at once (default 1)")
+	force := flag.Bool("force", false, "self-update even from a development build or to an older release")
+	flag.Usage = usage
+	args := parseArgs(flag.CommandLine, os.Args[1:])
+
+	command := "release"
+	if len(args) > 0 {
+		switch args[0] {
+		case "release", "bump", "nightly", "changelog", "self-update":
+			command, args = args[0], args[1:]
+		}
 	}
 
-	version := os.Args[1]
-	if !strings.HasPrefix(version, "v") {
-		fmt.Println("Version must start with 'v' (e.g., v1.0.0)")
+	if command == "self-update" {
+		if err := SelfUpdate(*force); err != nil {
+			fatalf("Self-update failed: %v", err)
+		}
+		return
+	}
+
+	nightly := command == "nightly"
+	if len(args) > 1 || (command == "bump" && len(args) != 1) || (*auto && (command == "bump" || len(args) > 0)) ||
+		(nightly && (len(args) > 0 || *auto || *channel != "")) || (command == "changelog" && *auto) {
+		usage()
 		os.Exit(1)
 	}
 
+	// The changelog command's output may go to stdout, so its log doesn't
+	if command == "changelog" {
+		ui.SetLog(os.Stderr)
+	} else if !*plain && isTerminal(os.Stdout) {
+		ui.EnableTUI()
+	}
+
+	// Run from the repository root so the config file, BUILD_PATH and
+	// remote detection behave the same from any subdirectory
+	if _, err := EnterGitRoot(); err != nil {
+		fatalf("Error locating repository root: %v", err)
+	}
+
 	config, err := LoadConfig(".release.env")
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+		fatalf("Error loading config: %v", err)
 	}
 
+	configs := []Config{config}
+	if *project != "" || *all {
+		if *project != "" && *all {
+			fatalf("Error: --project and --all can't be combined")
+		}
+		// Each project has its own version, which can't be given once for all
+		if *all && len(args) > 0 && command != "bump" {
+			fatalf("Error: --all releases each project at the version from its tag or commits, drop the version argument")
+		}
+		if configs, err = config.SelectProjects(*project, *all); err != nil {
+			fatalf("Error: %v", err)
+		}
+	} else if len(config.Projects) > 0 {
+		fatalf("Error: PROJECTS is set, select one with --project <name> or all with --all (%s)", strings.Join(config.Projects, ", "))
+	}
+
+	for _, config := range configs {
+		if config.Project != "" && len(configs) > 1 {
+			ui.Printf("Project %s\n", config.Project)
+		}
+
+		if *noVPrefix {
+			config.NoVPrefix = true
+		}
+		if *allowDirty {
+			config.AllowDirty = true
+		}
+		if *anyBranch {
+			config.AnyBranch = true
+		}
+		if *onExisting != "" {
+			config.OnExisting = *onExisting
+		}
+		if *parallelism > 0 {
+			config.BuildParallelism = *parallelism
+		}
+		if *since != "" && *from != "" {
+			fatalf("Error: --since and --from are the same option, use one of them")
+		}
+		if *since != "" {
+			config.ChangelogFrom = *since
+		}
+		if *from != "" {
+			config.ChangelogFrom = *from
+		}
+		if *to != "" {
+			config.ChangelogTo = *to
+		}
+		if *target != "" {
+			config.Target = *target
+		}
+		if *notes != "" && *notesFile != "" {
+			fatalf("Error: --notes and --notes-file can't be combined")
+		}
+		if *notes == "-" {
+			config.Notes, config.NotesFile = "", "-"
+		} else if *notes != "" {
+			config.Notes, config.NotesFile = *notes, ""
+		}
+		if *notesFile != "" {
+			config.Notes, config.NotesFile = "", *notesFile
+		}
+		if *notesMode != "" {
+			config.NotesMode = *notesMode
+		}
+		if *edit {
+			config.EditNotes = true
+		}
+
+		// CI checkouts are often shallow and without tags, which would make
+		// every commit look like part of the first release
+		if IsShallow() {
+			ui.Step("Fetching tags and history")
+			if err := FetchHistory(config.Remote(), config.FetchDepth); err != nil {
+				fatalf("Error fetching history of shallow clone: %v", err)
+			}
+			ui.Done(nil)
+		}
+
+		if command == "changelog" {
+			version := ""
+			if len(args) == 1 {
+				version = args[0]
+			}
+			runChangelog(config, version, *channel, *format, *output)
+			continue
+		}
+
+		version, err := ResolveVersion(config, VersionOptions{
+			Command: command,
+			Args:    args,
+			Auto:    *auto,
+			Channel: *channel,
+			Nightly: nightly,
+			Now:     time.Now(),
+		})
+		if err != nil {
+			fatalf("Error resolving version: %v", err)
+		}
+
+		if *createTag {
+			config.CreateTag = true
+		}
+		if *signTag {
+			config.SignTag = true
+		}
+		// Signing only applies to tags greleaser creates itself
+		if config.SignTag {
+			config.CreateTag = true
+		}
+
+		// A nightly release is a single rolling release that each run replaces
+		if nightly {
+			config.OnExisting = "replace"
+		}
+
+		runRelease(config, version, nightly)
+	}
+}
+
+// runChangelog exports the changelog of version, or of the unreleased
+// commits if version is empty, without publishing anything
+func runChangelog(config Config, version, channel, format, output string) {
 	releaser, err := NewGitHubReleaser(config)
 	if err != nil {
-		fmt.Printf("Error creating releaser: %v\n", err)
-		os.Exit(1)
+		fatalf("Error creating releaser: %v", err)
+	}
+
+	comp := config.Component()
+	if version != "" {
+		version = comp.TagPrefix + strings.TrimPrefix(version, comp.TagPrefix)
+	}
+	if channel == "" {
+		channel = ReleaseChannel(comp, version)
+	}
+	opts := ChangelogOptions{
+		Version: version,
+		Tag:     version,
+		Channel: channel,
+		From:    config.ChangelogFrom,
+		To:      config.ChangelogTo,
+	}
+	if opts.Tag == "" {
+		opts.Tag = "HEAD"
+	}
+
+	// A released version's changelog ends at its tag
+	if _, err := gitOutput("rev-parse", "--verify", "--quiet", "refs/tags/"+version); version != "" && err == nil && opts.To == "" {
+		opts.To = version
+	}
+
+	changelog, err := releaser.ExportChangelog(opts, format)
+	if err != nil {
+		fatalf("Failed to generate changelog: %v", err)
+	}
+
+	if output == "" || output == "-" {
+		fmt.Println(changelog)
+		return
+	}
+	if err := os.WriteFile(output, []byte(changelog+"\n"), 0644); err != nil {
+		fatalf("Error writing changelog: %v", err)
+	}
+	ui.Printf("Wrote changelog to %s\n", output)
+}
+
+// runRelease builds, packages and publishes a release of version. Nightly
+// releases are published under the rolling nightly tag instead.
+func runRelease(config Config, version string, nightly bool) {
+	tag := version
+	if nightly {
+		tag = config.Component().NightlyTag()
+	}
+
+	// The release may target another ref than the checked-out HEAD
+	targetRef := "HEAD"
+	if config.Target != "" {
+		targetRef = config.Target
+		if (len(config.VersionFiles) > 0 || config.ChangelogFile != "") && !nightly {
+			fatalf("Error: VERSION_FILES and CHANGELOG_FILE can't be combined with a release target, the version commit is made on HEAD")
+		}
+	}
+	target, err := gitOutput("rev-parse", "--verify", "--quiet", targetRef+"^{commit}")
+	if err != nil {
+		fatalf("Error: %s is not a commit", targetRef)
+	}
+	if config.Target != "" {
+		if head, _ := gitOutput("rev-parse", "HEAD"); head != target {
+			ui.Printf("Note: releasing %s, but building from the working tree at HEAD\n", targetRef)
+		}
+	}
+
+	releaser, err := NewGitHubReleaser(config)
+	if err != nil {
+		fatalf("Error creating releaser: %v", err)
+	}
+
+	plugins, err := FindPlugins(config.Plugins)
+	if err != nil {
+		fatalf("Error loading plugins: %v", err)
+	}
+
+	builds := config.AllBuilds()
+	for _, b := range builds {
+		if err := b.Validate(); err != nil {
+			fatalf("Error: %v", err)
+		}
+	}
+
+	if !config.AnyBranch {
+		branches := config.Branches
+		if len(branches) == 0 {
+			branches = []string{"main", "master"}
+		}
+		if err := CheckBranch(branches, releaser.remote, targetRef); err != nil {
+			fatalf("Error: %v\nSwitch to a release branch, or pass --any-branch", err)
+		}
+	}
+
+	// Refuse to release builds of code that isn't committed and pushed
+	if !config.AllowDirty {
+		if err := CheckClean(); err != nil {
+			fatalf("Error: %v\nCommit or stash your changes, or pass --allow-dirty", err)
+		}
+		if err := CheckPushed(releaser.remote, targetRef); err != nil {
+			fatalf("Error: %v\nPush your commits, or pass --allow-dirty", err)
+		}
+	}
+
+	// Catch conflicts before spending time on the build
+	if err := releaser.CheckExisting(tag, target, config.OnExisting); err != nil {
+		fatalf("Error: %v", err)
+	}
+
+	// The changelog is generated before bumping version files and tagging,
+	// since neither the bump commit nor a new tag on HEAD belong in it
+	channel := ReleaseChannel(config.Component(), version)
+	changelogTo := config.ChangelogTo
+	if changelogTo == "" {
+		changelogTo = targetRef
+	}
+	changelog, err := releaser.GenerateChangelog(ChangelogOptions{
+		Version: version,
+		Tag:     tag,
+		Channel: channel,
+		From:    config.ChangelogFrom,
+		To:      changelogTo,
+		Target:  target,
+	})
+	if err != nil {
+		fatalf("Failed to generate changelog: %v", err)
+	}
+	// CHANGELOG_FILE and the tag message get the changelog alone, not what
+	// only belongs in the release notes
+	plainChangelog := releaser.changelog
+
+	if config.Submodules {
+		ui.Step("Updating submodules")
+		if err := UpdateSubmodules(); err != nil {
+			fatalf("Failed to update submodules: %v", err)
+		}
+		subs, err := Submodules()
+		if err != nil {
+			fatalf("Failed to list submodules: %v", err)
+		}
+		changelog += formatSubmodules(subs)
+	}
+
+	if config.EditNotes {
+		if !isTerminal(os.Stdin) {
+			ui.Printf("Not opening an editor for the release notes, stdin is not a terminal\n")
+		} else if changelog, err = EditNotes(changelog); err != nil {
+			fatalf("Error editing release notes: %v", err)
+		}
 	}
 
-	zipFile := "release.zip"
-	defer os.Remove(zipFile) // Cleanup
+	// Translations are made from the final notes, after any edits
+	var notesAssets []string
+	if len(config.NotesLanguages) > 0 {
+		ui.Step("Localizing release notes")
+		if changelog, notesAssets, err = releaser.LocalizeNotes(changelog); err != nil {
+			fatalf("Failed to localize release notes: %v", err)
+		}
+	}
+
+	// Commit version files and the changelog first so the build picks up
+	// the new version and the tag includes them
+	bumped := (len(config.VersionFiles) > 0 || config.ChangelogFile != "") && !nightly
+	if bumped {
+		ui.Step("Updating release files")
+		bare := strings.TrimPrefix(strings.TrimPrefix(version, config.Component().TagPrefix), "v")
+		paths, err := BumpVersionFiles(ParseVersionFiles(config.VersionFiles), bare)
+		if err != nil {
+			fatalf("Failed to update version files: %v", err)
+		}
+		if config.ChangelogFile != "" {
+			if err := UpdateChangelogFile(config.ChangelogFile, bare, time.Now().Format("2006-01-02"), plainChangelog); err != nil {
+				fatalf("Failed to update %s: %v", config.ChangelogFile, err)
+			}
+			paths = append(paths, config.ChangelogFile)
+		}
+		if err := CommitRelease(paths, bare, config.VersionCommitMessage); err != nil {
+			fatalf("Failed to commit release files: %v", err)
+		}
+		// Release the version commit
+		if target, err = gitOutput("rev-parse", "HEAD"); err != nil {
+			fatalf("Failed to resolve HEAD: %v", err)
+		}
+	}
+
+	defer runCleanups()
+
+	pluginReq := PluginRequest{
+		Version: version,
+		Owner:   releaser.ownerName,
+		Repo:    releaser.repoName,
+	}
+
+	info := BuildInfo{
+		Version: strings.TrimPrefix(strings.TrimPrefix(version, config.Component().TagPrefix), "v"),
+		Tag:     tag,
+		Commit:  target,
+		Date:    time.Now().UTC().Format(time.RFC3339),
+	}
+	// Archives are always dated by the released commit, and reproducible
+	// builds date everything by it
+	epoch, err := SourceDateEpoch(target)
+	switch {
+	case err != nil && config.Reproducible:
+		fatalf("Error: %v", err)
+	case err != nil:
+		ui.Printf("Warning: archives will be dated by their files: %v\n", err)
+	default:
+		releaser.sourceDate = time.Unix(epoch, 0).UTC()
+	}
+	if config.Reproducible {
+		info.Date = releaser.sourceDate.Format(time.RFC3339)
+		info.SourceDateEpoch = epoch
+	}
+
+	if err := config.Checksums.Validate(); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := ValidateAssets(config.Assets); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := ValidateAssetLabels(config.AssetLabels); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := ValidateSplitSize(config.SplitSize); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := ValidateSBOM(config.SBOM); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := ValidateDelta(config.DeltaFormat, config.DeltaReleases); err != nil {
+		fatalf("Error: %v", err)
+	}
 
 	// Run build
-	if err := releaser.RunBuild(config.BuildCommand); err != nil {
-		fmt.Printf("Build failed: %v\n", err)
-		os.Exit(1)
+	pluginReq.Event = EventBeforeBuild
+	if err := RunPlugins(plugins, pluginReq); err != nil {
+		fatalf("Plugin failed: %v", err)
+	}
+	if err := RunHook("HOOK_BEFORE_BUILD", config.Hooks.BeforeBuild, info, nil); err != nil {
+		fatalf("Hook failed: %v", err)
+	}
+	built, err := releaser.RunBuilds(builds, info)
+	if err != nil {
+		fatalf("Build failed: %v", err)
 	}
+	artifacts := ArtifactPaths(built)
 
-	// Create ZIP
-	if err := releaser.CreateZip(config.BuildPath, zipFile); err != nil {
-		fmt.Printf("Failed to create ZIP: %v\n", err)
-		os.Exit(1)
+	pluginReq.Artifacts = artifacts
+	pluginReq.Event = EventAfterBuild
+	if err := RunPlugins(plugins, pluginReq); err != nil {
+		fatalf("Plugin failed: %v", err)
+	}
+	if err := RunHook("HOOK_AFTER_BUILD", config.Hooks.AfterBuild, info, artifacts); err != nil {
+		fatalf("Hook failed: %v", err)
+	}
+	// Nothing is pushed, tagged or published until verification passes
+	if err := releaser.RunVerify(info, artifacts); err != nil {
+		fatalf("Verify failed: %v", err)
+	}
+
+	manifest := Manifest{Version: info.Version, Tag: tag, Commit: target, Artifacts: built}
+	for _, path := range notesAssets {
+		manifest.Artifacts = append(manifest.Artifacts, newArtifact(path, ArtifactNotes))
+	}
+	if config.SourceArchive {
+		ui.Step("Writing source archive")
+		path, err := releaser.WriteSourceArchive(info)
+		if err != nil {
+			fatalf("Failed to write source archive: %v", err)
+		}
+		manifest.Artifacts = append(manifest.Artifacts, newArtifact(path, ArtifactSource))
+	}
+	// Extra assets may come from the builds, so they're matched afterwards,
+	// and what a build released already isn't uploaded twice
+	extra, err := CollectAssets(config.Assets)
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	released := map[string]bool{}
+	for _, a := range manifest.Artifacts {
+		released[a.Path] = true
+	}
+	for _, path := range extra {
+		if a := newArtifact(path, ArtifactAsset); !released[a.Path] {
+			manifest.Artifacts = append(manifest.Artifacts, a)
+		}
+	}
+	// Patches are made from whole files, before any are split
+	patches, err := releaser.WritePatches(info, manifest.Artifacts)
+	if err != nil {
+		fatalf("Failed to write patches: %v", err)
+	}
+	manifest.Artifacts = append(manifest.Artifacts, patches...)
+	if manifest.Artifacts, err = SplitArtifacts(config.SplitSize, manifest.Artifacts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := CheckAssetNames(manifest.Artifacts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if err := CheckAssetSizes(manifest.Artifacts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	// The checksums cover every other asset
+	if config.Checksums.Enabled || config.Checksums.Sidecars {
+		ui.Step("Writing checksums")
+		files, err := WriteChecksums(config.Checksums, ArtifactPaths(manifest.Artifacts))
+		if err != nil {
+			fatalf("Failed to write checksums: %v", err)
+		}
+		for _, path := range files {
+			manifest.Artifacts = append(manifest.Artifacts, newArtifact(path, ArtifactChecksums))
+		}
+	}
+	if err := LabelArtifacts(config.AssetLabels, manifest.Artifacts); err != nil {
+		fatalf("Error: %v", err)
+	}
+	if config.ArtifactsManifest != "" {
+		ui.Step("Writing %s", config.ArtifactsManifest)
+		if err := WriteManifest(config.ArtifactsManifest, manifest); err != nil {
+			fatalf("Failed to write artifacts manifest: %v", err)
+		}
 	}
 
 	// Create release
-	if err := releaser.CreateRelease(version, zipFile); err != nil {
-		fmt.Printf("Failed to create release: %v\n", err)
-		os.Exit(1)
+	if len(plugins) > 0 {
+		if err := DescribeArtifacts(manifest.Artifacts); err != nil {
+			fatalf("Error: %v", err)
+		}
+		pluginReq.Assets = manifest.Artifacts
+	}
+	pluginReq.Event = EventBeforePublish
+	if err := RunPlugins(plugins, pluginReq); err != nil {
+		fatalf("Plugin failed: %v", err)
+	}
+	if err := RunHook("HOOK_BEFORE_PUBLISH", config.Hooks.BeforePublish, info, artifacts); err != nil {
+		fatalf("Hook failed: %v", err)
+	}
+	if bumped {
+		ui.Step("Pushing version bump")
+		if err := PushBranch(releaser.remote); err != nil {
+			fatalf("Failed to push version bump: %v", err)
+		}
+	}
+	switch {
+	case nightly:
+		// The rolling tag always moves, whether or not tags are created
+		ui.Step("Moving tag %s", tag)
+		if err := MoveTag(releaser.remote, tag, target); err != nil {
+			fatalf("Failed to move tag: %v", err)
+		}
+	case config.CreateTag:
+		ui.Step("Creating tag %s", version)
+		message := fmt.Sprintf("Release %s\n\n%s", version, plainChangelog)
+		signing := TagSigning{Enabled: config.SignTag, Key: config.SigningKey, Format: config.SigningFormat}
+		if err := CreateTag(version, target, message, signing); err != nil {
+			fatalf("Failed to create tag: %v", err)
+		}
+		if err := PushTag(releaser.remote, version); err != nil {
+			fatalf("Failed to push tag: %v", err)
+		}
+	}
+	// Pin the release to its commit rather than whatever the default
+	// branch points at, which matters on a detached HEAD
+	params := ReleaseParams{
+		Version: tag,
+		Target:  target,
+		Name:    fmt.Sprintf("Release %s", version),
+		Body:    changelog,
+		// Any semver pre-release, from --channel or given explicitly
+		Prerelease: channel != "",
+		OnExisting: config.OnExisting,
+	}
+	if comp := config.Component(); comp.TagPrefix != "" {
+		params.Name = fmt.Sprintf("%s %s", comp.Name(), strings.TrimPrefix(version, comp.TagPrefix))
+	}
+	if nightly {
+		params.Name = strings.TrimSpace(fmt.Sprintf("%s Nightly %s", config.Component().Name(), strings.TrimPrefix(version, config.Component().TagPrefix)))
+	}
+	urls, err := releaser.CreateRelease(params, manifest.Artifacts)
+	if err != nil {
+		fatalf("Failed to create release: %v", err)
+	}
+	// Downstream jobs find the assets by their URLs
+	for i := range manifest.Artifacts {
+		manifest.Artifacts[i].URL = urls[manifest.Artifacts[i].Path]
+	}
+	if config.ArtifactsManifest != "" {
+		if err := WriteManifest(config.ArtifactsManifest, manifest); err != nil {
+			ui.Printf("Warning: failed to update artifacts manifest: %v\n", err)
+		}
+	}
+
+	// Custom publish targets run once the GitHub release exists
+	pluginReq.Event = EventPublish
+	if err := RunPlugins(plugins, pluginReq); err != nil {
+		fatalf("Plugin failed: %v", err)
+	}
+	if err := RunHook("HOOK_AFTER_PUBLISH", config.Hooks.AfterPublish, info, artifacts); err != nil {
+		fatalf("Hook failed: %v", err)
 	}
 
+	ui.Done(nil)
 	fmt.Printf("Successfully created release %s\n", version)
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Artifact types
+const (
+	// ArtifactArchive is an archive of a build's output
+	ArtifactArchive = "archive"
+	// ArtifactBinary is a Go binary released as it is, or gzipped
+	ArtifactBinary = "binary"
+	// ArtifactPackage is a Linux package of a Go target
+	ArtifactPackage = "package"
+	// ArtifactInstaller is a desktop installer of a Go target
+	ArtifactInstaller = "installer"
+	// ArtifactSBOM is the software bill of materials of another artifact
+	ArtifactSBOM = "sbom"
+	// ArtifactPrebuilt is a file released as it is, from BUILD_ARTIFACTS
+	ArtifactPrebuilt = "prebuilt"
+	// ArtifactLog is the build log
+	ArtifactLog = "log"
+	// ArtifactNotes is a translation of the release notes
+	ArtifactNotes = "notes"
+	// ArtifactSource is the source archive of the released commit
+	ArtifactSource = "source"
+	// ArtifactAsset is a file matching the ASSETS patterns
+	ArtifactAsset = "asset"
+	// ArtifactJoinScript joins the parts of a file split by SPLIT_SIZE,
+	// which keep the type of the file
+	ArtifactJoinScript = "join-script"
+	// ArtifactPatch is a binary patch from an asset of an earlier release
+	ArtifactPatch = "patch"
+	// ArtifactPatchManifest lists the patches
+	ArtifactPatchManifest = "patch-manifest"
+	// ArtifactChecksums is a checksums or sidecar file
+	ArtifactChecksums = "checksums"
+)
+
+// Artifact is a file produced for a release
+type Artifact struct {
+	// Name is the file's name, which is also its asset name
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"`
+	// Platform is the GOOS/GOARCH target of Go builds
+	Platform string `json:"platform,omitempty"`
+	// Build is the name of the build it comes from, empty for the default
+	// build and artifacts not made by a build
+	Build  string `json:"build,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Label is the asset's name in GitHub's release page, from ASSET_LABELS
+	Label string `json:"label,omitempty"`
+	// URL is the asset's download URL, once uploaded
+	URL string `json:"url,omitempty"`
+}
+
+// newArtifact describes the file at path
+func newArtifact(path, typ string) Artifact {
+	return Artifact{Name: filepath.Base(path), Path: filepath.ToSlash(path), Type: typ}
+}
+
+// ArtifactPaths returns the paths of artifacts
+func ArtifactPaths(artifacts []Artifact) []string {
+	paths := make([]string, len(artifacts))
+	for i, a := range artifacts {
+		paths[i] = a.Path
+	}
+	return paths
+}
+
+// Manifest is the ARTIFACTS_MANIFEST, describing a release's artifacts for
+// other tools
+type Manifest struct {
+	Version   string     `json:"version"`
+	Tag       string     `json:"tag"`
+	Commit    string     `json:"commit"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// DescribeArtifacts fills in the size and checksum of the artifacts that
+// don't have them yet
+func DescribeArtifacts(artifacts []Artifact) error {
+	for i := range artifacts {
+		a := &artifacts[i]
+		if a.SHA256 != "" {
+			continue
+		}
+		sum, size, err := fileSHA256(filepath.FromSlash(a.Path))
+		if err != nil {
+			return err
+		}
+		a.SHA256, a.Size = sum, size
+	}
+	return nil
+}
+
+// WriteManifest fills in the size and checksum of every artifact and
+// writes the manifest as JSON to path
+func WriteManifest(path string, m Manifest) error {
+	if err := DescribeArtifacts(m.Artifacts); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 checksum and the size of a file
+func fileSHA256(path string) (string, int64, error) {
+	return fileChecksum(path, sha256.New)
+}
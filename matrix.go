@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// parseTargetPattern parses a GOOS/GOARCH pattern, where either part may
+// be a glob such as *
+func parseTargetPattern(key, pattern string) (string, string, error) {
+	goos, goarch, ok := strings.Cut(strings.TrimSpace(pattern), "/")
+	if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+		return "", "", fmt.Errorf("invalid %s entry %q (expected GOOS/GOARCH)", key, pattern)
+	}
+	for _, part := range []string{goos, goarch} {
+		if _, err := path.Match(part, ""); err != nil {
+			return "", "", fmt.Errorf("invalid %s entry %q: %w", key, pattern, err)
+		}
+	}
+	return goos, goarch, nil
+}
+
+// matchTarget reports whether a valid GOOS/GOARCH pattern matches a target
+func matchTarget(pattern string, t GoTarget) bool {
+	goos, goarch, _ := strings.Cut(strings.TrimSpace(pattern), "/")
+	osMatch, _ := path.Match(goos, t.OS)
+	archMatch, _ := path.Match(goarch, t.Arch)
+	return osMatch && archMatch
+}
+
+// GoTargets returns the targets of a Go build: its TARGETS, followed by
+// every combination of its GOOS and GOARCH, without duplicates and the
+// ones matching an IGNORE pattern
+func (b Build) GoTargets() ([]GoTarget, error) {
+	listed, err := ParseGoTargets(b.Key("TARGETS"), b.Targets)
+	if err != nil {
+		return nil, err
+	}
+	for _, goos := range b.Goos {
+		for _, goarch := range b.Goarch {
+			listed = append(listed, GoTarget{OS: goos, Arch: goarch})
+		}
+	}
+	for _, pattern := range b.Ignore {
+		if _, _, err := parseTargetPattern(b.Key("IGNORE"), pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	var targets []GoTarget
+	seen := map[GoTarget]bool{}
+	for _, t := range listed {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		ignored := false
+		for _, pattern := range b.Ignore {
+			ignored = ignored || matchTarget(pattern, t)
+		}
+		if !ignored {
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// validateTargetEnv checks the TARGET_ENV entries of a build, of the form
+// GOOS/GOARCH=KEY=VALUE
+func (b Build) validateTargetEnv() error {
+	for _, entry := range b.TargetEnv {
+		pattern, variable, ok := strings.Cut(entry, "=")
+		if key, _, hasValue := strings.Cut(variable, "="); !ok || !hasValue || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid %s entry %q (expected GOOS/GOARCH=KEY=VALUE)", b.Key("TARGET_ENV"), entry)
+		}
+		if _, _, err := parseTargetPattern(b.Key("TARGET_ENV"), pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetEnv returns the TARGET_ENV variables of the entries matching a
+// target, in order, so later entries override earlier ones
+func (b Build) targetEnv(t GoTarget) []string {
+	var env []string
+	for _, entry := range b.TargetEnv {
+		pattern, variable, _ := strings.Cut(entry, "=")
+		if matchTarget(pattern, t) {
+			key, value, _ := strings.Cut(variable, "=")
+			env = append(env, strings.TrimSpace(key)+"="+value)
+		}
+	}
+	return env
+}
+
+// validateTargetFormat checks the TARGET_FORMAT entries of a build, of the
+// form GOOS/GOARCH=format
+func (b Build) validateTargetFormat() error {
+	for _, entry := range b.TargetFormat {
+		pattern, format, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s entry %q (expected GOOS/GOARCH=format)", b.Key("TARGET_FORMAT"), entry)
+		}
+		if _, _, err := parseTargetPattern(b.Key("TARGET_FORMAT"), pattern); err != nil {
+			return err
+		}
+		if !validFormat(strings.TrimSpace(format)) {
+			return fmt.Errorf("unknown format %q in %s (expected %s)", format, b.Key("TARGET_FORMAT"), strings.Join(archiveFormats, ", "))
+		}
+	}
+	return nil
+}
+
+// targetFormats returns the formats of a build's TARGET_FORMAT entries
+func (b Build) targetFormats() []string {
+	var formats []string
+	for _, entry := range b.TargetFormat {
+		_, format, _ := strings.Cut(entry, "=")
+		formats = append(formats, strings.TrimSpace(format))
+	}
+	return formats
+}
+
+// TargetArchiveFormat returns the format of a target's archive: that of
+// the last TARGET_FORMAT entry matching it, or the build's
+func (b Build) TargetArchiveFormat(t GoTarget) string {
+	format := b.ArchiveFormat()
+	for _, entry := range b.TargetFormat {
+		pattern, f, _ := strings.Cut(entry, "=")
+		if matchTarget(pattern, t) {
+			format = strings.TrimSpace(f)
+		}
+	}
+	return format
+}
+
+// TargetArchiveOptions returns how a target's binary is archived
+func (b Build) TargetArchiveOptions(t GoTarget) ArchiveOptions {
+	opts := b.ArchiveOptions()
+	opts.Format = b.TargetArchiveFormat(t)
+	opts.Level, _ = b.CompressionLevel(opts.Format)
+	return opts
+}
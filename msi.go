@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// msiArchs maps GOARCH values to the architectures of wixl, which only
+// builds x86 installers
+var msiArchs = map[string]string{
+	"386":   "x86",
+	"amd64": "x64",
+}
+
+// writeMSI builds an MSI installer of a Windows app in dir with wixl, from
+// msitools. It installs the app's files in Program Files and adds its Start
+// Menu shortcuts, and later versions upgrade it in place.
+func writeMSI(dir string, app desktopApp) (string, error) {
+	arch, ok := msiArchs[app.Arch]
+	if !ok {
+		return "", fmt.Errorf("no MSI architecture for %s", app.Arch)
+	}
+	wixl, err := exec.LookPath("wixl")
+	if err != nil {
+		return "", fmt.Errorf("msi installers need wixl: %w", err)
+	}
+	source, err := msiSource(app, arch)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp("", "greleaser-msi-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	sourcePath := filepath.Join(tmp, "installer.wxs")
+	if err := os.WriteFile(sourcePath, []byte(source), 0644); err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, app.installerName("windows", ".msi"))
+	cmd := exec.Command(wixl, "--arch", arch, "--output", out, sourcePath)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("wixl failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return out, nil
+}
+
+// xmlAttr escapes s for an XML attribute
+func xmlAttr(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// msiSource returns the WiX source of an MSI installer. GUIDs are derived
+// from the app's name and the files' paths, so components keep theirs
+// across versions.
+func msiSource(app desktopApp, arch string) (string, error) {
+	win64, programFiles := "no", "ProgramFilesFolder"
+	if arch == "x64" {
+		win64, programFiles = "yes", "ProgramFiles64Folder"
+	}
+	files := map[string][]int{}
+	for i, f := range app.Files {
+		dir := path.Dir(f.Name)
+		files[dir] = append(files[dir], i)
+	}
+	subdirs := map[string][]string{}
+	for _, dir := range app.dirs() {
+		parent := path.Dir(dir)
+		subdirs[parent] = append(subdirs[parent], dir)
+	}
+
+	var s strings.Builder
+	var components []string
+	var writeDir func(dir, indent string) error
+	writeDir = func(dir, indent string) error {
+		for _, i := range files[dir] {
+			f := app.Files[i]
+			src, err := filepath.Abs(f.Src)
+			if err != nil {
+				return err
+			}
+			id := fmt.Sprintf("File%d", i)
+			fmt.Fprintf(&s, "%s<Component Id=\"C%s\" Guid=\"%s\" Win64=\"%s\">\n", indent, id, app.guid("file:"+f.Name), win64)
+			fmt.Fprintf(&s, "%s  <File Id=\"%s\" Name=\"%s\" Source=\"%s\" KeyPath=\"yes\"/>\n", indent, id, xmlAttr(path.Base(f.Name)), xmlAttr(src))
+			fmt.Fprintf(&s, "%s</Component>\n", indent)
+			components = append(components, "C"+id)
+		}
+		for _, sub := range subdirs[dir] {
+			fmt.Fprintf(&s, "%s<Directory Id=\"Dir%s\" Name=\"%s\">\n", indent, strings.ReplaceAll(app.guid("dir:"+sub), "-", ""), xmlAttr(path.Base(sub)))
+			if err := writeDir(sub, indent+"  "); err != nil {
+				return err
+			}
+			fmt.Fprintf(&s, "%s</Directory>\n", indent)
+		}
+		return nil
+	}
+
+	s.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	s.WriteString("<Wix xmlns=\"http://schemas.microsoft.com/wix/2006/wi\">\n")
+	fmt.Fprintf(&s, "  <Product Id=\"*\" Name=\"%s\" Language=\"1033\" Version=\"%s\" Manufacturer=\"%s\" UpgradeCode=\"%s\">\n",
+		xmlAttr(app.AppName), app.fileVersion(), xmlAttr(app.Publisher), app.upgradeCode())
+	fmt.Fprintf(&s, "    <Package InstallerVersion=\"500\" Compressed=\"yes\" InstallScope=\"perMachine\" Description=\"%s\" Manufacturer=\"%s\"/>\n",
+		xmlAttr(app.Description), xmlAttr(app.Publisher))
+	fmt.Fprintf(&s, "    <MajorUpgrade DowngradeErrorMessage=\"A newer version of %s is already installed.\"/>\n", xmlAttr(app.AppName))
+	s.WriteString("    <Media Id=\"1\" Cabinet=\"app.cab\" EmbedCab=\"yes\"/>\n")
+	if app.Homepage != "" {
+		fmt.Fprintf(&s, "    <Property Id=\"ARPURLINFOABOUT\" Value=\"%s\"/>\n", xmlAttr(app.Homepage))
+	}
+	s.WriteString("    <Directory Id=\"TARGETDIR\" Name=\"SourceDir\">\n")
+	fmt.Fprintf(&s, "      <Directory Id=\"%s\">\n", programFiles)
+	fmt.Fprintf(&s, "        <Directory Id=\"INSTALLDIR\" Name=\"%s\">\n", xmlAttr(app.Dir))
+	if err := writeDir(".", "          "); err != nil {
+		return "", err
+	}
+	s.WriteString("        </Directory>\n      </Directory>\n")
+
+	labels, targets := app.shortcuts()
+	if len(labels) > 0 {
+		s.WriteString("      <Directory Id=\"ProgramMenuFolder\">\n")
+		fmt.Fprintf(&s, "        <Directory Id=\"ShortcutDir\" Name=\"%s\">\n", xmlAttr(app.AppName))
+		fmt.Fprintf(&s, "          <Component Id=\"Shortcuts\" Guid=\"%s\">\n", app.guid("shortcuts"))
+		for i, label := range labels {
+			fmt.Fprintf(&s, "            <Shortcut Id=\"Shortcut%d\" Name=\"%s\" Target=\"[INSTALLDIR]%s\" WorkingDirectory=\"INSTALLDIR\"/>\n",
+				i, xmlAttr(label), xmlAttr(windowsPath(targets[i])))
+		}
+		s.WriteString("            <RemoveFolder Id=\"ShortcutDir\" On=\"uninstall\"/>\n")
+		// Shortcuts need a key path, which only a registry value can be
+		fmt.Fprintf(&s, "            <RegistryValue Root=\"HKCU\" Key=\"Software\\%s\" Name=\"shortcuts\" Type=\"integer\" Value=\"1\" KeyPath=\"yes\"/>\n", xmlAttr(app.AppName))
+		s.WriteString("          </Component>\n        </Directory>\n      </Directory>\n")
+		components = append(components, "Shortcuts")
+	}
+	s.WriteString("    </Directory>\n")
+
+	s.WriteString("    <Feature Id=\"Main\" Level=\"1\">\n")
+	for _, id := range components {
+		fmt.Fprintf(&s, "      <ComponentRef Id=\"%s\"/>\n", id)
+	}
+	s.WriteString("    </Feature>\n  </Product>\n</Wix>\n")
+	return s.String(), nil
+}
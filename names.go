@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// AssetNameData is what a NAME_TEMPLATE can use
+type AssetNameData struct {
+	ProjectName string
+	// Build is the build's name, empty for the default build
+	Build   string
+	Binary  string
+	Version string
+	Tag     string
+	Os      string
+	Arch    string
+	Format  string
+	// Ext is the extension of the default name, such as .tar.gz, or .exe
+	// for a Windows binary released as it is
+	Ext string
+}
+
+// defaultWrapTemplate names the directory archive contents are wrapped in
+// with WRAP
+const defaultWrapTemplate = "{{ .ProjectName }}-{{ .Version }}"
+
+// renderName renders the template of a build's config key into a file
+// name
+func (b Build) renderName(suffix, text string, data AssetNameData) (string, error) {
+	key := b.Key(suffix)
+	tmpl, err := template.New(key).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", key, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", key, err)
+	}
+	name := strings.TrimSpace(out.String())
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%s renders an invalid name %q", key, name)
+	}
+	return name, nil
+}
+
+// AssetName renders the build's NAME_TEMPLATE into an asset name
+func (b Build) AssetName(data AssetNameData) (string, error) {
+	return b.renderName("NAME_TEMPLATE", b.NameTemplate, data)
+}
+
+// WrapDir renders the directory the build's archive contents are wrapped
+// in, empty without WRAP
+func (b Build) WrapDir(data AssetNameData) (string, error) {
+	if !b.Wrap {
+		return "", nil
+	}
+	text := b.WrapTemplate
+	if text == "" {
+		text = defaultWrapTemplate
+	}
+	return b.renderName("WRAP_TEMPLATE", text, data)
+}
+
+// wrapOptions sets the directory archive contents are wrapped in
+func (b Build) wrapOptions(opts ArchiveOptions, data AssetNameData) (ArchiveOptions, error) {
+	var err error
+	opts.Wrap, err = b.WrapDir(data)
+	return opts, err
+}
+
+// validateNameTemplates checks that the NAME_TEMPLATE and WRAP_TEMPLATE
+// render
+func (b Build) validateNameTemplates() error {
+	data := AssetNameData{ProjectName: "project", Binary: "binary", Version: "1.0.0", Tag: "v1.0.0", Os: "os", Arch: "arch", Format: "zip", Ext: ".zip"}
+	if b.NameTemplate != "" {
+		if _, err := b.AssetName(data); err != nil {
+			return err
+		}
+	}
+	if b.WrapTemplate != "" && !b.Wrap {
+		return fmt.Errorf("%s needs %s", b.Key("WRAP_TEMPLATE"), b.Key("WRAP"))
+	}
+	_, err := b.WrapDir(data)
+	return err
+}
+
+// targetData returns what the templates of a Go target can use
+func (b Build) targetData(gb GoBuild, project string, t GoTarget) AssetNameData {
+	format := b.TargetArchiveFormat(t)
+	return AssetNameData{
+		ProjectName: project,
+		Build:       b.Name,
+		Binary:      gb.Binary,
+		Version:     gb.Info.Version,
+		Tag:         gb.Info.Tag,
+		Os:          t.OS,
+		Arch:        t.Arch,
+		Format:      format,
+		Ext:         gb.ext(t, format),
+	}
+}
+
+// commandData returns what the templates of a command build, or of its
+// prebuilt artifacts, can use, with the platform of the machine building it
+func (b Build) commandData(project string, info BuildInfo, format string) AssetNameData {
+	return AssetNameData{
+		ProjectName: project,
+		Build:       b.Name,
+		Binary:      b.Binary,
+		Version:     info.Version,
+		Tag:         info.Tag,
+		Os:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Format:      format,
+		Ext:         "." + format,
+	}
+}
+
+// targetNames renders the asset names of a Go build's targets, which must
+// differ from each other. It returns nil without a NAME_TEMPLATE.
+func (b Build) targetNames(gb GoBuild, project string) (map[GoTarget]string, error) {
+	if b.NameTemplate == "" {
+		return nil, nil
+	}
+	targets := gb.Targets
+	if b.Universal {
+		targets = append(targets[:len(targets):len(targets)], darwinUniversal)
+	}
+
+	names := map[GoTarget]string{}
+	seen := map[string]GoTarget{}
+	for _, t := range targets {
+		name, err := b.AssetName(b.targetData(gb, project, t))
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s gives %s and %s the same name %s", b.Key("NAME_TEMPLATE"), other, t, name)
+		}
+		seen[name] = t
+		names[t] = name
+	}
+	return names, nil
+}
+
+// commandArchiveName returns the archive name of a command build: the
+// rendered NAME_TEMPLATE, or else release.<format> for the default build
+// and <name>_<version>.<format> for named ones
+func (b Build) commandArchiveName(project string, info BuildInfo, format string) (string, error) {
+	if b.NameTemplate != "" {
+		return b.AssetName(b.commandData(project, info, format))
+	}
+	// The default build keeps its historical asset name
+	if b.Name == "" {
+		return "release." + format, nil
+	}
+	return fmt.Sprintf("%s_%s.%s", b.Name, info.Version, format), nil
+}
+
+// ext returns the extension of a target's asset in a format
+func (b GoBuild) ext(t GoTarget, format string) string {
+	switch format {
+	case FormatBinary:
+		return filepath.Ext(b.BinaryName(t))
+	case FormatGz:
+		return filepath.Ext(b.BinaryName(t)) + ".gz"
+	}
+	return "." + format
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// nodePackageManager is a Node.js package manager recognized by its
+// lockfile
+type nodePackageManager struct {
+	Name      string
+	Lockfiles []string
+	// Install installs exactly the locked dependencies
+	Install []string
+}
+
+// nodePackageManagers lists the package managers in the order their
+// lockfiles are looked for
+var nodePackageManagers = []nodePackageManager{
+	{Name: "pnpm", Lockfiles: []string{"pnpm-lock.yaml"}, Install: []string{"pnpm", "install", "--frozen-lockfile"}},
+	{Name: "yarn", Lockfiles: []string{"yarn.lock"}, Install: []string{"yarn", "install", "--frozen-lockfile"}},
+	{Name: "bun", Lockfiles: []string{"bun.lockb", "bun.lock"}, Install: []string{"bun", "install", "--frozen-lockfile"}},
+	{Name: "npm", Lockfiles: []string{"package-lock.json", "npm-shrinkwrap.json"}, Install: []string{"npm", "ci"}},
+}
+
+// DetectNodePackageManager returns the package manager of the Node.js
+// project in dir, by its lockfile
+func DetectNodePackageManager(dir string) (nodePackageManager, bool) {
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err != nil {
+		return nodePackageManager{}, false
+	}
+	for _, pm := range nodePackageManagers {
+		for _, lockfile := range pm.Lockfiles {
+			if _, err := os.Stat(filepath.Join(dir, lockfile)); err == nil {
+				pm := pm
+				// Yarn 2+ projects have a .yarnrc.yml and renamed the flag
+				if pm.Name == "yarn" {
+					if _, err := os.Stat(filepath.Join(dir, ".yarnrc.yml")); err == nil {
+						pm.Install = []string{"yarn", "install", "--immutable"}
+					}
+				}
+				return pm, true
+			}
+		}
+	}
+	return nodePackageManager{}, false
+}
+
+// Build returns the command running the project's build script
+func (pm nodePackageManager) Build() []string {
+	return []string{pm.Name, "run", "build"}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// writeNSIS builds an NSIS installer of a Windows app in dir with
+// makensis. It installs the app's files in Program Files, adds its Start
+// Menu shortcuts, and registers an uninstaller in Apps & Features.
+func writeNSIS(dir string, app desktopApp) (string, error) {
+	makensis, err := exec.LookPath("makensis")
+	if err != nil {
+		return "", fmt.Errorf("nsis installers need makensis: %w", err)
+	}
+	out, err := filepath.Abs(filepath.Join(dir, app.installerName("windows", "_setup.exe")))
+	if err != nil {
+		return "", err
+	}
+	script, err := nsisScript(app, out)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp("", "greleaser-nsis-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	scriptPath := filepath.Join(tmp, "installer.nsi")
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(makensis, "-V2", "-INPUTCHARSET", "UTF8", scriptPath)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("makensis failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return filepath.Join(dir, filepath.Base(out)), nil
+}
+
+// nsisEscape escapes s for a quoted NSIS string, in which $ starts a
+// variable
+func nsisEscape(s string) string {
+	s = strings.ReplaceAll(s, "$", "$$")
+	return strings.ReplaceAll(s, `"`, `$\"`)
+}
+
+// nsisString quotes s for an NSIS script
+func nsisString(s string) string {
+	return `"` + nsisEscape(s) + `"`
+}
+
+// nsisInstalled quotes the path of an installed file, name being
+// slash-separated and relative to the installation directory
+func nsisInstalled(name string) string {
+	if name == "" {
+		return `"$INSTDIR"`
+	}
+	return `"$INSTDIR\` + nsisEscape(windowsPath(name)) + `"`
+}
+
+// nsisScript returns the NSIS script of an installer written to out
+func nsisScript(app desktopApp, out string) (string, error) {
+	programFiles := "$PROGRAMFILES64"
+	if app.Arch == "386" {
+		programFiles = "$PROGRAMFILES"
+	}
+	uninstallKey := nsisString(`Software\Microsoft\Windows\CurrentVersion\Uninstall\` + app.AppName)
+	menuDir := `$SMPROGRAMS\` + nsisEscape(app.AppName)
+	// Shared by the installer and the uninstaller
+	regView := ""
+	if app.Arch != "386" {
+		regView = "\tSetRegView 64\n"
+	}
+
+	var s strings.Builder
+	s.WriteString("Unicode true\nSetCompressor /SOLID lzma\nRequestExecutionLevel admin\n")
+	fmt.Fprintf(&s, "Name %s\n", nsisString(app.AppName))
+	fmt.Fprintf(&s, "OutFile %s\n", nsisString(out))
+	fmt.Fprintf(&s, "InstallDir \"%s\\%s\"\n", programFiles, nsisEscape(app.Dir))
+	fmt.Fprintf(&s, "VIProductVersion %s\n", app.fileVersion())
+	for _, key := range []struct{ name, value string }{
+		{"ProductName", app.AppName},
+		{"ProductVersion", app.Version},
+		{"FileVersion", app.Version},
+		{"FileDescription", app.Description},
+		{"CompanyName", app.Publisher},
+	} {
+		if key.value != "" {
+			fmt.Fprintf(&s, "VIAddVersionKey %s %s\n", key.name, nsisString(key.value))
+		}
+	}
+	s.WriteString("\nPage directory\nPage instfiles\nUninstPage uninstConfirm\nUninstPage instfiles\n")
+
+	s.WriteString("\nSection\n" + regView)
+	for _, f := range app.Files {
+		src, err := filepath.Abs(f.Src)
+		if err != nil {
+			return "", err
+		}
+		dir, name := path.Split(f.Name)
+		fmt.Fprintf(&s, "\tSetOutPath %s\n", nsisInstalled(strings.TrimSuffix(dir, "/")))
+		fmt.Fprintf(&s, "\tFile %s %s\n", nsisString("/oname="+name), nsisString(src))
+	}
+	s.WriteString("\tSetOutPath \"$INSTDIR\"\n")
+	s.WriteString("\tWriteUninstaller \"$INSTDIR\\uninstall.exe\"\n")
+	labels, files := app.shortcuts()
+	if len(labels) > 0 {
+		fmt.Fprintf(&s, "\tCreateDirectory \"%s\"\n", menuDir)
+	}
+	for i, label := range labels {
+		fmt.Fprintf(&s, "\tCreateShortcut \"%s\\%s.lnk\" %s\n", menuDir, nsisEscape(label), nsisInstalled(files[i]))
+	}
+	for _, value := range []struct{ name, value string }{
+		{"DisplayName", nsisString(app.AppName)},
+		{"DisplayVersion", nsisString(app.Version)},
+		{"Publisher", nsisString(app.Publisher)},
+		{"URLInfoAbout", nsisString(app.Homepage)},
+		{"InstallLocation", nsisInstalled("")},
+		{"UninstallString", `'"$INSTDIR\uninstall.exe"'`},
+	} {
+		if value.value != `""` {
+			fmt.Fprintf(&s, "\tWriteRegStr HKLM %s %s %s\n", uninstallKey, value.name, value.value)
+		}
+	}
+	fmt.Fprintf(&s, "\tWriteRegDWORD HKLM %s NoModify 1\n", uninstallKey)
+	fmt.Fprintf(&s, "\tWriteRegDWORD HKLM %s NoRepair 1\n", uninstallKey)
+	s.WriteString("SectionEnd\n")
+
+	// Only what was installed is removed, not files the user added
+	s.WriteString("\nSection \"Uninstall\"\n" + regView)
+	for _, f := range app.Files {
+		fmt.Fprintf(&s, "\tDelete %s\n", nsisInstalled(f.Name))
+	}
+	dirs := app.dirs()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		fmt.Fprintf(&s, "\tRMDir %s\n", nsisInstalled(dirs[i]))
+	}
+	s.WriteString("\tDelete \"$INSTDIR\\uninstall.exe\"\n\tRMDir \"$INSTDIR\"\n")
+	for _, label := range labels {
+		fmt.Fprintf(&s, "\tDelete \"%s\\%s.lnk\"\n", menuDir, nsisEscape(label))
+	}
+	if len(labels) > 0 {
+		fmt.Fprintf(&s, "\tRMDir \"%s\"\n", menuDir)
+	}
+	fmt.Fprintf(&s, "\tDeleteRegKey HKLM %s\n", uninstallKey)
+	s.WriteString("SectionEnd\n")
+	return s.String(), nil
+}
+
+// windowsPath turns a slash-separated path into a Windows one
+func windowsPath(name string) string {
+	return strings.ReplaceAll(name, "/", `\`)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Linux package formats, which are also the packages' extensions
+const (
+	PackageDeb = "deb"
+	PackageRPM = "rpm"
+	PackageAPK = "apk"
+)
+
+// packageFormats lists the supported PACKAGES values
+var packageFormats = []string{PackageDeb, PackageRPM, PackageAPK}
+
+// PackageInfo describes the Linux packages of a Go build
+type PackageInfo struct {
+	// Name is the package's name, the binary's by default
+	Name        string
+	Maintainer  string
+	Description string
+	Homepage    string
+	License     string
+	// Depends are the packages it depends on
+	Depends []string
+	// SystemdUnit is a unit file installed and enabled with the package
+	SystemdUnit string
+	// ConfigFiles hold src=/etc/path entries of configuration files, which
+	// upgrades don't overwrite once changed
+	ConfigFiles []string
+	// SignCommand is run with the shell for each package, to sign it
+	SignCommand string
+}
+
+// packageNamePattern matches the package names every format accepts
+var packageNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]*$`)
+
+// validatePackages checks the PACKAGES and PACKAGE_* keys of a build
+func (b Build) validatePackages() error {
+	if len(b.Packages) == 0 {
+		return nil
+	}
+	if !b.goMatrix() {
+		return fmt.Errorf("%s only applies to Go builds", b.Key("PACKAGES"))
+	}
+	for _, format := range b.Packages {
+		if !validPackageFormat(format) {
+			return fmt.Errorf("unknown %s format %q (expected %s)", b.Key("PACKAGES"), format, strings.Join(packageFormats, ", "))
+		}
+	}
+	p := b.Package
+	if p.Name != "" && !packageNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid %s %q (expected lowercase letters, digits, ., + and -)", b.Key("PACKAGE_NAME"), p.Name)
+	}
+	if p.Maintainer == "" {
+		return fmt.Errorf("%s is required for packages", b.Key("PACKAGE_MAINTAINER"))
+	}
+	if p.SystemdUnit != "" {
+		if info, err := os.Stat(p.SystemdUnit); err != nil || info.IsDir() {
+			return fmt.Errorf("%s %s is not a file", b.Key("PACKAGE_SYSTEMD_UNIT"), p.SystemdUnit)
+		}
+	}
+	for _, entry := range p.ConfigFiles {
+		src, dst, ok := strings.Cut(entry, "=")
+		if !ok || !path.IsAbs(dst) {
+			return fmt.Errorf("invalid %s entry %q (expected src=/etc/path)", b.Key("PACKAGE_CONFIG_FILES"), entry)
+		}
+		if info, err := os.Stat(src); err != nil || info.IsDir() {
+			return fmt.Errorf("%s %s is not a file", b.Key("PACKAGE_CONFIG_FILES"), src)
+		}
+	}
+	return nil
+}
+
+// validPackageFormat reports whether format is a supported package format
+func validPackageFormat(format string) bool {
+	for _, f := range packageFormats {
+		if format == f {
+			return true
+		}
+	}
+	return false
+}
+
+// packageFile is a file a package installs
+type packageFile struct {
+	// Src is where it is, Dst the absolute path it's installed at
+	Src  string
+	Dst  string
+	Mode int64
+	// Config marks configuration files
+	Config bool
+}
+
+// linuxPackage is what a package of a Go target is built from
+type linuxPackage struct {
+	PackageInfo
+	Version string
+	// Arch is the GOARCH of the binary, which each format names its own way
+	Arch  string
+	Files []packageFile
+	// Date is the time the files get, for identical packages of the same
+	// commit
+	Date time.Time
+}
+
+// dirs returns the directories the package's files are in, parents first
+func (p linuxPackage) dirs() []string {
+	seen := map[string]bool{}
+	for _, f := range p.Files {
+		for dir := path.Dir(f.Dst); dir != "/"; dir = path.Dir(dir) {
+			seen[dir] = true
+		}
+	}
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// unitName returns the name of the package's systemd unit, empty if it has
+// none
+func (p linuxPackage) unitName() string {
+	if p.SystemdUnit == "" {
+		return ""
+	}
+	return filepath.Base(p.SystemdUnit)
+}
+
+// systemdScripts returns the scripts run after installing, before removing
+// and after removing a package with a systemd unit, where removing is the
+// format's shell condition telling a removal from an upgrade. They do
+// nothing on systems without systemd, such as containers.
+func (p linuxPackage) systemdScripts(removing string) (postinst, prerm, postrm string) {
+	unit := p.unitName()
+	if unit == "" {
+		return "", "", ""
+	}
+	const shebang = "#!/bin/sh\nset -e\n"
+	guard := "if [ -d /run/systemd/system ]; then\n"
+	postinst = shebang + guard + "\tsystemctl daemon-reload\n\tsystemctl enable " + unit + " || true\nfi\n"
+	prerm = shebang + "if [ -d /run/systemd/system ] && " + removing + "; then\n\tsystemctl disable --now " + unit + " || true\nfi\n"
+	postrm = shebang + guard + "\tsystemctl daemon-reload || true\nfi\n"
+	return postinst, prerm, postrm
+}
+
+// packageVersion returns the version of a package. Pre-releases come after
+// a ~, which sorts before the release itself.
+func packageVersion(version string) string {
+	return strings.Replace(version, "-", "~", 1)
+}
+
+// linuxPackage describes the package of a linux target: its binary in
+// /usr/bin, and the systemd unit and configuration files
+func (b Build) linuxPackage(gb GoBuild, t GoTarget, date time.Time) linuxPackage {
+	p := linuxPackage{PackageInfo: b.Package, Version: gb.Info.Version, Arch: t.Arch, Date: date}
+	if p.Name == "" {
+		p.Name = strings.ToLower(gb.Binary)
+	}
+	if p.Description == "" {
+		p.Description = p.Name
+	}
+	p.Files = append(p.Files, packageFile{
+		Src:  filepath.Join(gb.Dir(t), gb.BinaryName(t)),
+		Dst:  "/usr/bin/" + gb.BinaryName(t),
+		Mode: 0755,
+	})
+	if p.SystemdUnit != "" {
+		p.Files = append(p.Files, packageFile{Src: p.SystemdUnit, Dst: "/usr/lib/systemd/system/" + p.unitName(), Mode: 0644})
+	}
+	for _, entry := range p.ConfigFiles {
+		src, dst, _ := strings.Cut(entry, "=")
+		p.Files = append(p.Files, packageFile{Src: src, Dst: path.Clean(dst), Mode: 0644, Config: true})
+	}
+	return p
+}
+
+// BuildPackages builds the PACKAGES of a Go target into the output
+// directory. Only linux targets are packaged.
+func (g *GitHubReleaser) BuildPackages(b Build, gb GoBuild, t GoTarget, log buildLog) ([]string, error) {
+	if t.OS != "linux" || len(b.Packages) == 0 {
+		return nil, nil
+	}
+	date := g.sourceDate
+	if date.IsZero() {
+		date = time.Now().UTC().Truncate(time.Second)
+	}
+	p := b.linuxPackage(gb, t, date)
+	if !packageNamePattern.MatchString(p.Name) {
+		return nil, fmt.Errorf("invalid package name %q, set %s", p.Name, b.Key("PACKAGE_NAME"))
+	}
+
+	var paths []string
+	for _, format := range b.Packages {
+		var out string
+		var err error
+		switch format {
+		case PackageDeb:
+			out, err = writeDeb(gb.OutDir, p)
+		case PackageRPM:
+			out, err = writeRPM(gb.OutDir, p)
+		case PackageAPK:
+			out, err = writeAPK(gb.OutDir, p)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s package: %w", format, err)
+		}
+		log.Step("Built %s", out)
+		if err := signPackage(p.SignCommand, out, format, log); err != nil {
+			return nil, err
+		}
+		paths = append(paths, out)
+	}
+	return paths, nil
+}
+
+// signPackage runs the PACKAGE_SIGN_COMMAND for a package, with its path
+// in PACKAGE and its format in PACKAGE_FORMAT. An empty command does
+// nothing.
+func signPackage(command, path, format string, log buildLog) error {
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+	log.Step("Signing %s", path)
+	parts := buildRunner{}.Shell(command)
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Env = append(os.Environ(), "PACKAGE="+path, "PACKAGE_FORMAT="+format)
+	cmd.Stdout = log.Output()
+	cmd.Stderr = log.Output()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to sign %s: %w", path, err)
+	}
+	return nil
+}
+
+// isPackage reports whether path is a Linux package
+func isPackage(path string) bool {
+	for _, format := range packageFormats {
+		if strings.HasSuffix(path, "."+format) {
+			return true
+		}
+	}
+	return false
+}
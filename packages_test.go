@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestPackageVersion(t *testing.T) {
+	tests := []struct {
+		version, want string
+	}{
+		{"1.2.3", "1.2.3"},
+		{"1.2.3-rc.1", "1.2.3~rc.1"},
+		{"1.2.3-rc-1", "1.2.3~rc-1"},
+		{"1.2.3+build.1", "1.2.3+build.1"},
+	}
+	for _, tt := range tests {
+		if got := packageVersion(tt.version); got != tt.want {
+			t.Errorf("packageVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultPkgInstallLocation is where .pkg installers put the files unless
+// PKG_INSTALL_LOCATION says otherwise
+const defaultPkgInstallLocation = "/usr/local/bin"
+
+// writePKG builds a macOS installer package of an app in dir with
+// pkgbuild, signed with PKG_SIGN_IDENTITY if it is set
+func writePKG(dir string, app desktopApp) (string, error) {
+	pkgbuild, err := exec.LookPath("pkgbuild")
+	if err != nil {
+		return "", fmt.Errorf("pkg installers need pkgbuild: %w", err)
+	}
+	location := app.PkgInstallLocation
+	if location == "" {
+		location = defaultPkgInstallLocation
+	}
+
+	tmp, err := os.MkdirTemp("", "greleaser-pkg-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := app.stage(tmp); err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, app.installerName("darwin", ".pkg"))
+	args := []string{
+		"--root", tmp,
+		"--identifier", app.PkgIdentifier,
+		"--version", app.Version,
+		"--install-location", location,
+	}
+	if app.PkgSignIdentity != "" {
+		args = append(args, "--sign", app.PkgSignIdentity, "--timestamp")
+	}
+	cmd := exec.Command(pkgbuild, append(args, out)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("pkgbuild failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Plugin events, sent in pipeline order
+const (
+	EventBeforeBuild   = "before_build"
+	EventAfterBuild    = "after_build"
+	EventBeforePublish = "before_publish"
+	EventPublish       = "publish"
+)
+
+// pluginPrefix is prepended to plugin names when looking them up on PATH
+const pluginPrefix = "greleaser-plugin-"
+
+// PluginRequest is written as JSON to a plugin's stdin
+type PluginRequest struct {
+	Event     string   `json:"event"`
+	Version   string   `json:"version"`
+	Owner     string   `json:"owner"`
+	Repo      string   `json:"repo"`
+	Artifacts []string `json:"artifacts"`
+	// Assets are the release's assets as in ARTIFACTS_MANIFEST, from
+	// before_publish on, with their download URLs in publish
+	Assets []Artifact `json:"assets,omitempty"`
+}
+
+// PluginResponse is read as JSON from a plugin's stdout
+type PluginResponse struct {
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Plugin is an external executable speaking the plugin protocol
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// FindPlugins resolves plugin names or paths from the config. A bare name
+// like "s3" is looked up on PATH as greleaser-plugin-s3. The
+// greleaser-plugin-* executables on PATH that aren't listed run after the
+// listed plugins.
+func FindPlugins(names []string) ([]Plugin, error) {
+	var plugins []Plugin
+	found := map[string]bool{}
+	for _, name := range names {
+		path := name
+		if !strings.ContainsRune(name, os.PathSeparator) {
+			path = pluginPrefix + strings.TrimPrefix(name, pluginPrefix)
+		}
+
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s not found: %w", name, err)
+		}
+		plugins = append(plugins, Plugin{Name: name, Path: resolved})
+		found[resolved] = true
+	}
+
+	for _, p := range pathPlugins() {
+		if !found[p.Path] {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins, nil
+}
+
+// pathPlugins returns the greleaser-plugin-* executables on PATH, in name
+// order, the first directory with a name winning as for commands
+func pathPlugins() []Plugin {
+	var plugins []Plugin
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			file := e.Name()
+			if !strings.HasPrefix(file, pluginPrefix) || e.IsDir() {
+				continue
+			}
+			name := strings.TrimPrefix(file, pluginPrefix)
+			if ext := filepath.Ext(name); runtime.GOOS == "windows" && strings.EqualFold(ext, ".exe") {
+				name = strings.TrimSuffix(name, ext)
+			}
+			if name == "" || seen[name] {
+				continue
+			}
+			path, err := exec.LookPath(filepath.Join(dir, file))
+			if err != nil {
+				// Not executable
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// Run sends a request to the plugin and waits for its response. Plugins
+// should answer events they don't handle with an empty JSON object.
+func (p Plugin) Run(req PluginRequest) error {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(p.Path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = ui.Output()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("plugin %s failed on %s: %w", p.Name, req.Event, err)
+	}
+
+	var resp PluginResponse
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return fmt.Errorf("plugin %s returned invalid response: %w", p.Name, err)
+		}
+	}
+
+	if resp.Message != "" {
+		ui.Printf("[%s] %s\n", p.Name, resp.Message)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("plugin %s failed on %s: %s", p.Name, req.Event, resp.Error)
+	}
+
+	return nil
+}
+
+// RunPlugins sends the request to every plugin in order, stopping at the first error
+func RunPlugins(plugins []Plugin, req PluginRequest) error {
+	for _, p := range plugins {
+		if err := p.Run(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// projectKey returns the key prefix of a project, e.g. PROJECT_WEB_UI_ for
+// web-ui
+func projectKey(name string) string {
+	return "PROJECT_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_"
+}
+
+// projectOf returns the project a PROJECT_<NAME>_* key belongs to, or ""
+func (c Config) projectOf(key string) string {
+	// The longest prefix wins, so api-v2's keys don't go to api
+	match := ""
+	for _, name := range c.Projects {
+		if strings.HasPrefix(key, projectKey(name)) && len(name) > len(match) {
+			match = name
+		}
+	}
+	return match
+}
+
+// ForProject returns the configuration of a project: the shared keys,
+// overridden by the project's PROJECT_<NAME>_* keys. Tags are prefixed with
+// the project's name unless it sets TAG_PREFIX.
+func (c Config) ForProject(name string) (Config, error) {
+	p := c
+	p.Project = name
+	p.TagPrefix = name + "/"
+	p.Builds = append([]Build(nil), c.Builds...)
+
+	entries := c.projectKeys[name]
+	prefix := projectKey(name)
+
+	schema := make(map[string]configField, len(configSchema))
+	for _, f := range configSchema {
+		schema[f.Key] = f
+	}
+
+	// BUILDS goes first, since it decides which build keys exist
+	for _, e := range entries {
+		if e.Key == prefix+"BUILDS" {
+			p.buildNames = splitList(e.Value)
+			p.Builds = nil
+			for _, name := range p.buildNames {
+				p.Builds = append(p.Builds, Build{Name: name})
+			}
+		}
+	}
+	for i, b := range p.Builds {
+		i := i
+		for _, f := range buildConfigFields(buildKey(b.Name), func(c *Config) *Build { return &c.Builds[i] }) {
+			schema[f.Key] = f
+		}
+	}
+
+	var problems []string
+	seen := map[string]string{}
+	for _, e := range entries {
+		key := strings.TrimPrefix(e.Key, prefix)
+		if prev, ok := seen[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s: %s already set at %s", e.Location, e.Key, prev))
+			continue
+		}
+		seen[key] = e.Location
+		if key == "BUILDS" || e.Value == "" {
+			continue
+		}
+
+		f, ok := schema[key]
+		if !ok || key == "PROJECTS" {
+			problems = append(problems, fmt.Sprintf("%s: unknown key %s", e.Location, e.Key))
+			continue
+		}
+		if err := setConfigValue(&p, f, e.Value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s: %v", e.Location, e.Key, err))
+		}
+	}
+	if len(problems) > 0 {
+		return p, fmt.Errorf("invalid configuration of project %s:\n  %s", name, strings.Join(problems, "\n  "))
+	}
+
+	if missing := p.missingFields(); len(missing) > 0 {
+		return p, fmt.Errorf("missing required configuration for project %s: %s", name, strings.Join(missing, ", "))
+	}
+	return p, nil
+}
+
+// SelectProjects returns the configurations of the projects to release:
+// the named one, or all of them in PROJECTS order
+func (c Config) SelectProjects(name string, all bool) ([]Config, error) {
+	if len(c.Projects) == 0 {
+		return nil, fmt.Errorf("no PROJECTS are configured")
+	}
+
+	var names []string
+	if all {
+		names = c.Projects
+	} else {
+		for _, p := range c.Projects {
+			if p == name {
+				names = []string{p}
+			}
+		}
+		if names == nil {
+			return nil, fmt.Errorf("unknown project %q (expected one of %s)", name, strings.Join(c.Projects, ", "))
+		}
+	}
+
+	var configs []Config
+	for _, name := range names {
+		p, err := c.ForProject(name)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, p)
+	}
+	return configs, nil
+}
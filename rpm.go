@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rpmArchs maps GOARCH values to RPM architectures
+var rpmArchs = map[string]string{
+	"386":      "i686",
+	"amd64":    "x86_64",
+	"arm":      "armv7hl",
+	"arm64":    "aarch64",
+	"loong64":  "loongarch64",
+	"mips64le": "mips64el",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// writeRPM builds a .rpm package in dir with rpmbuild, from a spec
+// installing the package's files as they are
+func writeRPM(dir string, p linuxPackage) (string, error) {
+	arch, ok := rpmArchs[p.Arch]
+	if !ok {
+		return "", fmt.Errorf("no RPM architecture for %s", p.Arch)
+	}
+	rpmbuild, err := exec.LookPath("rpmbuild")
+	if err != nil {
+		return "", fmt.Errorf("rpm packages need rpmbuild: %w", err)
+	}
+
+	top, err := os.MkdirTemp("", "greleaser-rpm-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(top)
+	spec, err := rpmSpec(p)
+	if err != nil {
+		return "", err
+	}
+	specPath := filepath.Join(top, p.Name+".spec")
+	if err := os.WriteFile(specPath, []byte(spec), 0644); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(rpmbuild, "-bb", "--quiet", "--target", arch,
+		"--define", "_topdir "+top,
+		"--define", "_rpmdir "+top,
+		specPath)
+	cmd.Env = append(os.Environ(), "SOURCE_DATE_EPOCH="+strconv.FormatInt(p.Date.Unix(), 10))
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("rpmbuild failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	name := fmt.Sprintf("%s-%s-1.%s.rpm", p.Name, packageVersion(p.Version), arch)
+	out := filepath.Join(dir, name)
+	data, err := os.ReadFile(filepath.Join(top, arch, name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// rpmSpec returns the spec file of a package. Binaries are released as Go
+// built them, so rpmbuild mustn't strip them or look for their
+// dependencies, and their dates come from SOURCE_DATE_EPOCH.
+func rpmSpec(p linuxPackage) (string, error) {
+	var spec strings.Builder
+	spec.WriteString("%global debug_package %{nil}\n")
+	spec.WriteString("%global __os_install_post %{nil}\n")
+	spec.WriteString("%global _build_id_links none\n")
+	spec.WriteString("%global use_source_date_epoch_as_buildtime 1\n")
+	spec.WriteString("%global clamp_mtime_to_source_date_epoch 1\n\n")
+
+	fmt.Fprintf(&spec, "Name: %s\n", p.Name)
+	fmt.Fprintf(&spec, "Version: %s\n", packageVersion(p.Version))
+	spec.WriteString("Release: 1\n")
+	fmt.Fprintf(&spec, "Summary: %s\n", p.Description)
+	license := p.License
+	if license == "" {
+		license = "Unspecified"
+	}
+	fmt.Fprintf(&spec, "License: %s\n", license)
+	fmt.Fprintf(&spec, "Packager: %s\n", p.Maintainer)
+	if p.Homepage != "" {
+		fmt.Fprintf(&spec, "URL: %s\n", p.Homepage)
+	}
+	for _, dep := range p.Depends {
+		fmt.Fprintf(&spec, "Requires: %s\n", dep)
+	}
+	spec.WriteString("AutoReqProv: no\n\n")
+	fmt.Fprintf(&spec, "%%description\n%s\n\n", p.Description)
+
+	spec.WriteString("%install\n")
+	for _, f := range p.Files {
+		src, err := filepath.Abs(f.Src)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&spec, "install -D -m %04o %s %%{buildroot}%s\n", f.Mode, strconv.Quote(src), f.Dst)
+	}
+
+	spec.WriteString("\n%files\n")
+	for _, f := range p.Files {
+		if f.Config {
+			spec.WriteString("%config(noreplace) ")
+		}
+		fmt.Fprintf(&spec, "%%attr(%04o,root,root) %s\n", f.Mode, f.Dst)
+	}
+
+	// $1 is 0 when the package is removed rather than upgraded
+	postinst, prerm, postrm := p.systemdScripts(`[ "$1" -eq 0 ]`)
+	for _, script := range []struct{ section, body string }{
+		{"%post", postinst},
+		{"%preun", prerm},
+		{"%postun", postrm},
+	} {
+		if script.body != "" {
+			fmt.Fprintf(&spec, "\n%s\n%s", script.section, script.body)
+		}
+	}
+	return spec.String(), nil
+}
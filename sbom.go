@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// SBOM formats
+const (
+	SBOMSPDX      = "spdx"
+	SBOMCycloneDX = "cyclonedx"
+)
+
+// sbomFormats lists the supported SBOM values
+var sbomFormats = []string{SBOMSPDX, SBOMCycloneDX}
+
+// sbomSuffixes are appended to an artifact's path for its SBOM in each
+// format
+var sbomSuffixes = map[string]string{
+	SBOMSPDX:      ".spdx.json",
+	SBOMCycloneDX: ".cdx.json",
+}
+
+// syftOutputs are the syft output formats of the SBOM formats
+var syftOutputs = map[string]string{
+	SBOMSPDX:      "spdx-json",
+	SBOMCycloneDX: "cyclonedx-json",
+}
+
+// ValidateSBOM checks the SBOM formats
+func ValidateSBOM(formats []string) error {
+	for _, format := range formats {
+		if _, ok := sbomSuffixes[format]; !ok {
+			return fmt.Errorf("unknown SBOM format %q (expected %s)", format, strings.Join(sbomFormats, ", "))
+		}
+	}
+	return nil
+}
+
+// isSBOM reports whether path is an SBOM
+func isSBOM(path string) bool {
+	for _, suffix := range sbomSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sbomModule is a Go module compiled into a binary
+type sbomModule struct {
+	Path    string
+	Version string
+}
+
+// purl returns the module's package URL
+func (m sbomModule) purl() string {
+	if m.Version == "" {
+		return "pkg:golang/" + m.Path
+	}
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+// sbomSubject is an artifact an SBOM describes, with the modules of the Go
+// binary in it: the main module first, then the standard library and the
+// dependencies
+type sbomSubject struct {
+	Name    string
+	SHA256  string
+	Modules []sbomModule
+	Date    time.Time
+}
+
+// goModules reads the modules compiled into a Go binary. The main module
+// has no version of its own in most builds, so it gets the release's. A
+// replaced module is listed as its replacement, unless that's a local
+// directory, which has no version (or "(devel)"). Modules replaced by the same one are
+// listed once, as their package URLs identify the SBOMs' entries.
+func goModules(binary, version string) ([]sbomModule, error) {
+	info, err := buildinfo.ReadFile(binary)
+	if err != nil {
+		// debug/buildinfo doesn't know every format, WebAssembly among them
+		if info, err = scanBuildInfo(binary); err != nil {
+			return nil, fmt.Errorf("failed to read the modules of %s: %w", binary, err)
+		}
+	}
+	modules := []sbomModule{{Path: info.Main.Path, Version: "v" + strings.TrimPrefix(version, "v")}}
+	if info.GoVersion != "" {
+		modules = append(modules, sbomModule{Path: "stdlib", Version: info.GoVersion})
+	}
+	listed := map[sbomModule]bool{modules[0]: true}
+	for _, dep := range info.Deps {
+		if r := dep.Replace; r != nil && r.Version != "" && r.Version != "(devel)" {
+			dep = dep.Replace
+		}
+		m := sbomModule{Path: dep.Path, Version: dep.Version}
+		if !listed[m] {
+			listed[m] = true
+			modules = append(modules, m)
+		}
+	}
+	return modules, nil
+}
+
+// modInfoStart and modInfoEnd wrap the module info the Go linker writes
+// into binaries
+var (
+	modInfoStart = []byte("\x30\x77\xaf\x0c\x92\x74\x08\x02\x41\xe1\xc1\x07\xe6\xd6\x18\xe6")
+	modInfoEnd   = []byte("\xf9\x32\x43\x31\x86\x18\x20\x72\x00\x82\x42\x10\x41\x16\xd8\xf2")
+)
+
+// scanBuildInfo finds the module info in a binary of a format
+// debug/buildinfo can't parse. It lacks the Go version, which is left
+// empty.
+func scanBuildInfo(path string) (*debug.BuildInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(data, modInfoStart)
+	if start < 0 {
+		return nil, fmt.Errorf("no Go module info found")
+	}
+	data = data[start+len(modInfoStart):]
+	end := bytes.Index(data, modInfoEnd)
+	if end < 0 {
+		return nil, fmt.Errorf("no Go module info found")
+	}
+	return debug.ParseBuildInfo(string(data[:end]))
+}
+
+// sbomID returns an identifier of an SBOM derived from its subject's
+// checksum, shaped as a UUID, so that the same artifact always gets the
+// same SBOM
+func (s sbomSubject) sbomID() string {
+	sum := s.SHA256 + strings.Repeat("0", 32)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", sum[0:8], sum[8:12], sum[12:16], sum[16:20], sum[20:32])
+}
+
+// spdxDocument returns the SPDX 2.3 document of an artifact
+func (s sbomSubject) spdxDocument() interface{} {
+	type ref struct {
+		Category string `json:"referenceCategory"`
+		Type     string `json:"referenceType"`
+		Locator  string `json:"referenceLocator"`
+	}
+	type checksum struct {
+		Algorithm string `json:"algorithm"`
+		Value     string `json:"checksumValue"`
+	}
+	type pkg struct {
+		Name             string     `json:"name"`
+		SPDXID           string     `json:"SPDXID"`
+		VersionInfo      string     `json:"versionInfo,omitempty"`
+		DownloadLocation string     `json:"downloadLocation"`
+		FilesAnalyzed    bool       `json:"filesAnalyzed"`
+		Checksums        []checksum `json:"checksums,omitempty"`
+		ExternalRefs     []ref      `json:"externalRefs,omitempty"`
+	}
+	type relationship struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	}
+
+	packages := []pkg{{
+		Name:             s.Name,
+		SPDXID:           "SPDXRef-Artifact",
+		DownloadLocation: "NOASSERTION",
+		Checksums:        []checksum{{"SHA256", s.SHA256}},
+	}}
+	relationships := []relationship{{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Artifact"}}
+	for i, m := range s.Modules {
+		id := fmt.Sprintf("SPDXRef-Module-%d", i)
+		packages = append(packages, pkg{
+			Name:             m.Path,
+			SPDXID:           id,
+			VersionInfo:      m.Version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs:     []ref{{"PACKAGE-MANAGER", "purl", m.purl()}},
+		})
+		switch i {
+		case 0:
+			relationships = append(relationships, relationship{"SPDXRef-Artifact", "CONTAINS", id})
+		default:
+			relationships = append(relationships, relationship{"SPDXRef-Module-0", "DEPENDS_ON", id})
+		}
+	}
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              s.Name,
+		"documentNamespace": fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", s.Name, s.sbomID()),
+		"creationInfo": map[string]interface{}{
+			"created":  s.Date.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: greleaser"},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+// cycloneDXDocument returns the CycloneDX 1.5 document of an artifact
+func (s sbomSubject) cycloneDXDocument() interface{} {
+	type hash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+	type component struct {
+		Type    string `json:"type"`
+		BOMRef  string `json:"bom-ref"`
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+		PURL    string `json:"purl,omitempty"`
+		Hashes  []hash `json:"hashes,omitempty"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+
+	var components []component
+	var deps []string
+	for i, m := range s.Modules {
+		c := component{Type: "library", BOMRef: m.purl(), Name: m.Path, Version: m.Version, PURL: m.purl()}
+		if i == 0 {
+			c.Type = "application"
+		} else {
+			deps = append(deps, m.purl())
+		}
+		components = append(components, c)
+	}
+	dependencies := []dependency{{Ref: s.Name, DependsOn: []string{}}}
+	if len(s.Modules) > 0 {
+		dependencies[0].DependsOn = []string{s.Modules[0].purl()}
+		dependencies = append(dependencies, dependency{Ref: s.Modules[0].purl(), DependsOn: deps})
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + s.sbomID(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": s.Date.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []component{{Type: "application", BOMRef: "greleaser", Name: "greleaser"}},
+			},
+			"component": component{Type: "file", BOMRef: s.Name, Name: s.Name, Hashes: []hash{{"SHA-256", s.SHA256}}},
+		},
+		"components":   components,
+		"dependencies": dependencies,
+	}
+}
+
+// WriteGoSBOMs writes the SBOMs of the artifacts of a Go target, next to
+// them, from the modules compiled into its binary
+func (g *GitHubReleaser) WriteGoSBOMs(binary, version string, artifacts []string, log buildLog) ([]string, error) {
+	if len(g.config.SBOM) == 0 {
+		return nil, nil
+	}
+	modules, err := goModules(binary, version)
+	if err != nil {
+		return nil, err
+	}
+	date := g.sourceDate
+	if date.IsZero() {
+		date = time.Now().UTC().Truncate(time.Second)
+	}
+
+	var sboms []string
+	for _, artifact := range artifacts {
+		sum, _, err := fileSHA256(artifact)
+		if err != nil {
+			return nil, err
+		}
+		subject := sbomSubject{Name: filepath.Base(artifact), SHA256: sum, Modules: modules, Date: date}
+		for _, format := range g.config.SBOM {
+			document := subject.spdxDocument()
+			if format == SBOMCycloneDX {
+				document = subject.cycloneDXDocument()
+			}
+			data, err := json.MarshalIndent(document, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			out := artifact + sbomSuffixes[format]
+			if err := os.WriteFile(out, append(data, '\n'), 0644); err != nil {
+				return nil, fmt.Errorf("failed to write %s: %w", out, err)
+			}
+			sboms = append(sboms, out)
+		}
+	}
+	log.Step("Wrote %d SBOMs of %s", len(sboms), filepath.Base(binary))
+	return sboms, nil
+}
+
+// WriteSyftSBOMs writes the SBOMs of the artifacts of a build command or
+// prebuilt artifacts, next to them, with syft scanning source, which is
+// the artifact itself if empty
+func (g *GitHubReleaser) WriteSyftSBOMs(source string, artifacts []string, log buildLog) ([]string, error) {
+	if len(g.config.SBOM) == 0 {
+		return nil, nil
+	}
+	syft, err := exec.LookPath("syft")
+	if err != nil {
+		return nil, fmt.Errorf("SBOMs of builds other than Go targets need syft: %w", err)
+	}
+
+	var sboms []string
+	for _, artifact := range artifacts {
+		scanned := source
+		if scanned == "" {
+			scanned = artifact
+		}
+		args := []string{"scan", scanned, "--quiet", "--source-name", filepath.Base(artifact)}
+		for _, format := range g.config.SBOM {
+			out := artifact + sbomSuffixes[format]
+			args = append(args, "--output", syftOutputs[format]+"="+out)
+			sboms = append(sboms, out)
+		}
+		log.Step("Scanning %s with syft", scanned)
+		cmd := exec.Command(syft, args...)
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("syft failed: %w: %s", err, strings.TrimSpace(output.String()))
+		}
+	}
+	return sboms, nil
+}
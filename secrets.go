@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LoadSecretsFile reads a file of KEY=VALUE secrets, in the format of
+// .release.env. An empty path loads nothing.
+func LoadSecretsFile(path string) (map[string]string, error) {
+	secrets := map[string]string{}
+	if path == "" {
+		return secrets, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SECRETS_FILE: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			// The line itself may be a secret, so it isn't quoted
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		secrets[strings.TrimSpace(key)] = unquote(strings.TrimSpace(value))
+	}
+	return secrets, nil
+}
+
+// secretEnv returns the KEY=VALUE variables of a build's SECRETS, from
+// SECRETS_FILE or else the environment
+func (g *GitHubReleaser) secretEnv(b Build) ([]string, error) {
+	var env []string
+	for _, name := range b.Secrets {
+		value, ok := g.secrets[name]
+		if !ok {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("secret %s of %s is not in SECRETS_FILE or the environment", name, b.Key("SECRETS"))
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// secretMask returns a replacer masking the values of the builds' secrets
+// in their output, or nil if they have none
+func (g *GitHubReleaser) secretMask(builds []Build) (*strings.Replacer, error) {
+	var values []string
+	for _, b := range builds {
+		env, err := g.secretEnv(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range env {
+			if _, value, _ := strings.Cut(entry, "="); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	// The replacer tries values in order, so a secret that's part of a
+	// longer one mustn't leave the rest of it showing
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var pairs []string
+	for _, value := range values {
+		pairs = append(pairs, value, "***")
+	}
+	return strings.NewReplacer(pairs...), nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// selfUpdateRepo is the GitHub repository greleaser itself is released from
+const selfUpdateRepo = "luberius/greleaser"
+
+// appVersion is the version of this binary, set at build time via
+// -ldflags "-X main.appVersion=v1.2.3"
+var appVersion = "dev"
+
+// describeSuffix is what git describe appends to the tag of a build made
+// after it: the number of commits since and the abbreviated commit
+var describeSuffix = regexp.MustCompile(`-\d+-g[0-9a-f]+(-dirty)?$`)
+
+// isNewerRelease reports whether the latest release is newer than the
+// running version, so that updating never downgrades. A git describe
+// version counts as its tag, which the binary is newer than. Versions that
+// aren't semantic, such as development builds, are refused unless forced,
+// which updates whatever the versions.
+func isNewerRelease(current, latest string, force bool) (bool, error) {
+	if force {
+		return true, nil
+	}
+	next, err := ParseVersion(latest)
+	if err != nil {
+		return false, fmt.Errorf("latest release %s: %w", latest, err)
+	}
+	running, err := ParseVersion(describeSuffix.ReplaceAllString(current, ""))
+	if err != nil {
+		return false, fmt.Errorf("greleaser %s is a development build, pass --force to replace it with %s", current, latest)
+	}
+	return next.Compare(running) > 0, nil
+}
+
+// SelfUpdate replaces the running executable with the latest released
+// binary, if it's newer, or in any case when forced
+func SelfUpdate(force bool) error {
+	ui.Printf("Checking for updates...\n")
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", selfUpdateRepo), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	// A token is optional but avoids the anonymous rate limit
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("token %s", token))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to fetch latest release: %s", body)
+	}
+
+	var release struct {
+		TagName string        `json:"tag_name"`
+		Assets  []githubAsset `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return err
+	}
+
+	newer, err := isNewerRelease(appVersion, release.TagName, force)
+	if err != nil {
+		return err
+	}
+	if !newer {
+		ui.Printf("Already up to date (%s, latest release %s)\n", appVersion, release.TagName)
+		return nil
+	}
+
+	// Asset names follow build.sh: greleaser-<os>-<arch>[.exe]
+	assetName := fmt.Sprintf("greleaser-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		assetName += ".exe"
+	}
+
+	var binary, checksums *githubAsset
+	for i := range release.Assets {
+		switch release.Assets[i].Name {
+		case assetName:
+			binary = &release.Assets[i]
+		case "SHA256SUMS":
+			checksums = &release.Assets[i]
+		}
+	}
+	if binary == nil {
+		return fmt.Errorf("release %s has no binary for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	if checksums == nil {
+		return fmt.Errorf("release %s has no SHA256SUMS file, refusing to update", release.TagName)
+	}
+
+	expected, err := fetchChecksum(checksums.BrowserDownloadURL, assetName)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	// Download next to the executable so the final rename stays on one filesystem
+	ui.Printf("Downloading %s %s...\n", assetName, release.TagName)
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".greleaser-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	resp, err = http.Get(binary.BrowserDownloadURL)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %s", assetName, resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", assetName, expected, actual)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	// Windows can't overwrite a running executable, but it can rename it
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return err
+	}
+
+	ui.Printf("Updated greleaser %s -> %s\n", appVersion, release.TagName)
+	return nil
+}
+
+// fetchChecksum downloads a sha256sum-style file and returns the hash for name
+func fetchChecksum(url, name string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download checksums: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("no checksum for %s", name)
+}
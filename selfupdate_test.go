@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestIsNewerRelease(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		force           bool
+		want            bool
+		err             bool
+	}{
+		{"v1.2.0", "v1.3.0", false, true, false},
+		{"v1.2.0", "v1.2.0", false, false, false},
+		{"v1.3.0", "v1.2.0", false, false, false},
+		{"1.2.0", "v1.2.1", false, true, false},
+		{"v1.3.0-rc.1", "v1.3.0", false, true, false},
+		{"v1.3.0-rc.1", "v1.2.9", false, false, false},
+		// git describe builds are newer than their tag
+		{"v1.2.0-3-gabc1234", "v1.2.0", false, false, false},
+		{"v1.2.0-3-gabc1234", "v1.2.1", false, true, false},
+		{"v1.3.0-rc.1-2-g0123abc", "v1.3.0", false, true, false},
+		// Development builds only update when forced
+		{"dev", "v1.2.0", false, false, true},
+		{"abc1234", "v1.2.0", false, false, true},
+		{"dev", "v1.2.0", true, true, false},
+		{"v1.3.0", "v1.2.0", true, true, false},
+		{"v1.2.0", "latest", false, false, true},
+	}
+	for _, tt := range tests {
+		got, err := isNewerRelease(tt.current, tt.latest, tt.force)
+		if (err != nil) != tt.err {
+			t.Errorf("isNewerRelease(%q, %q, %t) error = %v, want error %t", tt.current, tt.latest, tt.force, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("isNewerRelease(%q, %q, %t) = %t, want %t", tt.current, tt.latest, tt.force, got, tt.want)
+		}
+	}
+}
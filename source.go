@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sourceArchiveDir is where the source archive is written
+const sourceArchiveDir = "dist"
+
+// sourceArchiveName returns the name of the source archive of a release,
+// <project>-<version>.tar.gz, a component's name taking the project's
+func (g *GitHubReleaser) sourceArchiveName(info BuildInfo) string {
+	project := g.repoName
+	if name := g.config.Component().Name(); name != "" {
+		project = name
+	}
+	return fmt.Sprintf("%s-%s.tar.gz", project, info.Version)
+}
+
+// WriteSourceArchive writes the source archive of the released commit with
+// git archive, which leaves out the paths with the export-ignore attribute.
+// Its files are in a <project>-<version> directory and dated by the commit,
+// so the same commit always gives the same archive, unlike the ones GitHub
+// generates. A component's archive only holds its directory.
+func (g *GitHubReleaser) WriteSourceArchive(info BuildInfo) (string, error) {
+	name := g.sourceArchiveName(info)
+	if err := os.MkdirAll(sourceArchiveDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(sourceArchiveDir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	args := []string{"archive", "--format=tar", "--prefix=" + strings.TrimSuffix(name, ".tar.gz") + "/", info.Commit}
+	if dir := g.config.Component().Path; dir != "" {
+		args = append(args, "--", dir)
+	}
+	// Compressing here rather than with git keeps the archive the same
+	// whichever gzip git would use
+	gz, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = gz
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git archive failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return path, out.Close()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes of SPLIT_SIZE, in powers of 1024
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+}
+
+// ParseSize parses a size such as 1500M or 1.5GiB into bytes. Units are
+// powers of 1024, and a plain number is bytes.
+func ParseSize(value string) (int64, error) {
+	number, unit := strings.TrimSpace(value), int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(number, u.suffix) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (expected a number of bytes, or K, M or G)", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// ValidateSplitSize checks SPLIT_SIZE, which must leave parts under
+// GitHub's limit
+func ValidateSplitSize(value string) error {
+	if value == "" {
+		return nil
+	}
+	size, err := ParseSize(value)
+	if err != nil {
+		return fmt.Errorf("SPLIT_SIZE: %w", err)
+	}
+	if size >= maxAssetSize {
+		return fmt.Errorf("SPLIT_SIZE must be under 2 GiB, GitHub's limit for each part")
+	}
+	return nil
+}
+
+// SplitArtifacts replaces the artifacts larger than SPLIT_SIZE with their
+// parts, <name>.part1, <name>.part2 and so on, written next to them, and a
+// <name>.join.sh script putting them back together. Without SPLIT_SIZE it
+// returns the artifacts as they are.
+func SplitArtifacts(value string, artifacts []Artifact) ([]Artifact, error) {
+	if value == "" {
+		return artifacts, nil
+	}
+	size, err := ParseSize(value)
+	if err != nil {
+		return nil, fmt.Errorf("SPLIT_SIZE: %w", err)
+	}
+
+	var split []Artifact
+	for _, a := range artifacts {
+		path := filepath.FromSlash(a.Path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() <= size {
+			split = append(split, a)
+			continue
+		}
+		ui.Step("Splitting %s", a.Name)
+		parts, err := splitFile(path, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split %s: %w", a.Path, err)
+		}
+		for _, part := range parts {
+			p := a
+			p.Name, p.Path = filepath.Base(part), filepath.ToSlash(part)
+			split = append(split, p)
+		}
+		script, err := writeJoinScript(path, parts)
+		if err != nil {
+			return nil, err
+		}
+		j := newArtifact(script, ArtifactJoinScript)
+		j.Platform, j.Build = a.Platform, a.Build
+		split = append(split, j)
+	}
+	return split, nil
+}
+
+// splitFile writes the parts of a file, of size bytes but the last, next to
+// it and returns their paths
+func splitFile(path string, size int64) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var parts []string
+	for n := 1; ; n++ {
+		part := fmt.Sprintf("%s.part%d", path, n)
+		out, err := os.Create(part)
+		if err != nil {
+			return nil, err
+		}
+		written, err := io.CopyN(out, f, size)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err == io.EOF {
+			if written == 0 {
+				return parts, os.Remove(part)
+			}
+			return append(parts, part), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+}
+
+// writeJoinScript writes <file>.join.sh, which joins the parts downloaded
+// next to it into the original file and checks its SHA-256 checksum
+func writeJoinScript(path string, parts []string) (string, error) {
+	sum, _, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	names := make([]string, len(parts))
+	for i, part := range parts {
+		names[i] = strconv.Quote(filepath.Base(part))
+	}
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&script, "# Joins the parts of %s downloaded next to this script\n", name)
+	script.WriteString("set -e\ncd \"$(dirname \"$0\")\"\n")
+	fmt.Fprintf(&script, "cat %s > %q\n", strings.Join(names, " "), name)
+	script.WriteString("if command -v sha256sum >/dev/null 2>&1; then\n")
+	fmt.Fprintf(&script, "\techo \"%s  %s\" | sha256sum -c -\n", sum, name)
+	script.WriteString("else\n")
+	fmt.Fprintf(&script, "\techo \"%s  %s\" | shasum -a 256 -c -\n", sum, name)
+	script.WriteString("fi\n")
+
+	out := path + ".join.sh"
+	if err := os.WriteFile(out, []byte(script.String()), 0755); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1000", 1000},
+		{"1K", 1 << 10},
+		{"1KiB", 1 << 10},
+		{"1500M", 1500 << 20},
+		{"1.5G", 3 << 29},
+		{"1.5GiB", 3 << 29},
+		{" 2 MiB ", 2 << 20},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "0", "-1M", "M", "1T", "100KB", "1.5.0G"} {
+		if got, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestSplitFile(t *testing.T) {
+	tests := []struct {
+		size, part int64
+		want       []int64
+	}{
+		{10, 4, []int64{4, 4, 2}},
+		{12, 4, []int64{4, 4, 4}},
+		{3, 4, []int64{3}},
+		{4, 4, []int64{4}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.tar.gz")
+		data := bytes.Repeat([]byte("0123456789"), 2)[:tt.size]
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		parts, err := splitFile(path, tt.part)
+		if err != nil {
+			t.Errorf("splitFile of %d bytes in %d failed: %v", tt.size, tt.part, err)
+			continue
+		}
+		if len(parts) != len(tt.want) {
+			t.Errorf("splitFile of %d bytes in %d wrote %d parts, want %d", tt.size, tt.part, len(parts), len(tt.want))
+			continue
+		}
+		var joined []byte
+		for i, part := range parts {
+			if want := fmt.Sprintf("%s.part%d", path, i+1); part != want {
+				t.Errorf("part %d is %s, want %s", i+1, part, want)
+			}
+			content, err := os.ReadFile(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(content)) != tt.want[i] {
+				t.Errorf("splitFile of %d bytes in %d: part %d has %d bytes, want %d", tt.size, tt.part, i+1, len(content), tt.want[i])
+			}
+			joined = append(joined, content...)
+		}
+		if !bytes.Equal(joined, data) {
+			t.Errorf("splitFile of %d bytes in %d: parts join to %q, want %q", tt.size, tt.part, joined, data)
+		}
+		// No empty part is left behind when the size divides the file
+		if _, err := os.Stat(fmt.Sprintf("%s.part%d", path, len(parts)+1)); !os.IsNotExist(err) {
+			t.Errorf("splitFile of %d bytes in %d left an extra part", tt.size, tt.part)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultSummaryAPIURL is used when SUMMARY_API_URL isn't set
+const defaultSummaryAPIURL = "https://api.openai.com/v1"
+
+// defaultSummaryPrompt is used when SUMMARY_PROMPT isn't set
+const defaultSummaryPrompt = "You write release notes for end users. Summarize the following changelog " +
+	"in one short paragraph of plain language. Focus on what users will notice, mention breaking " +
+	"changes first, and don't list commits or invent anything that isn't in the changelog."
+
+// Summarizer writes a summary of release notes through an OpenAI-compatible
+// chat completions API
+type Summarizer struct {
+	// URL is the API base URL, e.g. https://api.openai.com/v1
+	URL    string
+	Model  string
+	APIKey string
+	Prompt string
+}
+
+// Summarize returns a summary paragraph for the changelog
+func (s Summarizer) Summarize(changelog string) (string, error) {
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = defaultSummaryPrompt
+	}
+
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model": s.Model,
+		"messages": []message{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: changelog},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	url := s.URL
+	if url == "" {
+		url = defaultSummaryAPIURL
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(url, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("summary request failed: %s: %s", resp.Status, data)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("summary response has no choices")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
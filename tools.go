@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildTool is a toolchain with a conventional build command and output
+// directory, selected with BUILD_TOOL
+type buildTool struct {
+	// Command returns the build command of a build, given its absolute
+	// output path
+	Command func(b Build, output string) []string
+	// Output is the default output directory, relative to the build's
+	// directory, or "" if BUILD_PATH is required
+	Output string
+	// Keep picks what of the output directory is archived, by path
+	// relative to it; nil archives everything
+	Keep func(rel string, info os.FileInfo) bool
+}
+
+// buildTools lists the supported BUILD_TOOL values
+var buildTools = map[string]buildTool{
+	"make": {
+		Command: func(b Build, output string) []string {
+			return append([]string{"make"}, b.ToolArgs...)
+		},
+	},
+	"cargo": {
+		Command: func(b Build, output string) []string {
+			return append([]string{"cargo", "build", "--release"}, b.ToolArgs...)
+		},
+		Output: filepath.Join("target", "release"),
+		// The binaries and libraries, not the intermediate build files
+		Keep: func(rel string, info os.FileInfo) bool {
+			if info.IsDir() || strings.ContainsRune(rel, filepath.Separator) {
+				return false
+			}
+			switch filepath.Ext(rel) {
+			case ".exe", ".dll", ".so", ".dylib", ".a", ".lib", ".rlib", ".wasm":
+				return true
+			case ".d", ".pdb":
+				return false
+			}
+			return info.Mode()&0111 != 0
+		},
+	},
+	"gradle": {
+		Command: func(b Build, output string) []string {
+			// Projects pin their Gradle version with the wrapper
+			command := "gradle"
+			if _, err := os.Stat(filepath.Join(b.Dir, "gradlew")); err == nil {
+				command = "./gradlew"
+			}
+			return append([]string{command, "assemble"}, b.ToolArgs...)
+		},
+		Output: filepath.Join("build", "libs"),
+	},
+	"dotnet": {
+		Command: func(b Build, output string) []string {
+			return append([]string{"dotnet", "publish", "-c", "Release", "-o", output}, b.ToolArgs...)
+		},
+		Output: "publish",
+	},
+}
+
+// OutputPath returns the directory a build's output is archived from:
+// BUILD_PATH, or its tool's conventional output directory
+func (b Build) OutputPath() string {
+	if b.Path != "" || b.Tool == "" {
+		return b.Path
+	}
+	if tool := buildTools[b.Tool]; tool.Output != "" {
+		return filepath.Join(b.Dir, tool.Output)
+	}
+	return ""
+}
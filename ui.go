@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ui reports pipeline progress. It prints plain log lines unless the
+// interactive view is enabled with EnableTUI.
+var ui = &UI{}
+
+// paneLines is how many lines of live command output the TUI keeps visible
+const paneLines = 8
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// UI renders steps as spinners with a live output pane and progress bars
+// when attached to a terminal, and as plain log lines otherwise
+type UI struct {
+	mu       sync.Mutex
+	tty      bool
+	width    int
+	step     string
+	started  time.Time
+	frame    int
+	pane     []string
+	partial  string
+	progress []*progressReader
+	drawn    int
+	stop     chan struct{}
+	stopped  chan struct{}
+	// log receives plain log lines, stdout if nil
+	log io.Writer
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// EnableTUI switches to the interactive view
+func (u *UI) EnableTUI() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.tty = true
+	u.width = 80
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 20 {
+		u.width = cols
+	}
+}
+
+// SetLog sends plain log lines to w, e.g. to keep stdout for a command's
+// own output
+func (u *UI) SetLog(w io.Writer) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.log = w
+}
+
+// logOutput returns where plain log lines go
+func (u *UI) logOutput() io.Writer {
+	if u.log == nil {
+		return os.Stdout
+	}
+	return u.log
+}
+
+// Step finishes the current step, if any, and starts a new one
+func (u *UI) Step(format string, args ...interface{}) {
+	title := fmt.Sprintf(format, args...)
+	if !u.tty {
+		fmt.Fprintf(u.logOutput(), "%s...\n", title)
+		return
+	}
+
+	u.Done(nil)
+
+	u.mu.Lock()
+	u.step = title
+	u.started = time.Now()
+	u.pane = nil
+	u.partial = ""
+	u.progress = nil
+	u.stop = make(chan struct{})
+	u.stopped = make(chan struct{})
+	u.mu.Unlock()
+
+	go u.spin(u.stop, u.stopped)
+}
+
+// Done finishes the current step, marking it failed if err is non-nil
+func (u *UI) Done(err error) {
+	if !u.tty {
+		return
+	}
+
+	u.mu.Lock()
+	if u.step == "" {
+		u.mu.Unlock()
+		return
+	}
+	stop, stopped := u.stop, u.stopped
+	u.mu.Unlock()
+
+	close(stop)
+	<-stopped
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.clear()
+	mark := "\033[32m✓\033[0m"
+	if err != nil {
+		mark = "\033[31m✗\033[0m"
+		// Keep the output that led to the failure on screen
+		for _, line := range u.pane {
+			fmt.Println(line)
+		}
+	}
+	fmt.Printf("%s %s (%s)\n", mark, u.step, time.Since(u.started).Round(100*time.Millisecond))
+	u.step = ""
+}
+
+// Printf prints a log line without disturbing the current step
+func (u *UI) Printf(format string, args ...interface{}) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.clear()
+	fmt.Fprintf(u.logOutput(), format, args...)
+	if u.step != "" {
+		u.draw()
+	}
+}
+
+// Output returns a writer for command output. In the TUI it feeds the live
+// output pane below the current step.
+func (u *UI) Output() io.Writer {
+	if !u.tty {
+		return u.logOutput()
+	}
+	return paneWriter{u}
+}
+
+// TrackReader wraps r so reading it drives a progress bar for the current
+// step, labelled with label if there are several. total is the expected
+// number of bytes.
+func (u *UI) TrackReader(label string, r io.Reader, total int64) io.Reader {
+	if !u.tty || total <= 0 {
+		return r
+	}
+	p := &progressReader{ui: u, r: r, label: label, total: total}
+	u.mu.Lock()
+	u.progress = append(u.progress, p)
+	u.mu.Unlock()
+	return p
+}
+
+// Untrack removes the progress bar of a reader TrackReader returned, such
+// as one that failed before it was read to the end
+func (u *UI) Untrack(r io.Reader) {
+	if p, ok := r.(*progressReader); ok {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.untrack(p)
+	}
+}
+
+// untrack removes a progress bar. Callers hold u.mu.
+func (u *UI) untrack(p *progressReader) {
+	for i, other := range u.progress {
+		if other == p {
+			u.progress = append(u.progress[:i], u.progress[i+1:]...)
+			return
+		}
+	}
+}
+
+// spin redraws the current step until stop is closed
+func (u *UI) spin(stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		u.mu.Lock()
+		u.clear()
+		u.draw()
+		u.frame++
+		u.mu.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw renders the step, output pane and progress bar. Callers hold u.mu.
+func (u *UI) draw() {
+	lines := []string{fmt.Sprintf("\033[36m%s\033[0m %s (%s)",
+		spinnerFrames[u.frame%len(spinnerFrames)], u.step, time.Since(u.started).Round(time.Second))}
+	for _, line := range u.pane {
+		lines = append(lines, "\033[2m  "+u.truncate(line)+"\033[0m")
+	}
+	for _, p := range u.progress {
+		lines = append(lines, "  "+p.bar(len(u.progress) > 1))
+	}
+
+	for _, line := range lines {
+		fmt.Print(line, "\n")
+	}
+	u.drawn = len(lines)
+}
+
+// clear erases what draw last rendered. Callers hold u.mu.
+func (u *UI) clear() {
+	if u.drawn > 0 {
+		fmt.Printf("\033[%dA\033[J", u.drawn)
+		u.drawn = 0
+	}
+}
+
+// truncate shortens a pane line to fit the terminal width
+func (u *UI) truncate(line string) string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	limit := u.width - 4
+	if runes := []rune(line); len(runes) > limit {
+		return string(runes[:limit-1]) + "…"
+	}
+	return line
+}
+
+// paneWriter splits command output into lines for the output pane
+type paneWriter struct {
+	ui *UI
+}
+
+func (w paneWriter) Write(p []byte) (int, error) {
+	u := w.ui
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	text := u.partial + strings.ReplaceAll(string(p), "\r", "\n")
+	lines := strings.Split(text, "\n")
+	u.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		u.pane = append(u.pane, line)
+	}
+	if len(u.pane) > paneLines {
+		u.pane = u.pane[len(u.pane)-paneLines:]
+	}
+	return len(p), nil
+}
+
+// progressReader updates the progress bar as bytes are read
+type progressReader struct {
+	ui    *UI
+	r     io.Reader
+	label string
+	total int64
+	read  int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+
+	p.ui.mu.Lock()
+	defer p.ui.mu.Unlock()
+	p.read += int64(n)
+	// Finished bars make room for the others
+	if p.read >= p.total || err != nil {
+		p.ui.untrack(p)
+	}
+	return n, err
+}
+
+// bar renders the progress bar, after the label if labelled is set. Callers
+// hold u.mu.
+func (p *progressReader) bar(labelled bool) string {
+	const barWidth = 30
+	filled := int(float64(barWidth) * float64(p.read) / float64(p.total))
+	if filled > barWidth {
+		filled = barWidth
+	}
+	bar := fmt.Sprintf("[%s%s] %s / %s",
+		strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled),
+		formatBytes(p.read), formatBytes(p.total))
+	if labelled && p.label != "" {
+		bar = p.ui.truncate(p.label + " " + bar)
+	}
+	return bar
+}
+
+// formatBytes renders a byte count in human-readable units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// The macOS targets a universal binary combines, and the pseudo-target it's
+// named after
+var (
+	darwinAMD64     = GoTarget{OS: "darwin", Arch: "amd64"}
+	darwinARM64     = GoTarget{OS: "darwin", Arch: "arm64"}
+	darwinUniversal = GoTarget{OS: "darwin", Arch: "universal"}
+)
+
+// lipo returns the lipo tool: Xcode's, or LLVM's port of it elsewhere
+func lipo() (string, error) {
+	for _, name := range []string{"lipo", "llvm-lipo"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("a universal macOS binary needs lipo or llvm-lipo, neither was found")
+}
+
+// Universal combines the darwin/amd64 and darwin/arm64 binaries, which must
+// have been built, into a universal binary in the darwin/universal directory
+func (b GoBuild) Universal(ctx context.Context, out io.Writer) error {
+	tool, err := lipo()
+	if err != nil {
+		return err
+	}
+	output := filepath.Join(b.Dir(darwinUniversal), b.Binary)
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(output), err)
+	}
+	cmd := exec.CommandContext(ctx, tool, "-create", "-output", output,
+		filepath.Join(b.Dir(darwinAMD64), b.Binary),
+		filepath.Join(b.Dir(darwinARM64), b.Binary))
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("lipo for %s failed: %w", darwinUniversal, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Verify is a command that must pass between building and publishing, such
+// as the project's tests
+type Verify struct {
+	Command string
+	// Timeout limits the command, 0 for no limit
+	Timeout time.Duration
+	// Log also writes the command's output to a timestamped log file
+	Log bool
+}
+
+// RunVerify runs the VERIFY_COMMAND with the shell, with the same
+// environment as hooks. Its output is also written to a log file with
+// VERIFY_LOG, whose path is reported to CI if it fails. An empty command
+// does nothing.
+func (g *GitHubReleaser) RunVerify(info BuildInfo, artifacts []string) error {
+	v := g.config.Verify
+	if strings.TrimSpace(v.Command) == "" {
+		return nil
+	}
+
+	var file *logFile
+	if v.Log {
+		dir := g.config.BuildLogDir
+		if dir == "" {
+			dir = "dist"
+		}
+		var err error
+		if file, err = createLogFile(dir, "verify"); err != nil {
+			return fmt.Errorf("failed to create verify log: %w", err)
+		}
+	}
+
+	ui.Step("Running VERIFY_COMMAND")
+	err := runVerifyCommand(v, info, artifacts, file)
+	if file == nil {
+		return err
+	}
+	if err != nil {
+		file.Printf("Verify failed: %v\n", err)
+	}
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		ui.Printf("Verify log written to %s\n", file.Path)
+		if err := SetCIOutput("verify-log", file.Path); err != nil {
+			ui.Printf("Warning: %v\n", err)
+		}
+	}
+	return err
+}
+
+// runVerifyCommand runs the verify command, writing its output to file
+// as well unless it's nil
+func runVerifyCommand(v Verify, info BuildInfo, artifacts []string, file *logFile) error {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if v.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, v.Timeout)
+	}
+	defer cancel()
+
+	parts := buildRunner{}.Shell(v.Command)
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Env = append(os.Environ(), info.Env()...)
+	cmd.Env = append(cmd.Env, "RELEASE_ARTIFACTS="+strings.Join(artifacts, " "))
+	var out io.Writer = ui.Output()
+	if file != nil {
+		out = io.MultiWriter(ui.Output(), file)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = killWaitDelay
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("VERIFY_COMMAND timed out after %s", v.Timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("VERIFY_COMMAND failed: %w", err)
+	}
+	return nil
+}
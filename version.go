@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionOptions are the command-line inputs that select a version
+type VersionOptions struct {
+	Command string
+	Args    []string
+	Auto    bool
+	Channel string
+	// Nightly versions the next release as a nightly build of HEAD
+	Nightly bool
+	// Now is the date of nightly builds
+	Now time.Time
+}
+
+// ResolveVersion picks the version to release from the command line, or
+// derives one when it isn't given, and normalizes it to the project's tag
+// style, including the component's tag prefix
+func ResolveVersion(config Config, opts VersionOptions) (string, error) {
+	switch config.VersionScheme {
+	case "", "semver":
+	case "calver":
+		return resolveCalVer(config, opts)
+	default:
+		return "", fmt.Errorf("unknown VERSION_SCHEME %q (expected semver or calver)", config.VersionScheme)
+	}
+
+	comp := config.Component()
+
+	var version string
+	var err error
+	switch {
+	case opts.Command == "bump":
+		version, err = BumpVersion(comp, opts.Args[0])
+		if err != nil {
+			return "", fmt.Errorf("failed to compute next version: %w", err)
+		}
+		ui.Printf("Next version %s\n", version)
+	case opts.Auto:
+		version, err = AutoVersion(comp)
+		if err != nil {
+			return "", fmt.Errorf("failed to infer version: %w", err)
+		}
+		ui.Printf("Inferred version %s\n", version)
+	case len(opts.Args) == 1:
+		version = strings.TrimPrefix(opts.Args[0], comp.TagPrefix)
+	case opts.Channel != "" || opts.Nightly:
+		// A tag on HEAD is a finished release, so channel and nightly
+		// releases always target the next stable version
+		version = "v0.1.0"
+		if _, err := comp.LatestTag(); err == nil {
+			if version, err = AutoVersion(comp); err != nil {
+				return "", fmt.Errorf("failed to infer version: %w", err)
+			}
+		}
+	default:
+		version, err = DetectVersion(comp)
+		if err != nil {
+			return "", fmt.Errorf("failed to detect version: %w", err)
+		}
+		ui.Printf("Detected version %s\n", version)
+	}
+
+	// Normalize 1.2.3 and v1.2.3 to the project's tag style
+	parsed, err := ParseVersion(version)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Channel != "" {
+		if parsed.Prerelease != "" {
+			return "", fmt.Errorf("version %s is already a pre-release, don't combine it with --channel", version)
+		}
+		if parsed, err = NextChannelVersion(comp, parsed, opts.Channel, config.NoVPrefix); err != nil {
+			return "", err
+		}
+		ui.Printf("Next %s version %s\n", opts.Channel, parsed.Tag(config.NoVPrefix))
+	}
+
+	if opts.Nightly {
+		commit, err := gitOutput("rev-parse", "--short", "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		parsed.Prerelease = "nightly." + opts.Now.UTC().Format("20060102")
+		parsed.Build = commit
+		ui.Printf("Nightly version %s\n", parsed.Tag(config.NoVPrefix))
+	}
+
+	return comp.TagPrefix + parsed.Tag(config.NoVPrefix), nil
+}
+
+// NextChannelVersion returns base with the next "-channel.N" pre-release
+// suffix, counting up from 1 past existing tags for the same base version
+func NextChannelVersion(comp Component, base Version, channel string, noV bool) (Version, error) {
+	if err := checkIdentifiers(channel, true); err != nil || strings.Contains(channel, ".") || isNumeric(channel) {
+		return Version{}, fmt.Errorf("invalid channel name %q", channel)
+	}
+
+	base.Prerelease, base.Build = "", ""
+	prefix := base.Tag(noV) + "-" + channel + "."
+
+	tags, err := comp.Tags(prefix + "*")
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	next := 1
+	for _, tag := range tags {
+		counter := strings.TrimPrefix(tag, prefix)
+		if !isNumeric(counter) {
+			continue
+		}
+		if n, err := strconv.Atoi(counter); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+
+	base.Prerelease = fmt.Sprintf("%s.%d", channel, next)
+	return base, nil
+}
+
+// ReleaseChannel returns the channel of a pre-release version, like "rc"
+// for v1.2.0-rc.3, or "" for stable and non-semver versions
+func ReleaseChannel(comp Component, version string) string {
+	v, err := ParseVersion(strings.TrimPrefix(version, comp.TagPrefix))
+	if err != nil || v.Prerelease == "" {
+		return ""
+	}
+	return strings.SplitN(v.Prerelease, ".", 2)[0]
+}
+
+// resolveCalVer is ResolveVersion for the calver scheme, where the next
+// version comes from the calendar rather than from commits
+func resolveCalVer(config Config, opts VersionOptions) (string, error) {
+	if opts.Command == "bump" || opts.Auto || opts.Channel != "" || opts.Nightly {
+		return "", fmt.Errorf("bump, nightly, --auto and --channel are not supported with VERSION_SCHEME=calver")
+	}
+
+	calver, err := NewCalVer(config.CalVerFormat)
+	if err != nil {
+		return "", err
+	}
+
+	comp := config.Component()
+
+	var version string
+	switch {
+	case len(opts.Args) == 1:
+		version = opts.Args[0]
+	case ciTag(comp) != "":
+		version = ciTag(comp)
+	default:
+		if tag, err := comp.HeadTag(); err == nil && tag != "" {
+			version = tag
+			break
+		}
+		tags, err := comp.Tags("*")
+		if err != nil {
+			return "", fmt.Errorf("failed to list tags: %w", err)
+		}
+		version = calver.Next(time.Now(), tags)
+		ui.Printf("Detected version %s\n", comp.TagPrefix+version)
+	}
+
+	version = strings.TrimPrefix(version, comp.TagPrefix)
+	if err := calver.Validate(version); err != nil {
+		return "", err
+	}
+
+	version = strings.TrimPrefix(version, "v")
+	if !config.NoVPrefix {
+		version = "v" + version
+	}
+	return comp.TagPrefix + version, nil
+}
+
+// ciTag returns the component's tag that triggered a GitHub Actions
+// workflow, if any
+func ciTag(comp Component) string {
+	tag := os.Getenv("GITHUB_REF_NAME")
+	if os.Getenv("GITHUB_REF_TYPE") != "tag" || tag == "" || !strings.HasPrefix(tag, comp.TagPrefix) {
+		return ""
+	}
+	return tag
+}
+
+// DetectVersion derives the release version when none is given on the
+// command line. A tag pointing at HEAD wins (tag-triggered CI builds);
+// otherwise the next version is inferred from the commits since the
+// latest tag. The result has no tag prefix.
+func DetectVersion(comp Component) (string, error) {
+	// GitHub Actions exposes the tag that triggered the workflow
+	if tag := ciTag(comp); tag != "" {
+		return strings.TrimPrefix(tag, comp.TagPrefix), nil
+	}
+
+	if tag, err := comp.HeadTag(); err == nil && tag != "" {
+		return strings.TrimPrefix(tag, comp.TagPrefix), nil
+	}
+
+	if _, err := comp.LatestTag(); err != nil {
+		// No tags yet, start with an initial development release
+		return "v0.1.0", nil
+	}
+
+	return AutoVersion(comp)
+}
+
+// Version is a parsed semantic version (https://semver.org)
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// ParseVersion parses a semantic version, with or without a leading "v"
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	raw := s
+	s = strings.TrimPrefix(s, "v")
+
+	if i := strings.Index(s, "+"); i >= 0 {
+		v.Build = s[i+1:]
+		s = s[:i]
+		if err := checkIdentifiers(v.Build, false); err != nil {
+			return Version{}, fmt.Errorf("invalid build metadata in version %q: %w", raw, err)
+		}
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+		if err := checkIdentifiers(v.Prerelease, true); err != nil {
+			return Version{}, fmt.Errorf("invalid pre-release in version %q: %w", raw, err)
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH (e.g., v1.0.0)", raw)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		if !isNumeric(part) || (len(part) > 1 && part[0] == '0') {
+			return Version{}, fmt.Errorf("invalid version %q: %q is not a valid version number", raw, part)
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", raw, err)
+		}
+		*nums[i] = n
+	}
+
+	return v, nil
+}
+
+// checkIdentifiers validates dot-separated pre-release or build identifiers
+func checkIdentifiers(s string, prerelease bool) error {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return fmt.Errorf("empty identifier")
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return fmt.Errorf("identifier %q may only contain [0-9A-Za-z-]", id)
+			}
+		}
+		if prerelease && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return fmt.Errorf("numeric identifier %q must not have leading zeros", id)
+		}
+	}
+	return nil
+}
+
+// isNumeric reports whether s is a non-empty string of ASCII digits
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the version without a "v" prefix
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Tag formats the version as a tag name, with a "v" prefix unless noV is set
+func (v Version) Tag(noV bool) string {
+	if noV {
+		return v.String()
+	}
+	return "v" + v.String()
+}
+
+// Compare returns -1, 0 or 1 as v has lower, equal or higher precedence
+// than w. Build metadata doesn't count, and a pre-release comes before its
+// release.
+func (v Version) Compare(w Version) int {
+	for _, d := range []int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Prerelease == w.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case w.Prerelease == "":
+		return -1
+	}
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(w.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		an, bn := isNumeric(a[i]), isNumeric(b[i])
+		switch {
+		case an && bn:
+			// No leading zeros, so the longer number is the larger
+			if len(a[i]) != len(b[i]) {
+				return sign(len(a[i]) - len(b[i]))
+			}
+			return strings.Compare(a[i], b[i])
+		case an:
+			return -1
+		case bn:
+			return 1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return sign(len(a) - len(b))
+}
+
+// sign returns -1, 0 or 1 as n is negative, zero or positive
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Bump returns the next version at the given level: patch, minor or major.
+// Bumping a pre-release releases the version it leads up to, so
+// 1.3.0-rc.1 bumps to 1.3.0 for minor and patch alike.
+func (v Version) Bump(level string) (Version, error) {
+	next := Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	pre := v.Prerelease != ""
+
+	switch level {
+	case "patch":
+		if !pre {
+			next.Patch++
+		}
+	case "minor":
+		if !pre || next.Patch != 0 {
+			next.Minor++
+			next.Patch = 0
+		}
+	case "major":
+		if !pre || next.Minor != 0 || next.Patch != 0 {
+			next.Major++
+			next.Minor, next.Patch = 0, 0
+		}
+	default:
+		return Version{}, fmt.Errorf("unknown bump level %q (expected patch, minor or major)", level)
+	}
+
+	return next, nil
+}
+
+// BumpVersion computes the next version after the component's latest tag.
+// Without any tags the bump starts from 0.0.0. The result has no tag prefix.
+func BumpVersion(comp Component, level string) (string, error) {
+	current := Version{}
+	noV := false
+	if tag, err := comp.LatestTag(); err == nil {
+		tag = strings.TrimPrefix(tag, comp.TagPrefix)
+		if current, err = ParseVersion(tag); err != nil {
+			return "", fmt.Errorf("latest tag %q is not a semantic version: %w", tag, err)
+		}
+		noV = !strings.HasPrefix(tag, "v")
+	}
+
+	next, err := current.Bump(level)
+	if err != nil {
+		return "", err
+	}
+	return next.Tag(noV), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"v0.0.0", Version{}},
+		{"v10.20.30", Version{Major: 10, Minor: 20, Patch: 30}},
+		{"1.0.0-rc.1", Version{Major: 1, Prerelease: "rc.1"}},
+		{"1.0.0-alpha-beta.0", Version{Major: 1, Prerelease: "alpha-beta.0"}},
+		{"1.0.0+build.5", Version{Major: 1, Build: "build.5"}},
+		{"v2.1.0-beta.2+exp.sha.5114f85", Version{Major: 2, Minor: 1, Prerelease: "beta.2", Build: "exp.sha.5114f85"}},
+		{"1.0.0+001", Version{Major: 1, Build: "001"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if s := got.String(); s != tt.in && "v"+s != tt.in {
+			t.Errorf("ParseVersion(%q).String() = %q", tt.in, s)
+		}
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, in := range []string{
+		"", "1", "1.2", "1.2.3.4", "01.2.3", "1.02.3", "1.2.-3", "a.b.c",
+		"1.2.3-", "1.2.3-rc..1", "1.2.3-rc.01", "1.2.3-rc_1", "1.2.3+", "1.2.3+a..b",
+	} {
+		if v, err := ParseVersion(in); err == nil {
+			t.Errorf("ParseVersion(%q) = %+v, want an error", in, v)
+		}
+	}
+}
+
+func TestBump(t *testing.T) {
+	tests := []struct {
+		version, level, want string
+	}{
+		{"1.2.3", "patch", "1.2.4"},
+		{"1.2.3", "minor", "1.3.0"},
+		{"1.2.3", "major", "2.0.0"},
+		{"0.0.0", "patch", "0.0.1"},
+		{"1.2.3+build.1", "patch", "1.2.4"},
+		// A pre-release bumps to the release it leads up to
+		{"1.3.0-rc.1", "patch", "1.3.0"},
+		{"1.3.0-rc.1", "minor", "1.3.0"},
+		{"1.3.1-rc.1", "minor", "1.4.0"},
+		{"2.0.0-beta", "major", "2.0.0"},
+		{"2.1.0-beta", "major", "3.0.0"},
+		{"2.0.1-beta", "major", "3.0.0"},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := v.Bump(tt.level)
+		if err != nil {
+			t.Errorf("Bump(%q) of %s failed: %v", tt.level, tt.version, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Bump(%q) of %s = %s, want %s", tt.level, tt.version, got, tt.want)
+		}
+	}
+
+	if _, err := (Version{Major: 1}).Bump("build"); err == nil {
+		t.Error("Bump(\"build\") succeeded")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// In ascending order, as in the semver spec's example
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "1.10.0", "2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			va, _ := ParseVersion(a)
+			vb, _ := ParseVersion(b)
+			want := sign(i - j)
+			if got := va.Compare(vb); got != want {
+				t.Errorf("%s compared to %s = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+
+	a, _ := ParseVersion("1.0.0+build.1")
+	b, _ := ParseVersion("1.0.0+build.2")
+	if got := a.Compare(b); got != 0 {
+		t.Errorf("versions differing in build metadata compare as %d", got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jsWasm is the browser WebAssembly target
+var jsWasm = GoTarget{OS: "js", Arch: "wasm"}
+
+// isWasm reports whether a target builds WebAssembly, such as js/wasm for
+// browsers or wasip1/wasm for WASI runtimes. Those modules aren't native
+// executables and can't use cgo.
+func isWasm(t GoTarget) bool {
+	return t.Arch == "wasm"
+}
+
+// BinaryName returns the file name of a target's binary: .exe on Windows,
+// .wasm for WebAssembly
+func (b GoBuild) BinaryName(t GoTarget) string {
+	switch {
+	case t.OS == "windows":
+		return b.Binary + ".exe"
+	case isWasm(t):
+		return b.Binary + ".wasm"
+	}
+	return b.Binary
+}
+
+// copyWasmExec copies wasm_exec.js, which loads js/wasm modules in the
+// browser, from the Go installation that built the target into its
+// directory. It must match the Go version, so it's shipped with the module.
+func (b GoBuild) copyWasmExec(ctx context.Context) error {
+	cmd, err := b.Runner.Command(ctx, nil, "go", "env", "GOROOT")
+	if err != nil {
+		return err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to find GOROOT: %w", err)
+	}
+	goroot := strings.TrimSpace(stdout.String())
+
+	// Go 1.24 moved it from misc/wasm to lib/wasm
+	for _, dir := range []string{"lib", "misc"} {
+		data, err := os.ReadFile(filepath.Join(goroot, dir, "wasm", "wasm_exec.js"))
+		if err != nil {
+			continue
+		}
+		return os.WriteFile(filepath.Join(b.Dir(jsWasm), "wasm_exec.js"), data, 0644)
+	}
+	// The Go installation of a container build is inside its image
+	return fmt.Errorf("wasm_exec.js not found in %s", goroot)
+}